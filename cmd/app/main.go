@@ -30,17 +30,33 @@ func main() {
 
 	config := config.LoadConfig()
 
-	// Create Redis store
-	redisStore, err := store.NewRedisStore()
+	// Unlock cookies, reporter IDs and visitor hashes are all keyed with the cookie secret
+	if config.CookieSecret == "" {
+		if config.AppEnv == "production" {
+			log.Fatal("COOKIE_SECRET must be set in production")
+		}
+		log.Print("WARNING: COOKIE_SECRET is not set; using a random secret, so unlock cookies, abuse report " +
+			"de-duplication and unique visitor counts reset on every restart and differ between replicas")
+	}
+
+	// Create the configured store backend
+	urlStore, err := store.New(config.StoreBackend)
 	if err != nil {
-		log.Fatalf("Failed to create Redis store: %v", err)
+		log.Fatalf("Failed to create %s store: %v", config.StoreBackend, err)
 	}
 	defer func() {
-		if err := redisStore.Close(); err != nil {
-			log.Printf("Error closing Redis store: %v", err)
+		if err := urlStore.Close(); err != nil {
+			log.Printf("Error closing %s store: %v", config.StoreBackend, err)
 		}
 	}()
 
+	// Permanently remove deleted links once they can no longer be restored, and click events past their retention
+	if config.PurgeInterval > 0 {
+		purgeCtx, stopPurger := context.WithCancel(context.Background())
+		defer stopPurger()
+		go store.NewPurger(urlStore, config.DeletedLinkRetention, config.ClickEventRetention, config.PurgeInterval).Run(purgeCtx)
+	}
+
 	// Get the absolute path to the templates directory
 	wd, err := os.Getwd()
 	if err != nil {
@@ -49,7 +65,27 @@ func main() {
 	templateDir := filepath.Join(wd, "templates")
 
 	// Create handler with store and template directory
-	handler := api.NewHandler(redisStore, *config, templateDir)
+	handler := api.NewHandler(urlStore, *config, templateDir)
+
+	// Enforce destination policies, reloading them as they change
+	if err := handler.Policies().Reload(context.Background()); err != nil {
+		log.Fatalf("Failed to load destination policies: %v", err)
+	}
+	if config.PolicyReloadInterval > 0 {
+		policyCtx, stopPolicyReload := context.WithCancel(context.Background())
+		defer stopPolicyReload()
+		go handler.Policies().Run(policyCtx, config.PolicyReloadInterval)
+	}
+
+	// Check destinations against the local threat lists, reloading them as they are updated
+	if err := handler.Threats().Reload(); err != nil {
+		log.Fatalf("Failed to load threat lists: %v", err)
+	}
+	if config.ThreatListReloadInterval > 0 && len(config.ThreatLists) > 0 {
+		threatCtx, stopThreatReload := context.WithCancel(context.Background())
+		defer stopThreatReload()
+		go handler.Threats().Run(threatCtx, config.ThreatListReloadInterval)
+	}
 
 	// Create static handler
 	staticHandler := api.NewStaticHandler(templateDir)
@@ -64,7 +100,7 @@ func main() {
 	// Add CORS middleware
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"chrome-extension://*"},
-		AllowedMethods: []string{"POST", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"Content-Type", "Authorization"},
 	}))
 
@@ -76,6 +112,16 @@ func main() {
 
 		r.Post("/api/shorten", handler.APIShorten)
 		r.Post("/shorten", handler.Shorten)
+
+		// Manage links with the token returned when they were created
+		r.Patch("/api/links/{code}", handler.UpdateLink)
+		r.Delete("/api/links/{code}", handler.DeleteLink)
+		r.Post("/api/links/{code}/restore", handler.RestoreLink)
+		r.Get("/api/links/{code}/history", handler.LinkHistory)
+		r.Post("/api/links/{code}/rollback", handler.RollbackLink)
+
+		// Visitors report malicious links into the moderation queue
+		r.Post("/report/{code}", handler.SubmitReport)
 	})
 
 	// Serve favicon.ico with higher rate limit
@@ -97,10 +143,10 @@ func main() {
 
 		// Health check endpoint
 		r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-			// Check Redis connection
-			if err := redisStore.Ping(); err != nil {
+			// Check store connection
+			if err := urlStore.Ping(r.Context()); err != nil {
 				w.WriteHeader(http.StatusServiceUnavailable)
-				if _, err := w.Write([]byte("Redis connection failed")); err != nil {
+				if _, err := w.Write([]byte("Store connection failed")); err != nil {
 					log.Printf("Error writing response: %v", err)
 				}
 				return
@@ -112,6 +158,24 @@ func main() {
 		})
 
 		r.Post("/click-counts", handler.URLClickCounts)
+		r.Get("/api/links/{code}/stats", handler.LinkStats)
+
+		// Admin API, enabled by setting ADMIN_TOKEN
+		r.Group(func(r chi.Router) {
+			r.Use(handler.RequireAdmin)
+			r.Use(middleware.NoCache)
+
+			r.Get("/api/links", handler.ListLinks)
+			r.Get("/api/links/search", handler.SearchLinks)
+			r.Get("/api/policy", handler.GetPolicy)
+			r.Put("/api/policy", handler.PutPolicy)
+			r.Post("/api/threat-lists/reload", handler.ReloadThreatLists)
+			r.Get("/api/reports", handler.ListReports)
+			r.Post("/api/reports/{code}/dismiss", handler.DismissReports)
+			r.Post("/api/reports/{code}/disable", handler.DisableReportedLink)
+		})
+
+		r.Get("/report/{code}", handler.ReportForm)
 
 		// Static pages
 		r.Get("/terms", staticHandler.ServeTerms)
@@ -122,6 +186,7 @@ func main() {
 
 		// This should be the last route as it catches all other paths
 		r.Get("/{shortURL}", handler.Redirect)
+		r.Post("/{shortURL}", handler.Unlock)
 		r.Get("/", handler.Home)
 	})
 
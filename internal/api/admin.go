@@ -0,0 +1,214 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+// LinkSummary is how a link is shown in admin listings
+type LinkSummary struct {
+	Code              string           `json:"code"`
+	ShortURL          string           `json:"short_url"`
+	OriginalURL       string           `json:"original_url"`
+	CreatedAt         time.Time        `json:"created_at"`
+	ClickCount        int64            `json:"click_count"`
+	Status            store.LinkStatus `json:"status"`
+	ExpiresAt         *time.Time       `json:"expires_at,omitempty"`
+	MaxClicks         int64            `json:"max_clicks,omitempty"`
+	PasswordProtected bool             `json:"password_protected"`
+	DeletedAt         *time.Time       `json:"deleted_at,omitempty"`
+
+	Title       string            `json:"title,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+func (h *Handler) newLinkSummary(rec store.LinkRecord) LinkSummary {
+	summary := LinkSummary{
+		Code:              rec.Code,
+		ShortURL:          h.config.BaseURL + "/" + rec.Code,
+		OriginalURL:       rec.OriginalURL,
+		CreatedAt:         rec.CreatedAt,
+		ClickCount:        rec.ClickCount,
+		Status:            rec.Status,
+		MaxClicks:         rec.MaxClicks,
+		PasswordProtected: rec.HasPassword(),
+		Title:             rec.Title,
+		Description:       rec.Description,
+		Tags:              rec.Tags,
+		Metadata:          rec.Metadata,
+	}
+	if !rec.ExpiresAt.IsZero() {
+		summary.ExpiresAt = &rec.ExpiresAt
+	}
+	if !rec.DeletedAt.IsZero() {
+		summary.DeletedAt = &rec.DeletedAt
+	}
+	return summary
+}
+
+// hasAdminToken reports whether the request carries the configured admin token as a bearer token
+func (h *Handler) hasAdminToken(r *http.Request) bool {
+	return h.config.AdminToken != "" && subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(h.config.AdminToken)) == 1
+}
+
+// RequireAdmin only lets requests through that carry the configured admin token as a bearer token
+func (h *Handler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.config.AdminToken == "" {
+			h.respondWithJSON(w, http.StatusForbidden, map[string]string{"error": "Admin API is not enabled"})
+			return
+		}
+		if !h.hasAdminToken(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ShortenMe admin"`)
+			h.respondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or missing admin token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListLinks pages through every link, newest first. Filters: created_after and
+// created_before (RFC 3339), min_clicks, max_clicks, host, status and tag.
+func (h *Handler) ListLinks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	opts, err := parseListOptions(r)
+	if err != nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	page, err := h.store.ListLinks(ctx, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		status := http.StatusInternalServerError
+		if errors.Is(err, store.ErrInvalidCursor) {
+			status = http.StatusBadRequest
+		}
+		h.respondWithJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	links := make([]LinkSummary, 0, len(page.Links))
+	for _, rec := range page.Links {
+		links = append(links, h.newLinkSummary(rec))
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]any{
+		"links":       links,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+// SearchLinks finds links by words in their destination URL, code, title or tags, newest first
+func (h *Handler) SearchLinks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "q is required"})
+		return
+	}
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	records, err := h.store.SearchLinks(ctx, store.SearchOptions{Query: q, Limit: limit})
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		h.respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	links := make([]LinkSummary, 0, len(records))
+	for _, rec := range records {
+		links = append(links, h.newLinkSummary(rec))
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]any{
+		"query": q,
+		"links": links,
+	})
+}
+
+// parseLimit reads an optional result count, returning 0 when it is not set
+func parseLimit(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > store.MaxListLimit {
+		return 0, errors.New("limit must be between 1 and " + strconv.Itoa(store.MaxListLimit))
+	}
+	return limit, nil
+}
+
+// parseListOptions reads the listing query parameters
+func parseListOptions(r *http.Request) (store.ListOptions, error) {
+	query := r.URL.Query()
+	opts := store.ListOptions{
+		Cursor: query.Get("cursor"),
+		Host:   query.Get("host"),
+		Status: store.LinkStatus(query.Get("status")),
+		Tag:    query.Get("tag"),
+	}
+
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		return store.ListOptions{}, err
+	}
+	opts.Limit = limit
+
+	for _, bound := range []struct {
+		param string
+		dest  *time.Time
+	}{
+		{"created_after", &opts.CreatedAfter},
+		{"created_before", &opts.CreatedBefore},
+	} {
+		if v := query.Get(bound.param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return store.ListOptions{}, errors.New("invalid " + bound.param + " timestamp")
+			}
+			*bound.dest = t
+		}
+	}
+
+	for _, bound := range []struct {
+		param string
+		dest  **int64
+	}{
+		{"min_clicks", &opts.MinClicks},
+		{"max_clicks", &opts.MaxClicks},
+	} {
+		if v := query.Get(bound.param); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return store.ListOptions{}, errors.New("invalid " + bound.param)
+			}
+			*bound.dest = &n
+		}
+	}
+
+	if opts.Status != "" && !opts.Status.Valid() {
+		return store.ListOptions{}, errors.New("invalid status")
+	}
+
+	return opts, nil
+}
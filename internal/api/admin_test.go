@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yingtu35/ShortenMe/internal/config"
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+const testAdminToken = "admin-secret"
+
+// setupAdmin creates a router exposing the admin API over a memory store
+func setupAdmin(t *testing.T, adminToken string) (*store.MemoryStore, http.Handler) {
+	t.Helper()
+
+	memoryStore, handler, r := newTestServer(t, config.Config{AdminToken: adminToken})
+	r.With(handler.RequireAdmin).Get("/api/links", handler.ListLinks)
+	r.With(handler.RequireAdmin).Get("/api/links/search", handler.SearchLinks)
+
+	return memoryStore, r
+}
+
+func adminRequest(r http.Handler, target, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+type listResponse struct {
+	Links      []LinkSummary `json:"links"`
+	NextCursor string        `json:"next_cursor"`
+}
+
+func TestRequireAdmin(t *testing.T) {
+	_, r := setupAdmin(t, testAdminToken)
+
+	if rr := adminRequest(r, "/api/links", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("without token: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := adminRequest(r, "/api/links", "wrong"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("with wrong token: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := adminRequest(r, "/api/links", testAdminToken); rr.Code != http.StatusOK {
+		t.Errorf("with admin token: got %v want %v: %v", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	_, disabled := setupAdmin(t, "")
+	if rr := adminRequest(disabled, "/api/links", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("admin API without ADMIN_TOKEN: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestListLinksPages(t *testing.T) {
+	memoryStore, r := setupAdmin(t, testAdminToken)
+	ctx := context.Background()
+
+	for _, alias := range []string{"first", "second", "third"} {
+		if _, err := memoryStore.CreateShortURL(ctx, "https://example.com/"+alias, store.CreateOptions{Alias: alias}); err != nil {
+			t.Fatalf("CreateShortURL(%q) error: %v", alias, err)
+		}
+	}
+
+	seen := map[string]bool{}
+	target := "/api/links?limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("listing did not terminate")
+		}
+
+		rr := adminRequest(r, target, testAdminToken)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("ListLinks returned %v: %v", rr.Code, rr.Body.String())
+		}
+		var page listResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+			t.Fatalf("failed to parse response body: %v", err)
+		}
+		for _, link := range page.Links {
+			if link.ShortURL != "http://localhost:8080/"+link.Code {
+				t.Errorf("short_url = %q for code %q", link.ShortURL, link.Code)
+			}
+			seen[link.Code] = true
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		target = "/api/links?limit=2&cursor=" + page.NextCursor
+	}
+
+	if len(seen) != 3 {
+		t.Errorf("listed %v, want all three links", seen)
+	}
+}
+
+func TestListLinksFiltersByHost(t *testing.T) {
+	memoryStore, r := setupAdmin(t, testAdminToken)
+	ctx := context.Background()
+
+	if _, err := memoryStore.CreateShortURL(ctx, "https://example.com/a", store.CreateOptions{Alias: "example"}); err != nil {
+		t.Fatalf("CreateShortURL() error: %v", err)
+	}
+	if _, err := memoryStore.CreateShortURL(ctx, "https://other.org/b", store.CreateOptions{Alias: "other"}); err != nil {
+		t.Fatalf("CreateShortURL() error: %v", err)
+	}
+
+	rr := adminRequest(r, "/api/links?host=other.org", testAdminToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("ListLinks returned %v: %v", rr.Code, rr.Body.String())
+	}
+	var page listResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if len(page.Links) != 1 || page.Links[0].Code != "other" {
+		t.Errorf("host filter returned %+v, want only other", page.Links)
+	}
+}
+
+func TestListLinksFiltersByTag(t *testing.T) {
+	memoryStore, r := setupAdmin(t, testAdminToken)
+	ctx := context.Background()
+
+	opts := store.CreateOptions{Alias: "spring", Title: "Spring sale", Tags: []string{"campaign"}}
+	if _, err := memoryStore.CreateShortURL(ctx, "https://example.com/a", opts); err != nil {
+		t.Fatalf("CreateShortURL() error: %v", err)
+	}
+	if _, err := memoryStore.CreateShortURL(ctx, "https://example.com/b", store.CreateOptions{Alias: "untagged"}); err != nil {
+		t.Fatalf("CreateShortURL() error: %v", err)
+	}
+
+	rr := adminRequest(r, "/api/links?tag=Campaign", testAdminToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("ListLinks returned %v: %v", rr.Code, rr.Body.String())
+	}
+	var page listResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if len(page.Links) != 1 || page.Links[0].Code != "spring" {
+		t.Fatalf("tag filter returned %+v, want only spring", page.Links)
+	}
+	if link := page.Links[0]; link.Title != "Spring sale" || len(link.Tags) != 1 || link.Tags[0] != "campaign" {
+		t.Errorf("listed link = %+v, want its title and tags", link)
+	}
+}
+
+func TestListLinksRejectsBadParameters(t *testing.T) {
+	_, r := setupAdmin(t, testAdminToken)
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=abc",
+		"created_after=yesterday",
+		"min_clicks=-1",
+		"status=archived",
+		"cursor=not-a-cursor",
+	} {
+		if rr := adminRequest(r, "/api/links?"+query, testAdminToken); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %v want %v", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestSearchLinks(t *testing.T) {
+	memoryStore, r := setupAdmin(t, testAdminToken)
+	ctx := context.Background()
+
+	if _, err := memoryStore.CreateShortURL(ctx, "https://example.com/pricing", store.CreateOptions{Alias: "spring-sale"}); err != nil {
+		t.Fatalf("CreateShortURL() error: %v", err)
+	}
+	if _, err := memoryStore.CreateShortURL(ctx, "https://other.org/docs", store.CreateOptions{Alias: "docs"}); err != nil {
+		t.Fatalf("CreateShortURL() error: %v", err)
+	}
+
+	rr := adminRequest(r, "/api/links/search?q=pricing", testAdminToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("SearchLinks returned %v: %v", rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Query string        `json:"query"`
+		Links []LinkSummary `json:"links"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if response.Query != "pricing" || len(response.Links) != 1 || response.Links[0].Code != "spring-sale" {
+		t.Errorf("SearchLinks response = %+v, want only spring-sale", response)
+	}
+
+	if rr := adminRequest(r, "/api/links/search?q=+", testAdminToken); rr.Code != http.StatusBadRequest {
+		t.Errorf("blank query: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr := adminRequest(r, "/api/links/search?q=docs", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("search without token: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
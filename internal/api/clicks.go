@@ -0,0 +1,71 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/go-chi/httprate"
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+// maxClickHeaderLength caps how many bytes of each request header a click event keeps
+const maxClickHeaderLength = 512
+
+// Prefix lengths an anonymized IP is cut down to, roughly a network rather than a household
+const (
+	anonymizedIPv4Bits = 24
+	anonymizedIPv6Bits = 48
+)
+
+// clickEvent collects the details of a redirect request that are kept in the click log
+func (h *Handler) clickEvent(r *http.Request) store.ClickEvent {
+	event := store.ClickEvent{
+		Referrer:       truncateHeader(r.Referer()),
+		UserAgent:      truncateHeader(r.UserAgent()),
+		AcceptLanguage: truncateHeader(r.Header.Get("Accept-Language")),
+	}
+	if ip, err := httprate.KeyByIP(r); err == nil {
+		event.IP = anonymizeIP(ip)
+		event.Visitor = h.visitorID(ip, r.UserAgent())
+	}
+	return event
+}
+
+// visitorID fingerprints a visitor by their full IP and user agent for counting unique visitors.
+// It is keyed like the reporter IDs, so it cannot be reversed by hashing every address.
+func (h *Handler) visitorID(ip, userAgent string) string {
+	mac := hmac.New(sha256.New, h.unlockSecret)
+	mac.Write([]byte("visitor|" + ip + "|" + userAgent))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// anonymizeIP zeroes the host bits of an address, keeping only its network prefix.
+// Anything that is not an IP address is dropped.
+func anonymizeIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := anonymizedIPv6Bits
+	if addr.Is4() {
+		bits = anonymizedIPv4Bits
+	}
+	prefix, err := addr.WithZone("").Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.Addr().String()
+}
+
+// truncateHeader shortens a header value to maxClickHeaderLength without splitting a character
+func truncateHeader(v string) string {
+	if len(v) <= maxClickHeaderLength {
+		return v
+	}
+	return strings.ToValidUTF8(v[:maxClickHeaderLength], "")
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yingtu35/ShortenMe/internal/config"
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.42", "203.0.113.0"},
+		{"::ffff:203.0.113.42", "203.0.113.0"},
+		{"2001:db8:1234:5678::1", "2001:db8:1234::"},
+		{"fe80::1%eth0", "fe80::"},
+		{"not an ip", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := anonymizeIP(tt.ip); got != tt.want {
+			t.Errorf("anonymizeIP(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRedirectRecordsClickEvent(t *testing.T) {
+	templateDir := getTemplateDir(t)
+	cfg := config.Config{BaseURL: "http://localhost:8080"}
+
+	mockStore := &mockStore{
+		getURLDataFunc: func(string) (*store.URLData, error) {
+			return &store.URLData{OriginalURL: "https://example.com"}, nil
+		},
+		getOriginalURLFunc: func(string) (string, error) {
+			return "https://example.com", nil
+		},
+	}
+	handler := NewHandler(mockStore, cfg, templateDir)
+
+	r := chi.NewRouter()
+	r.Get("/{shortURL}", handler.Redirect)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	req.RemoteAddr = "198.51.100.23:41234"
+	req.Header.Set("Referer", "https://news.example/post")
+	req.Header.Set("User-Agent", strings.Repeat("x", 2*maxClickHeaderLength))
+	req.Header.Set("Accept-Language", "en-GB,en;q=0.9")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusFound)
+	}
+	want := store.ClickEvent{
+		Referrer:       "https://news.example/post",
+		UserAgent:      strings.Repeat("x", maxClickHeaderLength),
+		AcceptLanguage: "en-GB,en;q=0.9",
+		IP:             "198.51.100.0",
+	}
+	got := mockStore.lastClick
+	if got.Visitor == "" || strings.Contains(got.Visitor, "198.51.100.23") {
+		t.Errorf("visitor = %q, want a hash of the IP and user agent", got.Visitor)
+	}
+	got.Visitor = ""
+	if got != want {
+		t.Errorf("click event = %+v, want %+v", got, want)
+	}
+}
+
+func TestVisitorID(t *testing.T) {
+	handler := NewHandler(&mockStore{}, config.Config{}, getTemplateDir(t))
+
+	id := handler.visitorID("198.51.100.23", "Mozilla/5.0")
+	if id != handler.visitorID("198.51.100.23", "Mozilla/5.0") {
+		t.Error("visitorID() differs for the same visitor")
+	}
+	if id == handler.visitorID("198.51.100.24", "Mozilla/5.0") || id == handler.visitorID("198.51.100.23", "curl/8.0") {
+		t.Error("visitorID() matches for a different IP or user agent")
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yingtu35/ShortenMe/internal/config"
+)
+
+var (
+	// ErrSelfReference is returned for destinations on this shortener's own host
+	ErrSelfReference = errors.New("destination points back at this shortener")
+	// ErrShortenerHost is returned for destinations on another URL shortener
+	ErrShortenerHost = errors.New("destination is another URL shortener")
+)
+
+// resolveTimeout bounds how long following a destination's redirects may take
+const resolveTimeout = 5 * time.Second
+
+// DestinationGuard rejects destinations that would chain short links: our own host, known
+// shortener hosts and, if redirect resolution is on, redirect chains that loop or lead to either
+type DestinationGuard struct {
+	// ownHost and ownPort are where this shortener serves its links
+	ownHost string
+	ownPort string
+	// shortenerHosts are hosts of other shorteners; their subdomains match too
+	shortenerHosts []string
+	// resolver follows redirects at creation time; nil skips that check
+	resolver *RedirectResolver
+}
+
+// NewDestinationGuard builds the guard for the configured base URL and shortener hosts
+func NewDestinationGuard(cfg config.Config) *DestinationGuard {
+	g := &DestinationGuard{}
+	if base, err := url.Parse(cfg.BaseURL); err == nil {
+		g.ownHost, g.ownPort = strings.ToLower(base.Hostname()), effectivePort(base)
+	}
+	for _, host := range cfg.ShortenerHosts {
+		g.shortenerHosts = append(g.shortenerHosts, strings.ToLower(strings.TrimPrefix(host, ".")))
+	}
+	if cfg.ResolveRedirects {
+		g.resolver = &RedirectResolver{
+			Client:   newPublicHTTPClient(resolveTimeout),
+			MaxDepth: cfg.MaxRedirects,
+			Check:    g.CheckHost,
+		}
+	}
+	return g
+}
+
+// Check rejects destination if its host, or any host its redirects lead to, is not allowed.
+// A destination that cannot be reached is let through: it may only be down for now.
+func (g *DestinationGuard) Check(ctx context.Context, destination string) error {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return ErrInvalidURL
+	}
+	if err := g.CheckHost(u); err != nil {
+		return err
+	}
+	if g.resolver == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+
+	_, err = g.resolver.Resolve(ctx, destination)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrSelfReference), errors.Is(err, ErrShortenerHost),
+		errors.Is(err, ErrRedirectLoop), errors.Is(err, ErrTooManyRedirects):
+		return err
+	default:
+		log.Printf("Could not resolve redirects of %s: %v", destination, err)
+		return nil
+	}
+}
+
+// CheckHost rejects u if it is on our own host or a known shortener
+func (g *DestinationGuard) CheckHost(u *url.URL) error {
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == g.ownHost && effectivePort(u) == g.ownPort {
+		return fmt.Errorf("%w: %s", ErrSelfReference, u.Host)
+	}
+	for _, shortener := range g.shortenerHosts {
+		if host == shortener || strings.HasSuffix(host, "."+shortener) {
+			return fmt.Errorf("%w: %s", ErrShortenerHost, host)
+		}
+	}
+	return nil
+}
+
+// effectivePort returns u's port, or the default port of its scheme
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	return defaultPorts[strings.ToLower(u.Scheme)]
+}
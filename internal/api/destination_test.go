@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/yingtu35/ShortenMe/internal/config"
+)
+
+func TestCheckHost(t *testing.T) {
+	guard := NewDestinationGuard(config.Config{
+		BaseURL:        "https://sho.rt",
+		ShortenerHosts: []string{"bit.ly", ".TinyURL.com"},
+	})
+
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://example.com/a", nil},
+		{"https://sho.rt/abc", ErrSelfReference},
+		{"https://SHO.RT:443/abc", ErrSelfReference},
+		{"http://sho.rt/abc", nil},
+		{"https://sho.rt:8443/abc", nil},
+		{"https://bit.ly/x", ErrShortenerHost},
+		{"https://www.bit.ly/x", ErrShortenerHost},
+		{"https://tinyurl.com/x", ErrShortenerHost},
+		{"https://notbit.ly/x", nil},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := guard.CheckHost(u); !errors.Is(err, tt.want) {
+			t.Errorf("CheckHost(%q) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+}
+
+func TestGuardResolvesRedirects(t *testing.T) {
+	// self stands in for this shortener; a destination redirecting to it would loop through us
+	self := httptest.NewServer(http.NotFoundHandler())
+	defer self.Close()
+
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/to-self":
+			http.Redirect(w, r, self.URL+"/abc123", http.StatusFound)
+		case "/to-shortener":
+			http.Redirect(w, r, "https://bit.ly/x", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer destination.Close()
+
+	guard := NewDestinationGuard(config.Config{
+		BaseURL:        self.URL,
+		ShortenerHosts: []string{"bit.ly"},
+	})
+	// The default client would refuse the loopback test servers
+	guard.resolver = &RedirectResolver{Client: destination.Client(), MaxDepth: 5, Check: guard.CheckHost}
+
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{destination.URL + "/plain", nil},
+		{destination.URL + "/to-self", ErrSelfReference},
+		{destination.URL + "/to-shortener", ErrShortenerHost},
+		{self.URL + "/abc123", ErrSelfReference},
+	}
+	for _, tt := range tests {
+		if err := guard.Check(context.Background(), tt.url); !errors.Is(err, tt.want) {
+			t.Errorf("Check(%q) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+
+	// An unreachable destination is not rejected
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	if err := guard.Check(context.Background(), unreachable.URL+"/a"); err != nil {
+		t.Errorf("Check(unreachable) = %v, want nil", err)
+	}
+}
@@ -2,50 +2,120 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"html/template"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-chi/httprate"
 	"github.com/yingtu35/ShortenMe/internal/config"
+	"github.com/yingtu35/ShortenMe/internal/policy"
 	"github.com/yingtu35/ShortenMe/internal/store"
+	"github.com/yingtu35/ShortenMe/internal/threat"
 )
 
 type Handler struct {
 	store       store.Store
 	config      config.Config
 	templateDir string
+
+	// unlockSecret signs the cookies that remember a password-protected link was unlocked
+	unlockSecret []byte
+	// unlockFailures counts wrong passwords per link and client IP
+	unlockFailures *httprate.RateLimiter
+	// normalizer canonicalises every destination before it is stored
+	normalizer URLNormalizer
+	// guard rejects destinations that lead back to us or through other shorteners
+	guard *DestinationGuard
+	// policies are the allow and deny rules for destination hosts
+	policies *policy.Engine
+	// threats are the local phishing and malware lists
+	threats *threat.List
 }
 
 func NewHandler(store store.Store, config config.Config, templateDir string) *Handler {
 	return &Handler{
-		store:       store,
-		config:      config,
-		templateDir: templateDir,
+		store:          store,
+		config:         config,
+		templateDir:    templateDir,
+		unlockSecret:   newUnlockSecret(config.CookieSecret),
+		unlockFailures: httprate.NewRateLimiter(maxUnlockFailures, unlockFailureWindow),
+		normalizer: URLNormalizer{
+			StripParams: config.StripQueryParams,
+			SortParams:  config.SortQueryParams,
+		},
+		guard:    NewDestinationGuard(config),
+		policies: policy.NewEngine(newPolicySource(config, store)),
+		threats:  threat.NewList(config.ThreatLists...),
 	}
 }
 
 type ShortenedURL struct {
 	OriginalURL string
 	ShortURL    string
+	ManageToken string
 }
 
 type URLClickCounts struct {
-	ShortURL   string
-	ClickCount int64
+	ShortURL       string
+	ClickCount     int64
+	UniqueVisitors int64
 }
 
 type NotFound struct {
 	ShortURL string
 }
 
+type LinkExpired struct {
+	ShortURL string
+	Reason   string
+}
+
+type LinkUnavailable struct {
+	ShortURL string
+	Reason   string
+}
+
+// expiryFormLayout is what an HTML datetime-local input submits; it is read as UTC
+const expiryFormLayout = "2006-01-02T15:04"
+
+// parseExpiry reads an optional expiry given either as a Go duration ("24h")
+// or as an absolute RFC 3339 timestamp
+func parseExpiry(expiresIn, expiresAt string) (time.Duration, time.Time, error) {
+	if expiresIn != "" && expiresAt != "" {
+		return 0, time.Time{}, errors.New("set either expires_in or expires_at, not both")
+	}
+
+	if expiresIn != "" {
+		d, err := time.ParseDuration(expiresIn)
+		if err != nil {
+			return 0, time.Time{}, errors.New("invalid expires_in duration")
+		}
+		return d, time.Time{}, nil
+	}
+
+	if expiresAt != "" {
+		t, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			t, err = time.Parse(expiryFormLayout, expiresAt)
+		}
+		if err != nil {
+			return 0, time.Time{}, errors.New("invalid expires_at timestamp")
+		}
+		return 0, t, nil
+	}
+
+	return 0, time.Time{}, nil
+}
+
 // IsValidURL checks if the given string is a valid URL
+//
+// Deprecated: Use URLNormalizer.Normalize, which also returns the canonical form to store.
 func IsValidURL(input string) bool {
-	parsedURL, err := url.ParseRequestURI(input)
-	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
-		return false
-	}
-	return true
+	_, err := URLNormalizer{}.Normalize(input)
+	return err == nil
 }
 
 func (h *Handler) Home(w http.ResponseWriter, r *http.Request) {
@@ -71,20 +141,68 @@ func (h *Handler) Shorten(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !IsValidURL(url) {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+	url, err := h.normalizer.Normalize(url)
+	if err != nil {
+		http.Error(w, invalidURLMessage(err), http.StatusBadRequest)
+		return
+	}
+	if err := h.policies.Check(url); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if threatType, listed := h.threats.Lookup(url); listed {
+		http.Error(w, threatListedMessage(threatType), http.StatusForbidden)
+		return
+	}
+	if err := h.guard.Check(ctx, url); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	shortURL, err := h.store.CreateShortURL(url)
+	expiresIn, expiresAt, err := parseExpiry(r.PostFormValue("expires_in"), r.PostFormValue("expires_at"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var maxClicks int64
+	if v := r.PostFormValue("max_clicks"); v != "" {
+		maxClicks, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid max_clicks", http.StatusBadRequest)
+			return
+		}
+	}
+
+	manageToken, err := newManageToken()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	opts := store.CreateOptions{
+		Alias:       r.PostFormValue("alias"),
+		ExpiresIn:   expiresIn,
+		ExpiresAt:   expiresAt,
+		MaxClicks:   maxClicks,
+		Password:    r.PostFormValue("password"),
+		ManageToken: manageToken,
+	}
+
+	shortURL, err := h.store.CreateShortURL(ctx, url, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Client went away or the request timed out; nobody is left to read a response
+			return
+		}
+		http.Error(w, err.Error(), createErrorStatus(err))
+		return
+	}
+
 	shortenedURL := ShortenedURL{
 		OriginalURL: url,
 		ShortURL:    shortURL,
+		ManageToken: manageToken,
 	}
 
 	tmpl := template.Must(template.ParseFiles(h.templateDir + "/shorten.html"))
@@ -94,23 +212,94 @@ func (h *Handler) Shorten(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	select {
-	case <-ctx.Done():
-		return
-	default:
-	}
 }
 
 func (h *Handler) Redirect(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	shortURL := r.PathValue("shortURL")
 	if shortURL == "" {
 		http.Error(w, "Short URL is required", http.StatusBadRequest)
 		return
 	}
+	// Paths that cannot be short codes, such as internal store keys, are never looked up
+	if !store.ValidCode(shortURL) {
+		h.renderNotFound(w, shortURL)
+		return
+	}
+
+	// Look the link up without counting a click, so protected links are only counted once unlocked
+	urlData, err := h.store.GetURLData(ctx, shortURL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if urlData == nil {
+		tmpl := template.Must(template.ParseFiles(h.templateDir + "/not-found.html"))
+		err = tmpl.Execute(w, NotFound{ShortURL: shortURL})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	if !urlData.IsActive() {
+		h.linkUnavailable(w, shortURL, urlData.Status)
+		return
+	}
+
+	if urlData.HasPassword() && !h.isUnlocked(r, shortURL) {
+		tmpl := template.Must(template.ParseFiles(h.templateDir + "/unlock.html"))
+		err = tmpl.Execute(w, UnlockForm{ShortURL: shortURL})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	h.followLink(w, r, shortURL)
+}
+
+// followLink counts a click on shortURL, recording it in the link's click log, and redirects to its destination
+func (h *Handler) followLink(w http.ResponseWriter, r *http.Request, shortURL string) {
+	ctx := r.Context()
 
-	originalURL, err := h.store.GetOriginalURL(shortURL)
+	originalURL, err := h.store.FollowLink(ctx, shortURL, h.clickEvent(r))
+	if errors.Is(err, store.ErrLinkDisabled) || errors.Is(err, store.ErrLinkDeleted) || errors.Is(err, store.ErrLinkSuspended) {
+		// The status changed since Redirect looked the link up
+		status := store.StatusDisabled
+		switch {
+		case errors.Is(err, store.ErrLinkDeleted):
+			status = store.StatusDeleted
+		case errors.Is(err, store.ErrLinkSuspended):
+			status = store.StatusSuspended
+		}
+		h.linkUnavailable(w, shortURL, status)
+		return
+	}
+	if errors.Is(err, store.ErrLinkExpired) || errors.Is(err, store.ErrClickLimitReached) {
+		reason := "The owner of this short link set it to stop working after a certain time."
+		if errors.Is(err, store.ErrClickLimitReached) {
+			reason = "This short link has already been visited the maximum number of times allowed by its owner."
+		}
+
+		w.WriteHeader(http.StatusGone)
+		tmpl := template.Must(template.ParseFiles(h.templateDir + "/link-expired.html"))
+		err = tmpl.Execute(w, LinkExpired{ShortURL: shortURL, Reason: reason})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		return
+	}
 	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -124,19 +313,59 @@ func (h *Handler) Redirect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if threatType, listed := h.threats.Lookup(originalURL); listed {
+		h.threatWarning(w, shortURL, originalURL, threatType)
+		return
+	}
+
 	http.Redirect(w, r, originalURL, http.StatusFound)
 }
 
+// linkUnavailable serves the 410 page for a link that has been disabled or deleted
+func (h *Handler) linkUnavailable(w http.ResponseWriter, shortURL string, status store.LinkStatus) {
+	reason := "The owner of this short link has disabled it."
+	switch status {
+	case store.StatusDeleted:
+		reason = "The owner of this short link has deleted it."
+	case store.StatusSuspended:
+		reason = "This short link has been suspended after it was reported as abusive."
+	}
+
+	w.WriteHeader(http.StatusGone)
+	tmpl := template.Must(template.ParseFiles(h.templateDir + "/link-unavailable.html"))
+	err := tmpl.Execute(w, LinkUnavailable{ShortURL: shortURL, Reason: reason})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// renderNotFound serves the page for a short URL that does not name a link
+func (h *Handler) renderNotFound(w http.ResponseWriter, shortURL string) {
+	tmpl := template.Must(template.ParseFiles(h.templateDir + "/not-found.html"))
+	if err := tmpl.Execute(w, NotFound{ShortURL: shortURL}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func (h *Handler) URLClickCounts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	fullShortURL := r.FormValue("shortURL")
 	shortURL := strings.TrimPrefix(fullShortURL, h.config.BaseURL+"/")
 	if shortURL == "" {
 		http.Error(w, "Short URL is required", http.StatusBadRequest)
 		return
 	}
+	if !store.ValidCode(shortURL) {
+		h.renderNotFound(w, shortURL)
+		return
+	}
 
-	clickCount, err := h.store.GetClickCount(shortURL)
+	clickCount, err := h.store.GetClickCount(ctx, shortURL)
 	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -150,11 +379,21 @@ func (h *Handler) URLClickCounts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	visitors, err := h.store.GetUniqueVisitors(ctx, shortURL, time.Time{}, time.Time{})
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	tmpl := template.Must(template.ParseFiles(h.templateDir + "/url-click-counts.html"))
 
 	urlClickCounts := URLClickCounts{
-		ShortURL:   fullShortURL,
-		ClickCount: clickCount,
+		ShortURL:       fullShortURL,
+		ClickCount:     clickCount,
+		UniqueVisitors: visitors.Total,
 	}
 	err = tmpl.Execute(w, urlClickCounts)
 	if err != nil {
@@ -171,7 +410,22 @@ func (h *Handler) APIShorten(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var requestBody struct {
-		URL string `json:"url"`
+		URL       string `json:"url"`
+		Alias     string `json:"alias"`
+		ExpiresIn string `json:"expires_in"`
+		ExpiresAt string `json:"expires_at"`
+		MaxClicks int64  `json:"max_clicks"`
+		Password  string `json:"password"`
+
+		Title       string            `json:"title"`
+		Description string            `json:"description"`
+		Tags        []string          `json:"tags"`
+		Metadata    map[string]string `json:"metadata"`
+
+		// Dedupe returns an existing link to the same destination instead of creating one,
+		// looking only at links created with the same DedupeScope (an owner or API key)
+		Dedupe      bool   `json:"dedupe"`
+		DedupeScope string `json:"dedupe_scope"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
@@ -185,32 +439,95 @@ func (h *Handler) APIShorten(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !IsValidURL(url) {
-		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid URL"})
+	url, err := h.normalizer.Normalize(url)
+	if err != nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": invalidURLMessage(err)})
+		return
+	}
+	if err := h.policies.Check(url); err != nil {
+		h.respondWithPolicyViolation(w, err)
+		return
+	}
+	if threatType, listed := h.threats.Lookup(url); listed {
+		h.respondWithThreat(w, threatType)
+		return
+	}
+	if err := h.guard.Check(ctx, url); err != nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	expiresIn, expiresAt, err := parseExpiry(requestBody.ExpiresIn, requestBody.ExpiresAt)
+	if err != nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
 
-	shortURL, err := h.store.CreateShortURL(url)
+	manageToken, err := newManageToken()
 	if err != nil {
 		h.respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
 
+	opts := store.CreateOptions{
+		Alias:       requestBody.Alias,
+		ExpiresIn:   expiresIn,
+		ExpiresAt:   expiresAt,
+		MaxClicks:   requestBody.MaxClicks,
+		Password:    requestBody.Password,
+		ManageToken: manageToken,
+		Title:       requestBody.Title,
+		Description: requestBody.Description,
+		Tags:        requestBody.Tags,
+		Metadata:    requestBody.Metadata,
+		DedupeScope: requestBody.DedupeScope,
+	}
+
+	var shortURL string
+	created := true
+	if requestBody.Dedupe {
+		shortURL, created, err = h.store.CreateOrReuseShortURL(ctx, url, opts)
+	} else {
+		shortURL, err = h.store.CreateShortURL(ctx, url, opts)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		h.respondWithJSON(w, createErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
 	response := map[string]string{
 		"original_url": url,
 		"short_url":    shortURL,
+		"result":       "created",
+	}
+	// Only the creator of a link gets to manage it
+	if created {
+		response["manage_token"] = manageToken
+	} else {
+		response["result"] = "reused"
 	}
 
 	h.respondWithJSON(w, http.StatusOK, response)
+}
 
-	select {
-	case <-ctx.Done():
-		return
+// createErrorStatus maps a CreateShortURL error to the HTTP status reported to the caller
+func createErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrInvalidAlias), errors.Is(err, store.ErrInvalidExpiry), errors.Is(err, store.ErrInvalidMaxClicks),
+		errors.Is(err, store.ErrInvalidPassword), errors.Is(err, store.ErrInvalidTags), errors.Is(err, store.ErrInvalidMetadata),
+		errors.Is(err, store.ErrDedupeConflict):
+		return http.StatusBadRequest
+	case errors.Is(err, store.ErrAliasTaken):
+		return http.StatusConflict
 	default:
+		return http.StatusInternalServerError
 	}
 }
 
-func (h *Handler) respondWithJSON(w http.ResponseWriter, statusCode int, payload map[string]string) {
+func (h *Handler) respondWithJSON(w http.ResponseWriter, statusCode int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	if err := json.NewEncoder(w).Encode(payload); err != nil {
@@ -2,49 +2,203 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/yingtu35/ShortenMe/internal/config"
+	"github.com/yingtu35/ShortenMe/internal/store"
 )
 
 // mockStore implements the Store interface for testing
 type mockStore struct {
-	createShortURLFunc func(string) (string, error)
+	createShortURLFunc func(string, store.CreateOptions) (string, error)
 	getOriginalURLFunc func(string) (string, error)
 	getClickCountFunc  func(string) (int64, error)
+	getVisitorsFunc    func(string) (store.UniqueVisitors, error)
+	getURLDataFunc     func(string) (*store.URLData, error)
+	updateLinkFunc     func(string, store.LinkUpdate) error
+	setLinkStatusFunc  func(string, store.LinkStatus) error
+	restoreLinkFunc    func(string, time.Duration) error
+	deleteLinkFunc     func(string) error
+	getLinkHistoryFunc func(string) ([]store.DestinationChange, error)
+	listLinksFunc      func(store.ListOptions) (store.LinkPage, error)
+	createOrReuseFunc  func(string, store.CreateOptions) (string, bool, error)
+	searchLinksFunc    func(store.SearchOptions) ([]store.LinkRecord, error)
 	pingFunc           func() error
+
+	// lastCtx is the context passed to the most recent store call
+	lastCtx context.Context
+	// lastClick is the click event passed to the most recent FollowLink call
+	lastClick store.ClickEvent
 }
 
-func (m *mockStore) CreateShortURL(url string) (string, error) {
+func (m *mockStore) CreateShortURL(ctx context.Context, url string, opts store.CreateOptions) (string, error) {
+	m.lastCtx = ctx
 	if m.createShortURLFunc != nil {
-		return m.createShortURLFunc(url)
+		return m.createShortURLFunc(url, opts)
 	}
 	return "", errors.New("CreateShortURL not implemented")
 }
 
-func (m *mockStore) GetOriginalURL(shortURL string) (string, error) {
+func (m *mockStore) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
+	m.lastCtx = ctx
 	if m.getOriginalURLFunc != nil {
 		return m.getOriginalURLFunc(shortURL)
 	}
 	return "", errors.New("GetOriginalURL not implemented")
 }
 
-func (m *mockStore) GetClickCount(shortURL string) (int64, error) {
+// FollowLink resolves the link with getOriginalURLFunc, remembering the click event
+func (m *mockStore) FollowLink(ctx context.Context, shortURL string, click store.ClickEvent) (string, error) {
+	m.lastClick = click
+	return m.GetOriginalURL(ctx, shortURL)
+}
+
+func (m *mockStore) ListClickEvents(ctx context.Context, shortURL string, from, to time.Time) ([]store.ClickEvent, error) {
+	m.lastCtx = ctx
+	return nil, errors.New("ListClickEvents not implemented")
+}
+
+func (m *mockStore) CountClicks(ctx context.Context, shortURL string, from, to time.Time, size time.Duration) ([]store.ClickCount, error) {
+	m.lastCtx = ctx
+	return nil, errors.New("CountClicks not implemented")
+}
+
+func (m *mockStore) PurgeClickEvents(ctx context.Context, before time.Time) (int64, error) {
+	m.lastCtx = ctx
+	return 0, errors.New("PurgeClickEvents not implemented")
+}
+
+func (m *mockStore) GetUniqueVisitors(ctx context.Context, shortURL string, from, to time.Time) (store.UniqueVisitors, error) {
+	m.lastCtx = ctx
+	if m.getVisitorsFunc != nil {
+		return m.getVisitorsFunc(shortURL)
+	}
+	return store.UniqueVisitors{}, errors.New("GetUniqueVisitors not implemented")
+}
+
+func (m *mockStore) GetClickCount(ctx context.Context, shortURL string) (int64, error) {
+	m.lastCtx = ctx
 	if m.getClickCountFunc != nil {
 		return m.getClickCountFunc(shortURL)
 	}
 	return 0, errors.New("GetClickCount not implemented")
 }
 
-func (m *mockStore) Ping() error {
+func (m *mockStore) GetURLData(ctx context.Context, shortURL string) (*store.URLData, error) {
+	m.lastCtx = ctx
+	if m.getURLDataFunc != nil {
+		return m.getURLDataFunc(shortURL)
+	}
+	return nil, errors.New("GetURLData not implemented")
+}
+
+func (m *mockStore) UpdateLink(ctx context.Context, shortURL string, update store.LinkUpdate) error {
+	m.lastCtx = ctx
+	if m.updateLinkFunc != nil {
+		return m.updateLinkFunc(shortURL, update)
+	}
+	return errors.New("UpdateLink not implemented")
+}
+
+func (m *mockStore) SetLinkStatus(ctx context.Context, shortURL string, status store.LinkStatus) error {
+	m.lastCtx = ctx
+	if m.setLinkStatusFunc != nil {
+		return m.setLinkStatusFunc(shortURL, status)
+	}
+	return errors.New("SetLinkStatus not implemented")
+}
+
+func (m *mockStore) RestoreLink(ctx context.Context, shortURL string, retention time.Duration) error {
+	m.lastCtx = ctx
+	if m.restoreLinkFunc != nil {
+		return m.restoreLinkFunc(shortURL, retention)
+	}
+	return errors.New("RestoreLink not implemented")
+}
+
+func (m *mockStore) PurgeDeletedLinks(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	m.lastCtx = ctx
+	return 0, errors.New("PurgeDeletedLinks not implemented")
+}
+
+func (m *mockStore) GetPolicyDocument(ctx context.Context) (string, error) {
+	m.lastCtx = ctx
+	return "", errors.New("GetPolicyDocument not implemented")
+}
+
+func (m *mockStore) SavePolicyDocument(ctx context.Context, document string) error {
+	m.lastCtx = ctx
+	return errors.New("SavePolicyDocument not implemented")
+}
+
+func (m *mockStore) AddReport(ctx context.Context, shortURL string, report store.Report) (int64, error) {
+	m.lastCtx = ctx
+	return 0, errors.New("AddReport not implemented")
+}
+
+func (m *mockStore) ListReportedLinks(ctx context.Context, limit int) ([]store.ReportedLink, error) {
+	m.lastCtx = ctx
+	return nil, errors.New("ListReportedLinks not implemented")
+}
+
+func (m *mockStore) ClearReports(ctx context.Context, shortURL string) (int64, error) {
+	m.lastCtx = ctx
+	return 0, errors.New("ClearReports not implemented")
+}
+
+func (m *mockStore) DeleteLink(ctx context.Context, shortURL string) error {
+	m.lastCtx = ctx
+	if m.deleteLinkFunc != nil {
+		return m.deleteLinkFunc(shortURL)
+	}
+	return errors.New("DeleteLink not implemented")
+}
+
+func (m *mockStore) CreateOrReuseShortURL(ctx context.Context, url string, opts store.CreateOptions) (string, bool, error) {
+	m.lastCtx = ctx
+	if m.createOrReuseFunc != nil {
+		return m.createOrReuseFunc(url, opts)
+	}
+	return "", false, errors.New("CreateOrReuseShortURL not implemented")
+}
+
+func (m *mockStore) ListLinks(ctx context.Context, opts store.ListOptions) (store.LinkPage, error) {
+	m.lastCtx = ctx
+	if m.listLinksFunc != nil {
+		return m.listLinksFunc(opts)
+	}
+	return store.LinkPage{}, errors.New("ListLinks not implemented")
+}
+
+func (m *mockStore) SearchLinks(ctx context.Context, opts store.SearchOptions) ([]store.LinkRecord, error) {
+	m.lastCtx = ctx
+	if m.searchLinksFunc != nil {
+		return m.searchLinksFunc(opts)
+	}
+	return nil, errors.New("SearchLinks not implemented")
+}
+
+func (m *mockStore) GetLinkHistory(ctx context.Context, shortURL string) ([]store.DestinationChange, error) {
+	m.lastCtx = ctx
+	if m.getLinkHistoryFunc != nil {
+		return m.getLinkHistoryFunc(shortURL)
+	}
+	return nil, errors.New("GetLinkHistory not implemented")
+}
+
+func (m *mockStore) Ping(ctx context.Context) error {
+	m.lastCtx = ctx
 	if m.pingFunc != nil {
 		return m.pingFunc()
 	}
@@ -83,6 +237,20 @@ func getTemplateDir(t *testing.T) string {
 	return templateDir
 }
 
+// newTestServer builds a Handler over a fresh MemoryStore and an empty router for the test to
+// register the routes it exercises on. BaseURL defaults to http://localhost:8080.
+func newTestServer(t *testing.T, cfg config.Config) (*store.MemoryStore, *Handler, chi.Router) {
+	t.Helper()
+
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "http://localhost:8080"
+	}
+	memoryStore := store.NewMemoryStore()
+	handler := NewHandler(memoryStore, cfg, getTemplateDir(t))
+
+	return memoryStore, handler, chi.NewRouter()
+}
+
 func TestHome(t *testing.T) {
 	// Get template directory
 	templateDir := getTemplateDir(t)
@@ -186,7 +354,7 @@ func TestShorten(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create a mock store with the test case behavior
 			mockStore := &mockStore{
-				createShortURLFunc: func(url string) (string, error) {
+				createShortURLFunc: func(url string, opts store.CreateOptions) (string, error) {
 					return tt.mockShortURL, tt.mockError
 				},
 			}
@@ -257,6 +425,14 @@ func TestRedirect(t *testing.T) {
 			expectedStatus:   http.StatusOK,
 			expectedLocation: "",
 		},
+		{
+			name:             "internal store key",
+			shortURL:         "clickcounts:abc123",
+			mockOriginalURL:  "https://example.com",
+			mockError:        nil,
+			expectedStatus:   http.StatusOK,
+			expectedLocation: "",
+		},
 		{
 			name:             "store error",
 			shortURL:         "abc123",
@@ -265,12 +441,34 @@ func TestRedirect(t *testing.T) {
 			expectedStatus:   http.StatusInternalServerError,
 			expectedLocation: "",
 		},
+		{
+			name:             "expired URL",
+			shortURL:         "abc123",
+			mockOriginalURL:  "",
+			mockError:        store.ErrLinkExpired,
+			expectedStatus:   http.StatusGone,
+			expectedLocation: "",
+		},
+		{
+			name:             "click limit reached",
+			shortURL:         "abc123",
+			mockOriginalURL:  "",
+			mockError:        store.ErrClickLimitReached,
+			expectedStatus:   http.StatusGone,
+			expectedLocation: "",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create a mock store with the test case behavior
 			mockStore := &mockStore{
+				getURLDataFunc: func(shortURL string) (*store.URLData, error) {
+					if tt.mockOriginalURL == "" && tt.mockError == nil {
+						return nil, nil
+					}
+					return &store.URLData{OriginalURL: tt.mockOriginalURL}, nil
+				},
 				getOriginalURLFunc: func(shortURL string) (string, error) {
 					return tt.mockOriginalURL, tt.mockError
 				},
@@ -351,6 +549,8 @@ func TestURLClickCounts(t *testing.T) {
 			expectedContent: []string{
 				"Click Count",
 				"42",
+				"Unique Visitors",
+				"17",
 				"abc123",
 			},
 		},
@@ -384,6 +584,9 @@ func TestURLClickCounts(t *testing.T) {
 				getClickCountFunc: func(shortURL string) (int64, error) {
 					return tt.mockClickCount, tt.mockError
 				},
+				getVisitorsFunc: func(shortURL string) (store.UniqueVisitors, error) {
+					return store.UniqueVisitors{Total: 17}, nil
+				},
 			}
 
 			// Create a handler with mock store and config
@@ -483,7 +686,7 @@ func TestAPIShorten(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create a mock store with the test case behavior
 			mockStore := &mockStore{
-				createShortURLFunc: func(url string) (string, error) {
+				createShortURLFunc: func(url string, opts store.CreateOptions) (string, error) {
 					return tt.mockShortURL, tt.mockError
 				},
 			}
@@ -526,3 +729,504 @@ func TestAPIShorten(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlersPropagateRequestContext(t *testing.T) {
+	// Get template directory
+	templateDir := getTemplateDir(t)
+
+	// Create a test config
+	cfg := config.Config{
+		BaseURL: "http://localhost:8080",
+	}
+
+	type ctxKey struct{}
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		handler func(*Handler) http.HandlerFunc
+	}{
+		{
+			name:    "Shorten",
+			method:  "POST",
+			target:  "/shorten",
+			body:    "url=https://example.com",
+			handler: func(h *Handler) http.HandlerFunc { return h.Shorten },
+		},
+		{
+			name:    "APIShorten",
+			method:  "POST",
+			target:  "/api/shorten",
+			body:    `{"url":"https://example.com"}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.APIShorten },
+		},
+		{
+			name:    "URLClickCounts",
+			method:  "POST",
+			target:  "/click-counts",
+			body:    "shortURL=http://localhost:8080/abc123",
+			handler: func(h *Handler) http.HandlerFunc { return h.URLClickCounts },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every store call fails because the request has been cancelled
+			mockStore := &mockStore{
+				createShortURLFunc: func(string, store.CreateOptions) (string, error) { return "", context.Canceled },
+				getClickCountFunc:  func(string) (int64, error) { return 0, context.Canceled },
+			}
+			handler := NewHandler(mockStore, cfg, templateDir)
+
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, tt.name))
+			cancel()
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)).WithContext(ctx)
+			if strings.HasPrefix(tt.body, "{") {
+				req.Header.Set("Content-Type", "application/json")
+			} else {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			rr := httptest.NewRecorder()
+
+			tt.handler(handler)(rr, req)
+
+			if mockStore.lastCtx == nil || mockStore.lastCtx.Value(ctxKey{}) != tt.name {
+				t.Fatalf("store was not called with the request context")
+			}
+
+			// A cancelled request must not get an error page written to it
+			if rr.Body.Len() != 0 {
+				t.Errorf("handler wrote a response for a cancelled request: %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIShortenAlias(t *testing.T) {
+	// Get template directory
+	templateDir := getTemplateDir(t)
+
+	// Create a test config
+	cfg := config.Config{
+		BaseURL: "http://localhost:8080",
+	}
+
+	tests := []struct {
+		name           string
+		alias          string
+		mockError      error
+		expectedStatus int
+	}{
+		{
+			name:           "alias accepted",
+			alias:          "team-offsite",
+			mockError:      nil,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "alias taken",
+			alias:          "team-offsite",
+			mockError:      store.ErrAliasTaken,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "invalid alias",
+			alias:          "health",
+			mockError:      fmt.Errorf("%w: reserved", store.ErrInvalidAlias),
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAlias string
+			mockStore := &mockStore{
+				createShortURLFunc: func(url string, opts store.CreateOptions) (string, error) {
+					gotAlias = opts.Alias
+					if tt.mockError != nil {
+						return "", tt.mockError
+					}
+					return "http://localhost:8080/" + opts.Alias, nil
+				},
+			}
+			handler := NewHandler(mockStore, cfg, templateDir)
+
+			body, _ := json.Marshal(map[string]string{"url": "https://example.com", "alias": tt.alias})
+			req := httptest.NewRequest("POST", "/api/shorten", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			handler.APIShorten(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if gotAlias != tt.alias {
+				t.Errorf("store received alias %q, want %q", gotAlias, tt.alias)
+			}
+		})
+	}
+}
+
+func TestAPIShortenExpiry(t *testing.T) {
+	// Get template directory
+	templateDir := getTemplateDir(t)
+
+	// Create a test config
+	cfg := config.Config{
+		BaseURL: "http://localhost:8080",
+	}
+
+	tests := []struct {
+		name           string
+		body           map[string]string
+		mockError      error
+		expectedStatus int
+		expectedIn     time.Duration
+		expectedAt     time.Time
+	}{
+		{
+			name:           "duration",
+			body:           map[string]string{"url": "https://example.com", "expires_in": "24h"},
+			expectedStatus: http.StatusOK,
+			expectedIn:     24 * time.Hour,
+		},
+		{
+			name:           "timestamp",
+			body:           map[string]string{"url": "https://example.com", "expires_at": "2030-01-02T15:04:05Z"},
+			expectedStatus: http.StatusOK,
+			expectedAt:     time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC),
+		},
+		{
+			name:           "both set",
+			body:           map[string]string{"url": "https://example.com", "expires_in": "1h", "expires_at": "2030-01-02T15:04:05Z"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unparseable duration",
+			body:           map[string]string{"url": "https://example.com", "expires_in": "tomorrow"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "expiry in the past",
+			body:           map[string]string{"url": "https://example.com", "expires_at": "2000-01-01T00:00:00Z"},
+			mockError:      store.ErrInvalidExpiry,
+			expectedStatus: http.StatusBadRequest,
+			expectedAt:     time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotOpts store.CreateOptions
+			mockStore := &mockStore{
+				createShortURLFunc: func(url string, opts store.CreateOptions) (string, error) {
+					gotOpts = opts
+					return "http://localhost:8080/abc123", tt.mockError
+				},
+			}
+			handler := NewHandler(mockStore, cfg, templateDir)
+
+			body, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest("POST", "/api/shorten", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			handler.APIShorten(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if gotOpts.ExpiresIn != tt.expectedIn || !gotOpts.ExpiresAt.Equal(tt.expectedAt) {
+				t.Errorf("store received expiry %v / %v, want %v / %v",
+					gotOpts.ExpiresIn, gotOpts.ExpiresAt, tt.expectedIn, tt.expectedAt)
+			}
+		})
+	}
+}
+
+func TestAPIShortenMetadata(t *testing.T) {
+	// Get template directory
+	templateDir := getTemplateDir(t)
+
+	// Create a test config
+	cfg := config.Config{
+		BaseURL: "http://localhost:8080",
+	}
+
+	var gotOpts store.CreateOptions
+	mockStore := &mockStore{
+		createShortURLFunc: func(url string, opts store.CreateOptions) (string, error) {
+			gotOpts = opts
+			return "http://localhost:8080/abc123", nil
+		},
+	}
+	handler := NewHandler(mockStore, cfg, templateDir)
+
+	body := `{"url": "https://example.com", "title": "Spring sale", "description": "Landing page",
+		"tags": ["campaign", "team-a"], "metadata": {"owner": "growth"}}`
+	req := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	handler.APIShorten(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if gotOpts.Title != "Spring sale" || gotOpts.Description != "Landing page" ||
+		strings.Join(gotOpts.Tags, ",") != "campaign,team-a" || gotOpts.Metadata["owner"] != "growth" {
+		t.Errorf("store received %+v, want the title, description, tags and metadata", gotOpts)
+	}
+
+	// Validation failures from the store are the caller's fault
+	for _, storeErr := range []error{store.ErrInvalidTags, store.ErrInvalidMetadata} {
+		mockStore.createShortURLFunc = func(string, store.CreateOptions) (string, error) {
+			return "", fmt.Errorf("%w: too long", storeErr)
+		}
+		req := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		handler.APIShorten(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%v: got %v want %v", storeErr, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAPIShortenNormalizesURL(t *testing.T) {
+	// Get template directory
+	templateDir := getTemplateDir(t)
+
+	// Create a test config
+	cfg := config.Config{
+		BaseURL:          "http://localhost:8080",
+		StripQueryParams: []string{"utm_*"},
+	}
+
+	var gotURL string
+	mockStore := &mockStore{
+		createShortURLFunc: func(url string, opts store.CreateOptions) (string, error) {
+			gotURL = url
+			return "http://localhost:8080/abc123", nil
+		},
+	}
+	handler := NewHandler(mockStore, cfg, templateDir)
+
+	body := `{"url": "HTTPS://Example.com:443/a/../b?utm_source=mail&id=7"}`
+	req := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	handler.APIShorten(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if want := "https://example.com/b?id=7"; gotURL != want {
+		t.Errorf("store received %q, want %q", gotURL, want)
+	}
+
+	gotURL = ""
+	req = httptest.NewRequest("POST", "/api/shorten", strings.NewReader(`{"url": "javascript:alert(1)"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+
+	handler.APIShorten(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("javascript: URL: got %v want %v", status, http.StatusBadRequest)
+	}
+	if gotURL != "" {
+		t.Errorf("javascript: URL reached the store as %q", gotURL)
+	}
+}
+
+func TestAPIShortenRejectsShortLinkDestinations(t *testing.T) {
+	// Get template directory
+	templateDir := getTemplateDir(t)
+
+	// Create a test config
+	cfg := config.Config{
+		BaseURL:        "http://localhost:8080",
+		ShortenerHosts: []string{"bit.ly"},
+	}
+
+	called := false
+	mockStore := &mockStore{
+		createShortURLFunc: func(url string, opts store.CreateOptions) (string, error) {
+			called = true
+			return "http://localhost:8080/abc123", nil
+		},
+	}
+	handler := NewHandler(mockStore, cfg, templateDir)
+
+	for _, destination := range []string{"http://LOCALHOST:8080/abc123", "https://bit.ly/xyz"} {
+		body := `{"url": "` + destination + `"}`
+		req := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		handler.APIShorten(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%s: got %v want %v", destination, status, http.StatusBadRequest)
+		}
+	}
+	if called {
+		t.Error("a short link destination reached the store")
+	}
+}
+
+func TestAPIShortenDedupe(t *testing.T) {
+	// Get template directory
+	templateDir := getTemplateDir(t)
+
+	// Create a test config
+	cfg := config.Config{
+		BaseURL: "http://localhost:8080",
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		created        bool
+		mockError      error
+		expectedStatus int
+		expectedResult string
+	}{
+		{
+			name:           "new link",
+			body:           `{"url": "https://example.com", "dedupe": true, "dedupe_scope": "team-a"}`,
+			created:        true,
+			expectedStatus: http.StatusOK,
+			expectedResult: "created",
+		},
+		{
+			name:           "reused link",
+			body:           `{"url": "https://example.com", "dedupe": true, "dedupe_scope": "team-a"}`,
+			created:        false,
+			expectedStatus: http.StatusOK,
+			expectedResult: "reused",
+		},
+		{
+			name:           "combined with an alias",
+			body:           `{"url": "https://example.com", "dedupe": true, "alias": "mine"}`,
+			mockError:      store.ErrDedupeConflict,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotScope string
+			mockStore := &mockStore{
+				createOrReuseFunc: func(url string, opts store.CreateOptions) (string, bool, error) {
+					gotScope = opts.DedupeScope
+					if tt.mockError != nil {
+						return "", false, tt.mockError
+					}
+					return "http://localhost:8080/abc123", tt.created, nil
+				},
+			}
+			handler := NewHandler(mockStore, cfg, templateDir)
+
+			req := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			handler.APIShorten(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response map[string]string
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to parse response body: %v", err)
+			}
+			if response["result"] != tt.expectedResult {
+				t.Errorf("result = %q, want %q", response["result"], tt.expectedResult)
+			}
+			if _, hasToken := response["manage_token"]; hasToken != tt.created {
+				t.Errorf("manage_token present = %v, want %v", hasToken, tt.created)
+			}
+			if gotScope != "team-a" {
+				t.Errorf("store received scope %q, want team-a", gotScope)
+			}
+		})
+	}
+}
+
+func TestShortenMaxClicks(t *testing.T) {
+	// Get template directory
+	templateDir := getTemplateDir(t)
+
+	// Create a test config
+	cfg := config.Config{
+		BaseURL: "http://localhost:8080",
+	}
+
+	tests := []struct {
+		name           string
+		form           string
+		expectedStatus int
+		expectedMax    int64
+	}{
+		{
+			name:           "one-time link",
+			form:           "url=https://example.com&max_clicks=1",
+			expectedStatus: http.StatusOK,
+			expectedMax:    1,
+		},
+		{
+			name:           "unlimited by default",
+			form:           "url=https://example.com&max_clicks=",
+			expectedStatus: http.StatusOK,
+			expectedMax:    0,
+		},
+		{
+			name:           "not a number",
+			form:           "url=https://example.com&max_clicks=lots",
+			expectedStatus: http.StatusBadRequest,
+			expectedMax:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotOpts store.CreateOptions
+			mockStore := &mockStore{
+				createShortURLFunc: func(url string, opts store.CreateOptions) (string, error) {
+					gotOpts = opts
+					return "http://localhost:8080/abc123", nil
+				},
+			}
+			handler := NewHandler(mockStore, cfg, templateDir)
+
+			req := httptest.NewRequest("POST", "/shorten", bytes.NewBufferString(tt.form))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+
+			handler.Shorten(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if gotOpts.MaxClicks != tt.expectedMax {
+				t.Errorf("store received MaxClicks %v, want %v", gotOpts.MaxClicks, tt.expectedMax)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+// actorOwner is recorded in a link's history for changes made with its management token
+const actorOwner = "owner"
+
+// newManageToken returns a random secret that lets a link's creator edit or delete it later
+func newManageToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authorizeLink loads the link named in the URL and checks the request's management token.
+// It writes the error response itself and returns nil if the caller should stop.
+func (h *Handler) authorizeLink(w http.ResponseWriter, r *http.Request) *store.URLData {
+	ctx := r.Context()
+	code := r.PathValue("code")
+	if !store.ValidCode(code) {
+		h.respondWithJSON(w, http.StatusNotFound, map[string]string{"error": store.ErrLinkNotFound.Error()})
+		return nil
+	}
+
+	urlData, err := h.store.GetURLData(ctx, code)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		h.respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return nil
+	}
+	if urlData == nil {
+		h.respondWithJSON(w, http.StatusNotFound, map[string]string{"error": store.ErrLinkNotFound.Error()})
+		return nil
+	}
+
+	if !urlData.CheckManageToken(bearerToken(r)) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ShortenMe"`)
+		h.respondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or missing management token"})
+		return nil
+	}
+
+	return urlData
+}
+
+// UpdateLink changes the destination of a link or disables and re-enables it, given its management token
+func (h *Handler) UpdateLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := r.PathValue("code")
+
+	var requestBody struct {
+		URL    *string           `json:"url"`
+		Status *store.LinkStatus `json:"status"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if requestBody.URL == nil && requestBody.Status == nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Nothing to update"})
+		return
+	}
+	if requestBody.URL != nil {
+		normalized, err := h.normalizer.Normalize(*requestBody.URL)
+		if err != nil {
+			h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": invalidURLMessage(err)})
+			return
+		}
+		requestBody.URL = &normalized
+	}
+	if requestBody.Status != nil && *requestBody.Status != store.StatusActive && *requestBody.Status != store.StatusDisabled {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Status must be active or disabled"})
+		return
+	}
+
+	urlData := h.authorizeLink(w, r)
+	if urlData == nil {
+		return
+	}
+	if urlData.Status == store.StatusDeleted {
+		h.respondWithJSON(w, http.StatusGone, map[string]string{"error": "Link has been deleted; restore it first"})
+		return
+	}
+	if h.rejectSuspended(w, urlData) {
+		return
+	}
+
+	if requestBody.URL != nil {
+		if err := h.policies.Check(*requestBody.URL); err != nil {
+			h.respondWithPolicyViolation(w, err)
+			return
+		}
+		if threatType, listed := h.threats.Lookup(*requestBody.URL); listed {
+			h.respondWithThreat(w, threatType)
+			return
+		}
+		// Checked only once the caller is authorised, as it may make requests to the destination
+		if err := h.guard.Check(ctx, *requestBody.URL); err != nil {
+			h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		err := h.store.UpdateLink(ctx, code, store.LinkUpdate{
+			OriginalURL: requestBody.URL,
+			Actor:       actorOwner,
+		})
+		if err != nil {
+			h.respondWithStoreError(w, r, err)
+			return
+		}
+		urlData.OriginalURL = *requestBody.URL
+	}
+
+	if requestBody.Status != nil {
+		if err := h.store.SetLinkStatus(ctx, code, *requestBody.Status); err != nil {
+			h.respondWithStoreError(w, r, err)
+			return
+		}
+		urlData.Status = *requestBody.Status
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]any{
+		"short_url":    h.config.BaseURL + "/" + code,
+		"original_url": urlData.OriginalURL,
+		"status":       urlData.Status,
+	})
+}
+
+// rejectSuspended refuses to let an owner change a link moderation has suspended, answering
+// the request itself; it reports whether it did
+func (h *Handler) rejectSuspended(w http.ResponseWriter, urlData *store.URLData) bool {
+	if urlData.Status != store.StatusSuspended {
+		return false
+	}
+	h.respondWithJSON(w, http.StatusForbidden, map[string]string{"error": "Link has been suspended pending review"})
+	return true
+}
+
+// respondWithStoreError reports a failed store call on a management endpoint,
+// unless the client has already gone away
+func (h *Handler) respondWithStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		return
+	}
+	status := http.StatusInternalServerError
+	if errors.Is(err, store.ErrLinkNotFound) {
+		status = http.StatusNotFound
+	}
+	h.respondWithJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// LinkHistory lists every destination a link has had, given its management token.
+// With ?at=<RFC 3339 timestamp> it also reports the destination in effect at that moment.
+func (h *Handler) LinkHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := r.PathValue("code")
+
+	var at time.Time
+	if v := r.URL.Query().Get("at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid at timestamp"})
+			return
+		}
+		at = t
+	}
+
+	if urlData := h.authorizeLink(w, r); urlData == nil {
+		return
+	}
+
+	history, err := h.store.GetLinkHistory(ctx, code)
+	if err != nil {
+		h.respondWithStoreError(w, r, err)
+		return
+	}
+	if history == nil {
+		h.respondWithJSON(w, http.StatusNotFound, map[string]string{"error": store.ErrLinkNotFound.Error()})
+		return
+	}
+
+	response := map[string]any{
+		"short_url": h.config.BaseURL + "/" + code,
+		"history":   history,
+	}
+	if !at.IsZero() {
+		if change, ok := store.DestinationAt(history, at); ok {
+			response["destination_at"] = change
+		} else {
+			response["destination_at"] = nil
+		}
+	}
+
+	h.respondWithJSON(w, http.StatusOK, response)
+}
+
+// RollbackLink points a link back at the destination of an earlier history version, given its
+// management token. The rollback is itself recorded as a new history entry.
+func (h *Handler) RollbackLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := r.PathValue("code")
+
+	var requestBody struct {
+		Version int `json:"version"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	urlData := h.authorizeLink(w, r)
+	if urlData == nil {
+		return
+	}
+	if urlData.Status == store.StatusDeleted {
+		h.respondWithJSON(w, http.StatusGone, map[string]string{"error": "Link has been deleted; restore it first"})
+		return
+	}
+	if h.rejectSuspended(w, urlData) {
+		return
+	}
+
+	history, err := h.store.GetLinkHistory(ctx, code)
+	if err != nil {
+		h.respondWithStoreError(w, r, err)
+		return
+	}
+	if requestBody.Version < 1 || requestBody.Version > len(history) {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Unknown history version"})
+		return
+	}
+	target := history[requestBody.Version-1]
+
+	// An old destination must pass the checks a new one would, as it may have been denied since
+	if err := h.policies.Check(target.OriginalURL); err != nil {
+		h.respondWithPolicyViolation(w, err)
+		return
+	}
+	if threatType, listed := h.threats.Lookup(target.OriginalURL); listed {
+		h.respondWithThreat(w, threatType)
+		return
+	}
+	if err := h.guard.Check(ctx, target.OriginalURL); err != nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = h.store.UpdateLink(ctx, code, store.LinkUpdate{
+		OriginalURL: &target.OriginalURL,
+		Actor:       actorOwner,
+	})
+	if err != nil {
+		h.respondWithStoreError(w, r, err)
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]any{
+		"short_url":      h.config.BaseURL + "/" + code,
+		"original_url":   target.OriginalURL,
+		"rolled_back_to": target.Version,
+	})
+}
+
+// DeleteLink soft-deletes a link, given its management token. It stops redirecting at once
+// and can be restored until the retention period has passed.
+func (h *Handler) DeleteLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := r.PathValue("code")
+
+	urlData := h.authorizeLink(w, r)
+	if urlData == nil {
+		return
+	}
+	// Restoring it afterwards would lift the suspension
+	if h.rejectSuspended(w, urlData) {
+		return
+	}
+
+	// Deleting twice must not push the purge back
+	if urlData.Status != store.StatusDeleted {
+		if err := h.store.SetLinkStatus(ctx, code, store.StatusDeleted); err != nil {
+			h.respondWithStoreError(w, r, err)
+			return
+		}
+
+		// Read the deletion time back from the store, whose clock the purger goes by
+		var err error
+		urlData, err = h.store.GetURLData(ctx, code)
+		if err != nil {
+			h.respondWithStoreError(w, r, err)
+			return
+		}
+		if urlData == nil {
+			h.respondWithStoreError(w, r, store.ErrLinkNotFound)
+			return
+		}
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]any{
+		"short_url":        h.config.BaseURL + "/" + code,
+		"status":           store.StatusDeleted,
+		"restorable_until": urlData.DeletedAt.Add(h.config.DeletedLinkRetention),
+	})
+}
+
+// RestoreLink brings a deleted link back, given its management token, as long as it is still
+// within its retention period
+func (h *Handler) RestoreLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := r.PathValue("code")
+
+	urlData := h.authorizeLink(w, r)
+	if urlData == nil {
+		return
+	}
+
+	// The store checks the retention window against its own clock, the one the purger uses
+	err := h.store.RestoreLink(ctx, code, h.config.DeletedLinkRetention)
+	switch {
+	case errors.Is(err, store.ErrLinkNotDeleted):
+		h.respondWithJSON(w, http.StatusConflict, map[string]string{"error": "Link is not deleted"})
+		return
+	case errors.Is(err, store.ErrRestoreExpired):
+		h.respondWithJSON(w, http.StatusGone, map[string]string{"error": "Link can no longer be restored"})
+		return
+	case err != nil:
+		h.respondWithStoreError(w, r, err)
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]any{
+		"short_url":    h.config.BaseURL + "/" + code,
+		"original_url": urlData.OriginalURL,
+		"status":       store.StatusActive,
+	})
+}
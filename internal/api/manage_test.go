@@ -0,0 +1,458 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yingtu35/ShortenMe/internal/config"
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+// setupManagedLink creates a router over a memory store and shortens one link through the API,
+// returning its code and management token
+func setupManagedLink(t *testing.T) (*store.MemoryStore, http.Handler, string, string) {
+	t.Helper()
+
+	memoryStore, handler, r := newTestServer(t, config.Config{DeletedLinkRetention: time.Hour})
+	r.Post("/api/shorten", handler.APIShorten)
+	r.Patch("/api/links/{code}", handler.UpdateLink)
+	r.Delete("/api/links/{code}", handler.DeleteLink)
+	r.Post("/api/links/{code}/restore", handler.RestoreLink)
+	r.Get("/api/links/{code}/history", handler.LinkHistory)
+	r.Post("/api/links/{code}/rollback", handler.RollbackLink)
+	r.Get("/{shortURL}", handler.Redirect)
+
+	body := `{"url": "https://example.com/old", "alias": "managed"}`
+	req := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("APIShorten returned %v: %v", rr.Code, rr.Body.String())
+	}
+
+	var response map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if response["manage_token"] == "" {
+		t.Fatalf("APIShorten response has no manage_token: %v", response)
+	}
+
+	return memoryStore, r, "managed", response["manage_token"]
+}
+
+func manageRequest(r http.Handler, method, code, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/links/"+code, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestManageTokenIsStoredHashed(t *testing.T) {
+	memoryStore, _, code, token := setupManagedLink(t)
+
+	urlData, err := memoryStore.GetURLData(context.Background(), code)
+	if err != nil || urlData == nil {
+		t.Fatalf("GetURLData() = %v, %v", urlData, err)
+	}
+	if urlData.ManageTokenHash == token {
+		t.Error("management token was stored in plain text")
+	}
+	if !urlData.CheckManageToken(token) {
+		t.Error("stored hash does not match the returned token")
+	}
+}
+
+func TestShortenShowsManageToken(t *testing.T) {
+	var gotToken string
+	mockStore := &mockStore{
+		createShortURLFunc: func(url string, opts store.CreateOptions) (string, error) {
+			gotToken = opts.ManageToken
+			return "http://localhost:8080/abc123", nil
+		},
+	}
+	handler := NewHandler(mockStore, config.Config{BaseURL: "http://localhost:8080"}, getTemplateDir(t))
+
+	req := httptest.NewRequest("POST", "/shorten", strings.NewReader("url=https://example.com"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.Shorten(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if gotToken == "" {
+		t.Fatal("Shorten did not pass a management token to the store")
+	}
+	if !strings.Contains(rr.Body.String(), gotToken) {
+		t.Error("shorten.html does not show the management token")
+	}
+}
+
+func TestUpdateLink(t *testing.T) {
+	_, r, code, token := setupManagedLink(t)
+
+	tests := []struct {
+		name           string
+		code           string
+		token          string
+		body           string
+		expectedStatus int
+	}{
+		{"missing token", code, "", `{"url": "https://example.com/new"}`, http.StatusUnauthorized},
+		{"wrong token", code, "not-the-token", `{"url": "https://example.com/new"}`, http.StatusUnauthorized},
+		{"unknown code", "nonexistent", token, `{"url": "https://example.com/new"}`, http.StatusNotFound},
+		{"invalid URL", code, token, `{"url": "not a url"}`, http.StatusBadRequest},
+		{"empty update", code, token, `{}`, http.StatusBadRequest},
+		{"invalid body", code, token, `{`, http.StatusBadRequest},
+		{"change destination", code, token, `{"url": "https://example.com/new"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := manageRequest(r, "PATCH", tt.code, tt.token, tt.body)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v (%v)", rr.Code, tt.expectedStatus, rr.Body.String())
+			}
+		})
+	}
+
+	// The last case repointed the link
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/"+code, nil))
+	if location := rr.Header().Get("Location"); location != "https://example.com/new" {
+		t.Errorf("redirected to %q after update, want https://example.com/new", location)
+	}
+}
+
+func TestDisableLink(t *testing.T) {
+	_, r, code, token := setupManagedLink(t)
+
+	rr := manageRequest(r, "PATCH", code, token, `{"status": "disabled"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("disable returned %v: %v", rr.Code, rr.Body.String())
+	}
+	var response map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if response["status"] != "disabled" || response["original_url"] != "https://example.com/old" {
+		t.Errorf("unexpected response body: %v", response)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/"+code, nil))
+	if rr.Code != http.StatusGone {
+		t.Errorf("disabled link returned %v, want %v", rr.Code, http.StatusGone)
+	}
+	if !strings.Contains(rr.Body.String(), "disabled") {
+		t.Error("disabled link page does not say the link was disabled")
+	}
+
+	if rr := manageRequest(r, "PATCH", code, token, `{"status": "deleted"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("PATCH to deleted returned %v, want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	if rr := manageRequest(r, "PATCH", code, token, `{"status": "active"}`); rr.Code != http.StatusOK {
+		t.Fatalf("enable returned %v: %v", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/"+code, nil))
+	if rr.Code != http.StatusFound {
+		t.Errorf("re-enabled link returned %v, want %v", rr.Code, http.StatusFound)
+	}
+}
+
+func TestDeleteAndRestoreLink(t *testing.T) {
+	memoryStore, r, code, token := setupManagedLink(t)
+
+	if rr := manageRequest(r, "DELETE", code, "not-the-token", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("delete with wrong token returned %v, want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := manageRequest(r, "POST", code+"/restore", token, ""); rr.Code != http.StatusConflict {
+		t.Errorf("restore of an active link returned %v, want %v", rr.Code, http.StatusConflict)
+	}
+
+	rr := manageRequest(r, "DELETE", code, token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("delete returned %v, want %v", rr.Code, http.StatusOK)
+	}
+	var response struct {
+		Status          store.LinkStatus `json:"status"`
+		RestorableUntil time.Time        `json:"restorable_until"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if response.Status != store.StatusDeleted {
+		t.Errorf("delete response status = %q, want deleted", response.Status)
+	}
+
+	// The link is kept but no longer redirects
+	urlData, err := memoryStore.GetURLData(context.Background(), code)
+	if err != nil || urlData == nil || urlData.Status != store.StatusDeleted {
+		t.Fatalf("GetURLData() after delete = %+v, %v, want a deleted link", urlData, err)
+	}
+	if want := urlData.DeletedAt.Add(time.Hour); !response.RestorableUntil.Equal(want) {
+		t.Errorf("restorable_until = %v, want %v", response.RestorableUntil, want)
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/"+code, nil))
+	if rr.Code != http.StatusGone || !strings.Contains(rr.Body.String(), "deleted") {
+		t.Errorf("deleted link returned %v, want %v with the unavailable page", rr.Code, http.StatusGone)
+	}
+
+	// Deleted links cannot be edited until restored, and deleting again keeps the original deadline
+	if rr := manageRequest(r, "PATCH", code, token, `{"url": "https://example.com/new"}`); rr.Code != http.StatusGone {
+		t.Errorf("update of a deleted link returned %v, want %v", rr.Code, http.StatusGone)
+	}
+	if rr := manageRequest(r, "DELETE", code, token, ""); rr.Code != http.StatusOK {
+		t.Errorf("second delete returned %v, want %v", rr.Code, http.StatusOK)
+	}
+	if again, _ := memoryStore.GetURLData(context.Background(), code); again == nil || !again.DeletedAt.Equal(urlData.DeletedAt) {
+		t.Error("second delete moved the deletion time")
+	}
+
+	if rr := manageRequest(r, "POST", code+"/restore", token, ""); rr.Code != http.StatusOK {
+		t.Fatalf("restore returned %v: %v", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/"+code, nil))
+	if rr.Code != http.StatusFound {
+		t.Errorf("restored link returned %v, want %v", rr.Code, http.StatusFound)
+	}
+}
+
+func TestRestoreAfterRetention(t *testing.T) {
+	urlData := store.URLData{
+		OriginalURL: "https://example.com",
+		Status:      store.StatusDeleted,
+		DeletedAt:   time.Now().Add(-2 * time.Hour),
+	}
+	memoryStore := store.NewMemoryStore()
+	if _, err := memoryStore.CreateShortURL(context.Background(), "https://example.com", store.CreateOptions{Alias: "abc", ManageToken: "token"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	managed, err := memoryStore.GetURLData(context.Background(), "abc")
+	if err != nil || managed == nil {
+		t.Fatalf("GetURLData() = %v, %v", managed, err)
+	}
+	urlData.ManageTokenHash = managed.ManageTokenHash
+
+	mockStore := &mockStore{
+		getURLDataFunc: func(string) (*store.URLData, error) {
+			return &urlData, nil
+		},
+		restoreLinkFunc: func(_ string, retention time.Duration) error {
+			if retention != time.Hour {
+				t.Errorf("RestoreLink() retention = %v, want %v", retention, time.Hour)
+			}
+			return store.ErrRestoreExpired
+		},
+	}
+	handler := NewHandler(mockStore, config.Config{DeletedLinkRetention: time.Hour}, getTemplateDir(t))
+
+	req := httptest.NewRequest("POST", "/api/links/abc/restore", nil)
+	req.SetPathValue("code", "abc")
+	req.Header.Set("Authorization", "Bearer token")
+	rr := httptest.NewRecorder()
+	handler.RestoreLink(rr, req)
+	if rr.Code != http.StatusGone {
+		t.Errorf("restore after retention returned %v, want %v", rr.Code, http.StatusGone)
+	}
+}
+
+func TestUpdateLinkStoreError(t *testing.T) {
+	urlData := store.URLData{OriginalURL: "https://example.com"}
+	mockStore := &mockStore{
+		getURLDataFunc: func(string) (*store.URLData, error) {
+			return &urlData, nil
+		},
+		updateLinkFunc: func(string, store.LinkUpdate) error {
+			return errors.New("store error")
+		},
+	}
+	handler := NewHandler(mockStore, config.Config{}, getTemplateDir(t))
+
+	// A link without a stored token hash can never be managed
+	req := httptest.NewRequest("PATCH", "/api/links/abc", bytes.NewBufferString(`{"url": "https://example.com/new"}`))
+	req.SetPathValue("code", "abc")
+	req.Header.Set("Authorization", "Bearer anything")
+	rr := httptest.NewRecorder()
+	handler.UpdateLink(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("unmanaged link returned %v, want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// Borrow a real token hash from a memory store
+	memoryStore := store.NewMemoryStore()
+	if _, err := memoryStore.CreateShortURL(context.Background(), "https://example.com", store.CreateOptions{Alias: "abc", ManageToken: "token"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	managed, err := memoryStore.GetURLData(context.Background(), "abc")
+	if err != nil || managed == nil {
+		t.Fatalf("GetURLData() = %v, %v", managed, err)
+	}
+	urlData.ManageTokenHash = managed.ManageTokenHash
+	req = httptest.NewRequest("PATCH", "/api/links/abc", bytes.NewBufferString(`{"url": "https://example.com/new"}`))
+	req.SetPathValue("code", "abc")
+	req.Header.Set("Authorization", "Bearer token")
+	rr = httptest.NewRecorder()
+	handler.UpdateLink(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("store error returned %v, want %v", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestLinkHistoryAndRollback(t *testing.T) {
+	_, r, code, token := setupManagedLink(t)
+
+	if rr := manageRequest(r, "PATCH", code, token, `{"url": "https://example.com/new"}`); rr.Code != http.StatusOK {
+		t.Fatalf("update returned %v: %v", rr.Code, rr.Body.String())
+	}
+
+	// History needs the management token too
+	req := httptest.NewRequest("GET", "/api/links/"+code+"/history", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("history without token returned %v, want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	history := fetchHistory(t, r, code, token, "")
+	if len(history.History) != 2 {
+		t.Fatalf("history has %d entries, want 2: %+v", len(history.History), history.History)
+	}
+	first, second := history.History[0], history.History[1]
+	if first.Version != 1 || first.OriginalURL != "https://example.com/old" || first.Actor != store.ActorCreator {
+		t.Errorf("history[0] = %+v, want the original destination by the creator", first)
+	}
+	if second.Version != 2 || second.OriginalURL != "https://example.com/new" || second.Actor != actorOwner {
+		t.Errorf("history[1] = %+v, want the new destination by the owner", second)
+	}
+
+	// The destination in effect at a past moment can be looked up
+	at := first.ChangedAt.Add(-time.Second).Format(time.RFC3339)
+	if got := fetchHistory(t, r, code, token, at).DestinationAt; got != nil {
+		t.Errorf("destination_at before creation = %+v, want null", got)
+	}
+
+	// Rolling back to version 1 restores the old destination as a new entry
+	req = httptest.NewRequest("POST", "/api/links/"+code+"/rollback", strings.NewReader(`{"version": 1}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("rollback returned %v: %v", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/"+code, nil))
+	if location := rr.Header().Get("Location"); location != "https://example.com/old" {
+		t.Errorf("redirected to %q after rollback, want https://example.com/old", location)
+	}
+
+	history = fetchHistory(t, r, code, token, "")
+	if len(history.History) != 3 || history.History[2].OriginalURL != "https://example.com/old" {
+		t.Errorf("history after rollback = %+v, want a third entry for the old destination", history.History)
+	}
+
+	for _, body := range []string{`{"version": 0}`, `{"version": 4}`, `{`} {
+		req = httptest.NewRequest("POST", "/api/links/"+code+"/rollback", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("rollback with %s returned %v, want %v", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// setupRolledBackLink creates the link "managed", with management token "token", whose destination
+// moved from oldURL to a new one, and a router serving rollbacks
+func setupRolledBackLink(t *testing.T, cfg config.Config, oldURL string) (*store.MemoryStore, *Handler, http.Handler) {
+	t.Helper()
+
+	memoryStore, handler, r := newTestServer(t, cfg)
+	r.Post("/api/links/{code}/rollback", handler.RollbackLink)
+
+	ctx := context.Background()
+	if _, err := memoryStore.CreateShortURL(ctx, oldURL, store.CreateOptions{Alias: "managed", ManageToken: "token"}); err != nil {
+		t.Fatal(err)
+	}
+	newURL := "https://example.com/new"
+	if err := memoryStore.UpdateLink(ctx, "managed", store.LinkUpdate{OriginalURL: &newURL, Actor: actorOwner}); err != nil {
+		t.Fatal(err)
+	}
+
+	return memoryStore, handler, r
+}
+
+func rollbackRequest(r http.Handler, code, token string, version int) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/links/"+code+"/rollback", strings.NewReader(fmt.Sprintf(`{"version": %d}`, version)))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRollbackChecksPolicies(t *testing.T) {
+	memoryStore, handler, r := setupRolledBackLink(t, config.Config{}, "https://old.example/")
+
+	// The old destination's host is denied after the link moved away from it
+	ctx := context.Background()
+	if err := memoryStore.SavePolicyDocument(ctx, `{"policies": [{"name": "abuse", "action": "deny", "rules": ["old.example"]}]}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.Policies().Reload(ctx); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	rr := rollbackRequest(r, "managed", "token", 1)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("rollback to a denied destination returned %v, want %v: %s", rr.Code, http.StatusForbidden, rr.Body.String())
+	}
+	if urlData, err := memoryStore.GetURLData(ctx, "managed"); err != nil || urlData.OriginalURL != "https://example.com/new" {
+		t.Errorf("destination after rejected rollback = %v, %v; want https://example.com/new", urlData, err)
+	}
+}
+
+type historyResponse struct {
+	History       []store.DestinationChange `json:"history"`
+	DestinationAt *store.DestinationChange  `json:"destination_at"`
+}
+
+func fetchHistory(t *testing.T, r http.Handler, code, token, at string) historyResponse {
+	t.Helper()
+
+	target := "/api/links/" + code + "/history"
+	if at != "" {
+		target += "?at=" + at
+	}
+	req := httptest.NewRequest("GET", target, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("history returned %v: %v", rr.Code, rr.Body.String())
+	}
+
+	var response historyResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	return response
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	// ErrInvalidURL is returned for destinations that are not absolute URLs with a host
+	ErrInvalidURL = errors.New("invalid URL")
+	// ErrUnsupportedScheme is returned for destinations that are not http or https, such as javascript: or data:
+	ErrUnsupportedScheme = errors.New("only http and https URLs are allowed")
+)
+
+// defaultPorts are the ports implied by each allowed scheme
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// URLNormalizer turns destination URLs into one canonical form before they are stored,
+// so that equivalent spellings of a URL are treated as the same destination
+type URLNormalizer struct {
+	// StripParams are query parameters removed from every URL, compared case-insensitively.
+	// A trailing '*' matches any parameter starting with the rest, as in "utm_*".
+	StripParams []string
+	// SortParams orders the remaining query parameters by name
+	SortParams bool
+}
+
+// Normalize validates rawURL and returns its canonical form: scheme and host lowercased,
+// IDN hosts in punycode, default ports dropped, dot segments resolved and the query
+// cleaned up as configured
+func (n URLNormalizer) Normalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Scheme == "" {
+		return "", ErrInvalidURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[u.Scheme]; !ok {
+		return "", ErrUnsupportedScheme
+	}
+	if u.Opaque != "" || u.Hostname() == "" {
+		return "", ErrInvalidURL
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", ErrInvalidURL
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+
+	escapedPath := removeDotSegments(u.EscapedPath())
+	if u.Path, err = url.PathUnescape(escapedPath); err != nil {
+		return "", ErrInvalidURL
+	}
+	u.RawPath = escapedPath
+
+	u.RawQuery = n.normalizeQuery(u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// normalizeHost lowercases a host and converts internationalized names to punycode.
+// ASCII hosts are only lowercased, so unusual but working names such as ones with
+// underscores are left alone.
+func normalizeHost(host string) (string, error) {
+	if !isASCII(host) {
+		return idna.Lookup.ToASCII(host)
+	}
+	return strings.ToLower(host), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// removeDotSegments resolves "." and ".." in an absolute or empty path as described in
+// RFC 3986 section 5.2.4
+func removeDotSegments(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+		case "..":
+			// out[0] is the empty segment before the leading slash and is never removed
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, segment)
+			continue
+		}
+		// A trailing "." or ".." still names a directory
+		if last {
+			out = append(out, "")
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+// normalizeQuery drops stripped parameters and, if configured, sorts the rest by name.
+// Parameters keep their original encoding, and repeated names keep their relative order.
+func (n URLNormalizer) normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	type param struct{ name, raw string }
+	var params []param
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(raw, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if n.strips(name) {
+			continue
+		}
+		params = append(params, param{name: name, raw: raw})
+	}
+
+	if n.SortParams {
+		sort.SliceStable(params, func(i, j int) bool {
+			return params[i].name < params[j].name
+		})
+	}
+
+	raws := make([]string, len(params))
+	for i, p := range params {
+		raws[i] = p.raw
+	}
+	return strings.Join(raws, "&")
+}
+
+// strips reports whether the query parameter name matches one of StripParams
+func (n URLNormalizer) strips(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range n.StripParams {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidURLMessage is what users are told when Normalize rejects their URL
+func invalidURLMessage(err error) string {
+	if errors.Is(err, ErrUnsupportedScheme) {
+		return "Only http and https URLs can be shortened"
+	}
+	return "Invalid URL"
+}
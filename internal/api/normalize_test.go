@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"already canonical", "https://example.com/path?q=1#top", "https://example.com/path?q=1#top"},
+		{"bare host", "https://example.com", "https://example.com"},
+		{"surrounding whitespace", "  https://example.com/a  ", "https://example.com/a"},
+		{"scheme and host case", "HTTPS://WWW.Example.COM/Path", "https://www.example.com/Path"},
+		{"default http port", "http://example.com:80/a", "http://example.com/a"},
+		{"default https port", "https://example.com:443/a", "https://example.com/a"},
+		{"other port kept", "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"default port of the other scheme kept", "http://example.com:443/a", "http://example.com:443/a"},
+		{"dot segments", "https://example.com/a/./b/../c", "https://example.com/a/c"},
+		{"leading dot-dot", "https://example.com/../a", "https://example.com/a"},
+		{"trailing dot-dot", "https://example.com/a/b/..", "https://example.com/a/"},
+		{"encoding kept", "https://example.com/a%2Fb/c%20d", "https://example.com/a%2Fb/c%20d"},
+		{"idn host", "https://Bücher.example/buch", "https://xn--bcher-kva.example/buch"},
+		{"ipv6 host", "http://[2001:DB8::1]:80/", "http://[2001:db8::1]/"},
+		{"empty query dropped", "https://example.com/a?", "https://example.com/a"},
+		{"query order kept", "https://example.com/?b=2&a=1", "https://example.com/?b=2&a=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := URLNormalizer{}.Normalize(tt.input)
+			if err != nil {
+				t.Fatalf("Normalize(%q) error = %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeQueryParams(t *testing.T) {
+	normalizer := URLNormalizer{
+		StripParams: []string{"utm_*", "FBCLID"},
+		SortParams:  true,
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"https://example.com/?utm_source=mail&utm_medium=email", "https://example.com/"},
+		{"https://example.com/?z=1&utm_campaign=x&a=2&fbclid=abc", "https://example.com/?a=2&z=1"},
+		{"https://example.com/?UTM_Source=x&b=1", "https://example.com/?b=1"},
+		{"https://example.com/?b=2&a=1&b=1", "https://example.com/?a=1&b=2&b=1"},
+		{"https://example.com/?q=a%20b&p=%26", "https://example.com/?p=%26&q=a%20b"},
+		{"https://example.com/?utm=keep", "https://example.com/?utm=keep"},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizer.Normalize(tt.input)
+		if err != nil {
+			t.Fatalf("Normalize(%q) error = %v", tt.input, err)
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeRejects(t *testing.T) {
+	tests := []struct {
+		input string
+		want  error
+	}{
+		{"invalid-url", ErrInvalidURL},
+		{"", ErrInvalidURL},
+		{"/relative/path", ErrInvalidURL},
+		{"https://", ErrInvalidURL},
+		{"http://exa mple.com", ErrInvalidURL},
+		{"javascript:alert(1)", ErrUnsupportedScheme},
+		{"JavaScript://example.com/%0Aalert(1)", ErrUnsupportedScheme},
+		{"data:text/html;base64,PHNjcmlwdD4=", ErrUnsupportedScheme},
+		{"ftp://example.com/file", ErrUnsupportedScheme},
+		{"file:///etc/passwd", ErrUnsupportedScheme},
+	}
+
+	for _, tt := range tests {
+		if got, err := (URLNormalizer{}).Normalize(tt.input); !errors.Is(err, tt.want) {
+			t.Errorf("Normalize(%q) = %q, %v; want error %v", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestIsValidURL(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"https://example.com/path", true},
+		{"HTTP://Example.com:80", true},
+		{"example.com", false},
+		{"ftp://example.com/file", false},
+		{"https://", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsValidURL(tt.input); got != tt.want {
+			t.Errorf("IsValidURL(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/yingtu35/ShortenMe/internal/config"
+	"github.com/yingtu35/ShortenMe/internal/policy"
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+// maxPolicyDocumentSize bounds the policy document the admin API accepts
+const maxPolicyDocumentSize = 1 << 20
+
+// newPolicySource reads policies from the configured file, or else from the store
+func newPolicySource(cfg config.Config, s store.Store) policy.Source {
+	if cfg.PolicyFile != "" {
+		return policy.FileSource(cfg.PolicyFile)
+	}
+	return policy.StoreSource{Store: s}
+}
+
+// Policies returns the engine enforcing destination policies, so that it can be loaded and kept up to date
+func (h *Handler) Policies() *policy.Engine {
+	return h.policies
+}
+
+// respondWithPolicyViolation reports a destination rejected by a policy, naming the policy
+func (h *Handler) respondWithPolicyViolation(w http.ResponseWriter, err error) {
+	var violation *policy.Violation
+	if !errors.As(err, &violation) {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": invalidURLMessage(err)})
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusForbidden, map[string]any{
+		"error":     violation.Error(),
+		"violation": violation,
+	})
+}
+
+// GetPolicy returns the destination policy document kept in the store
+func (h *Handler) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	if _, fromFile := h.policies.Source().(policy.FileSource); fromFile {
+		h.respondWithJSON(w, http.StatusConflict, map[string]string{"error": "Policies are loaded from POLICY_FILE"})
+		return
+	}
+
+	document, err := h.store.GetPolicyDocument(r.Context())
+	if err != nil {
+		h.respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if document == "" {
+		document = `{"policies":[]}`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := io.WriteString(w, document); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// PutPolicy replaces the destination policy document kept in the store and starts enforcing it
+func (h *Handler) PutPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if _, fromFile := h.policies.Source().(policy.FileSource); fromFile {
+		h.respondWithJSON(w, http.StatusConflict, map[string]string{"error": "Policies are loaded from POLICY_FILE"})
+		return
+	}
+
+	document, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPolicyDocumentSize))
+	if err != nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if _, err := policy.Parse(document); err != nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.SavePolicyDocument(ctx, string(document)); err != nil {
+		h.respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := h.policies.Reload(ctx); err != nil {
+		h.respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
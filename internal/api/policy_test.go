@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yingtu35/ShortenMe/internal/config"
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+func TestPolicyAPI(t *testing.T) {
+	cfg := config.Config{
+		BaseURL:    "http://localhost:8080",
+		AdminToken: testAdminToken,
+	}
+	handler := NewHandler(store.NewMemoryStore(), cfg, getTemplateDir(t))
+
+	r := chi.NewRouter()
+	r.With(handler.RequireAdmin).Get("/api/policy", handler.GetPolicy)
+	r.With(handler.RequireAdmin).Put("/api/policy", handler.PutPolicy)
+	r.Post("/api/shorten", handler.APIShorten)
+
+	send := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send("PUT", "/api/policy", `{"policies": [{"name": "a", "action": "block"}]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid document: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	document := `{"policies": [{"name": "internal-only", "action": "allow", "rules": ["*.corp.example"]}]}`
+	if rr := send("PUT", "/api/policy", document); rr.Code != http.StatusNoContent {
+		t.Fatalf("PUT /api/policy: got %v want %v: %s", rr.Code, http.StatusNoContent, rr.Body.String())
+	}
+	if rr := send("GET", "/api/policy", ""); rr.Body.String() != document {
+		t.Errorf("GET /api/policy = %s, want %s", rr.Body.String(), document)
+	}
+
+	// The saved policy applies straight away
+	rr := send("POST", "/api/shorten", `{"url": "https://example.com/"}`)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("outside the allowlist: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	var response struct {
+		Error     string `json:"error"`
+		Violation struct {
+			Policy string `json:"policy"`
+			Action string `json:"action"`
+			Host   string `json:"host"`
+		} `json:"violation"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Violation.Policy != "internal-only" || response.Violation.Action != "allow" || response.Violation.Host != "example.com" {
+		t.Errorf("violation = %+v, want internal-only allow policy for example.com", response.Violation)
+	}
+
+	if rr := send("POST", "/api/shorten", `{"url": "https://wiki.corp.example/"}`); rr.Code != http.StatusOK {
+		t.Errorf("inside the allowlist: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+}
+
+func TestPolicyAPIWithPolicyFile(t *testing.T) {
+	cfg := config.Config{
+		BaseURL:    "http://localhost:8080",
+		AdminToken: testAdminToken,
+		PolicyFile: "policy.json",
+	}
+	handler := NewHandler(store.NewMemoryStore(), cfg, getTemplateDir(t))
+
+	req := httptest.NewRequest("PUT", "/api/policy", strings.NewReader(`{"policies": []}`))
+	rr := httptest.NewRecorder()
+	handler.PutPolicy(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("got %v want %v", rr.Code, http.StatusConflict)
+	}
+}
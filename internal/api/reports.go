@@ -0,0 +1,259 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/httprate"
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+// maxReportDetails caps the free text a visitor can add to a report
+const maxReportDetails = 1000
+
+// ReportReason is one of the reasons a visitor can pick when reporting a link
+type ReportReason struct {
+	Value string
+	Label string
+}
+
+// reportReasons are the reasons offered on the report form, in order
+var reportReasons = []ReportReason{
+	{"phishing", "Phishing or scam"},
+	{"malware", "Malware or unwanted software"},
+	{"spam", "Spam"},
+	{"other", "Something else"},
+}
+
+// ReportForm is the page visitors report a link from
+type ReportForm struct {
+	ShortURL  string
+	Reasons   []ReportReason
+	Submitted bool
+	Error     string
+}
+
+// ReportedLinkSummary is how a link in the moderation queue is shown to admins
+type ReportedLinkSummary struct {
+	Code        string           `json:"code"`
+	ShortURL    string           `json:"short_url"`
+	OriginalURL string           `json:"original_url,omitempty"`
+	Status      store.LinkStatus `json:"status,omitempty"`
+	Reports     []store.Report   `json:"reports"`
+}
+
+func validReportReason(reason string) bool {
+	for _, r := range reportReasons {
+		if r.Value == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// reporterID identifies the network a request comes from by a keyed hash of its /24 or /48
+// prefix, so repeated reports can be told apart without storing addresses. A single client
+// can hold a whole IPv6 prefix, so rotating addresses within it does not make it a new reporter.
+func (h *Handler) reporterID(r *http.Request) (string, error) {
+	ip, err := httprate.KeyByIP(r)
+	if err != nil {
+		return "", err
+	}
+	if prefix := anonymizeIP(ip); prefix != "" {
+		ip = prefix
+	}
+	mac := hmac.New(sha256.New, h.unlockSecret)
+	mac.Write([]byte("report|" + ip))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+func (h *Handler) renderReportForm(w http.ResponseWriter, status int, form ReportForm) {
+	form.Reasons = reportReasons
+	w.WriteHeader(status)
+	tmpl := template.Must(template.ParseFiles(h.templateDir + "/report.html"))
+	err := tmpl.Execute(w, form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ReportForm serves the form for reporting a link as malicious
+func (h *Handler) ReportForm(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if !store.ValidCode(code) {
+		w.WriteHeader(http.StatusNotFound)
+		h.renderNotFound(w, code)
+		return
+	}
+	h.renderReportForm(w, http.StatusOK, ReportForm{ShortURL: code})
+}
+
+// SubmitReport adds a visitor's report to the moderation queue. A link reported by as
+// many visitors as the configured threshold is suspended until an admin reviews it.
+func (h *Handler) SubmitReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := r.PathValue("code")
+	if !store.ValidCode(code) {
+		w.WriteHeader(http.StatusNotFound)
+		h.renderNotFound(w, code)
+		return
+	}
+
+	reason := r.PostFormValue("reason")
+	details := strings.TrimSpace(r.PostFormValue("details"))
+	if !validReportReason(reason) {
+		h.renderReportForm(w, http.StatusBadRequest, ReportForm{ShortURL: code, Error: "Please choose a reason."})
+		return
+	}
+	if !utf8.ValidString(details) || utf8.RuneCountInString(details) > maxReportDetails {
+		h.renderReportForm(w, http.StatusBadRequest, ReportForm{ShortURL: code, Error: "Please keep the details under 1000 characters."})
+		return
+	}
+
+	reporter, err := h.reporterID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	open, err := h.store.AddReport(ctx, code, store.Report{Reason: reason, Details: details, Reporter: reporter})
+	if errors.Is(err, store.ErrLinkNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		tmpl := template.Must(template.ParseFiles(h.templateDir + "/not-found.html"))
+		err = tmpl.Execute(w, NotFound{ShortURL: code})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if threshold := int64(h.config.ReportThreshold); threshold > 0 && open >= threshold {
+		h.suspendReportedLink(r, code, open)
+	}
+
+	h.renderReportForm(w, http.StatusOK, ReportForm{ShortURL: code, Submitted: true})
+}
+
+// suspendReportedLink takes down an active link that has reached the report threshold.
+// Links their owner has already disabled or deleted are left as they are.
+func (h *Handler) suspendReportedLink(r *http.Request, code string, open int64) {
+	ctx := r.Context()
+
+	urlData, err := h.store.GetURLData(ctx, code)
+	if err != nil || urlData == nil || !urlData.IsActive() {
+		return
+	}
+	if err := h.store.SetLinkStatus(ctx, code, store.StatusSuspended); err != nil {
+		log.Printf("Failed to suspend %s after %d reports: %v", code, open, err)
+		return
+	}
+	log.Printf("Suspended %s pending review after %d reports", code, open)
+}
+
+// ListReports returns the moderation queue: reported links with their open reports, those waiting longest first
+func (h *Handler) ListReports(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	limit, err := parseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	reported, err := h.store.ListReportedLinks(ctx, limit)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		h.respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	links := make([]ReportedLinkSummary, 0, len(reported))
+	for _, link := range reported {
+		summary := ReportedLinkSummary{
+			Code:     link.Code,
+			ShortURL: h.config.BaseURL + "/" + link.Code,
+			Reports:  link.Reports,
+		}
+		urlData, err := h.store.GetURLData(ctx, link.Code)
+		if err != nil {
+			h.respondWithStoreError(w, r, err)
+			return
+		}
+		if urlData != nil {
+			summary.OriginalURL = urlData.OriginalURL
+			summary.Status = urlData.Status
+		}
+		links = append(links, summary)
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]any{"links": links})
+}
+
+// DismissReports clears a link's reports as unfounded and lifts its suspension, if any
+func (h *Handler) DismissReports(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, store.StatusActive)
+}
+
+// DisableReportedLink clears a link's reports and suspends it for good
+func (h *Handler) DisableReportedLink(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, store.StatusSuspended)
+}
+
+// moderate closes the reports against a link. Suspended links are moved to status, and
+// active ones too when status is StatusSuspended; links their owner disabled or deleted keep that status.
+func (h *Handler) moderate(w http.ResponseWriter, r *http.Request, status store.LinkStatus) {
+	ctx := r.Context()
+	code := r.PathValue("code")
+	if !store.ValidCode(code) {
+		h.respondWithStoreError(w, r, store.ErrLinkNotFound)
+		return
+	}
+
+	urlData, err := h.store.GetURLData(ctx, code)
+	if err != nil {
+		h.respondWithStoreError(w, r, err)
+		return
+	}
+	if urlData == nil {
+		h.respondWithStoreError(w, r, store.ErrLinkNotFound)
+		return
+	}
+
+	if urlData.Status == store.StatusSuspended || (urlData.IsActive() && status == store.StatusSuspended) {
+		if err := h.store.SetLinkStatus(ctx, code, status); err != nil {
+			h.respondWithStoreError(w, r, err)
+			return
+		}
+		urlData.Status = status
+	}
+
+	cleared, err := h.store.ClearReports(ctx, code)
+	if err != nil {
+		h.respondWithStoreError(w, r, err)
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]any{
+		"code":            code,
+		"status":          urlData.Status,
+		"cleared_reports": cleared,
+	})
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/yingtu35/ShortenMe/internal/config"
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+func TestReports(t *testing.T) {
+	memoryStore, handler, r := newTestServer(t, config.Config{AdminToken: testAdminToken, ReportThreshold: 2})
+	r.Get("/report/{code}", handler.ReportForm)
+	r.Post("/report/{code}", handler.SubmitReport)
+	r.Patch("/api/links/{code}", handler.UpdateLink)
+	r.Get("/{shortURL}", handler.Redirect)
+	r.With(handler.RequireAdmin).Get("/api/reports", handler.ListReports)
+	r.With(handler.RequireAdmin).Post("/api/reports/{code}/dismiss", handler.DismissReports)
+	r.With(handler.RequireAdmin).Post("/api/reports/{code}/disable", handler.DisableReportedLink)
+
+	ctx := context.Background()
+	if _, err := memoryStore.CreateShortURL(ctx, "https://example.com/login", store.CreateOptions{Alias: "promo", ManageToken: "owner-token"}); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, target, body, remoteAddr, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if method == "POST" && strings.HasPrefix(target, "/report/") {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if remoteAddr != "" {
+			req.RemoteAddr = remoteAddr
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	report := url.Values{"reason": {"phishing"}, "details": {"Fake bank login"}}.Encode()
+	status := func() store.LinkStatus {
+		urlData, err := memoryStore.GetURLData(ctx, "promo")
+		if err != nil || urlData == nil {
+			t.Fatalf("GetURLData() = %v, %v", urlData, err)
+		}
+		return urlData.Status
+	}
+
+	if rr := send("GET", "/report/promo", "", "", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `action="/report/promo"`) {
+		t.Errorf("GET /report/promo: got %v, want the report form", rr.Code)
+	}
+	if rr := send("POST", "/report/promo", "reason=bogus", "", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown reason: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr := send("POST", "/report/missing", report, "", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown link: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	// The same visitor reporting twice counts once
+	for range 2 {
+		if rr := send("POST", "/report/promo", report, "192.0.2.1:1234", ""); rr.Code != http.StatusOK {
+			t.Fatalf("POST /report/promo: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+	}
+	if got := status(); got != store.StatusActive {
+		t.Fatalf("status after one reporter = %q, want active", got)
+	}
+
+	// Another address in the same network is the same reporter
+	send("POST", "/report/promo", report, "192.0.2.200:1234", "")
+	if got := status(); got != store.StatusActive {
+		t.Fatalf("status after reports from one IPv4 network = %q, want active", got)
+	}
+
+	// A second visitor reaches the threshold
+	send("POST", "/report/promo", report, "198.51.100.7:4321", "")
+	if got := status(); got != store.StatusSuspended {
+		t.Fatalf("status at the threshold = %q, want suspended", got)
+	}
+	if rr := send("GET", "/promo", "", "", ""); rr.Code != http.StatusGone {
+		t.Errorf("redirect of suspended link: got %v want %v", rr.Code, http.StatusGone)
+	}
+	if rr := send("PATCH", "/api/links/promo", `{"status": "active"}`, "", "owner-token"); rr.Code != http.StatusForbidden {
+		t.Errorf("owner re-enabling suspended link: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	var queue struct {
+		Links []ReportedLinkSummary `json:"links"`
+	}
+	rr := send("GET", "/api/reports", "", "", testAdminToken)
+	if err := json.NewDecoder(rr.Body).Decode(&queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Links) != 1 || queue.Links[0].Code != "promo" || len(queue.Links[0].Reports) != 2 || queue.Links[0].Status != store.StatusSuspended {
+		t.Fatalf("GET /api/reports = %+v, want promo with 2 reports", queue.Links)
+	}
+	if got := queue.Links[0].Reports[0]; got.Reason != "phishing" || got.Details != "Fake bank login" {
+		t.Errorf("report = %+v", got)
+	}
+
+	if rr := send("POST", "/api/reports/promo/dismiss", "", "", testAdminToken); rr.Code != http.StatusOK {
+		t.Fatalf("dismiss: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got := status(); got != store.StatusActive {
+		t.Errorf("status after dismissal = %q, want active", got)
+	}
+	if reported, _ := memoryStore.ListReportedLinks(ctx, 0); len(reported) != 0 {
+		t.Errorf("queue after dismissal = %+v, want empty", reported)
+	}
+
+	send("POST", "/report/promo", report, "192.0.2.1:1234", "")
+	if rr := send("POST", "/api/reports/promo/disable", "", "", testAdminToken); rr.Code != http.StatusOK {
+		t.Fatalf("disable: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got := status(); got != store.StatusSuspended {
+		t.Errorf("status after disabling = %q, want suspended", got)
+	}
+	if rr := send("POST", "/api/reports/missing/disable", "", "", testAdminToken); rr.Code != http.StatusNotFound {
+		t.Errorf("disable unknown link: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestReporterID(t *testing.T) {
+	handler := NewHandler(&mockStore{}, config.Config{}, getTemplateDir(t))
+	reporter := func(remoteAddr string) string {
+		req := httptest.NewRequest("POST", "/report/promo", nil)
+		req.RemoteAddr = remoteAddr
+		id, err := handler.reporterID(req)
+		if err != nil {
+			t.Fatalf("reporterID(%s) error = %v", remoteAddr, err)
+		}
+		return id
+	}
+
+	// Rotating addresses within a /48 must not make a client a new reporter
+	if reporter("[2001:db8:1:2::1]:1234") != reporter("[2001:db8:1:ffff::abcd]:1234") {
+		t.Error("reporterID() differs within an IPv6 /48")
+	}
+	if reporter("[2001:db8:1::1]:1234") == reporter("[2001:db8:2::1]:1234") {
+		t.Error("reporterID() matches for different IPv6 /48 networks")
+	}
+	if reporter("192.0.2.1:1234") != reporter("192.0.2.254:1234") {
+		t.Error("reporterID() differs within an IPv4 /24")
+	}
+	if reporter("192.0.2.1:1234") == reporter("198.51.100.1:1234") {
+		t.Error("reporterID() matches for different IPv4 networks")
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrRedirectLoop is returned when a destination's redirects come back to a URL already visited
+	ErrRedirectLoop = errors.New("destination redirects in a loop")
+	// ErrTooManyRedirects is returned when a destination redirects more times than allowed
+	ErrTooManyRedirects = errors.New("destination redirects too many times")
+)
+
+// errPrivateAddress stops the default resolver client from reaching internal addresses
+var errPrivateAddress = errors.New("refusing to connect to a non-public address")
+
+// RedirectResolver follows a destination's redirect chain to find where it really leads
+type RedirectResolver struct {
+	// Client makes the requests; its own redirect handling is bypassed
+	Client *http.Client
+	// MaxDepth is how many redirects are followed before giving up with ErrTooManyRedirects
+	MaxDepth int
+	// Check is called with every URL in the chain, including the first, and stops
+	// the resolution with its error
+	Check func(*url.URL) error
+}
+
+// Resolve follows rawURL's redirects and returns the URL that finally answers without
+// one. Errors reaching a hop are returned as they are, wrapped with the hop's URL.
+func (r *RedirectResolver) Resolve(ctx context.Context, rawURL string) (string, error) {
+	client := *r.Client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	current, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	visited := map[string]bool{}
+
+	for redirects := 0; ; redirects++ {
+		if r.Check != nil {
+			if err := r.Check(current); err != nil {
+				return current.String(), err
+			}
+		}
+		if visited[current.String()] {
+			return current.String(), fmt.Errorf("%w: %s is visited twice", ErrRedirectLoop, current)
+		}
+		visited[current.String()] = true
+
+		next, err := nextHop(ctx, &client, current)
+		if err != nil {
+			return current.String(), fmt.Errorf("failed to follow %s: %w", current, err)
+		}
+		if next == nil {
+			return current.String(), nil
+		}
+		if redirects == r.MaxDepth {
+			return current.String(), fmt.Errorf("%w: more than %d", ErrTooManyRedirects, r.MaxDepth)
+		}
+		current = next
+	}
+}
+
+// nextHop requests u and returns where it redirects to, or nil if it does not redirect.
+// HEAD is tried first so that no body is fetched; servers refusing it are asked with GET.
+func nextHop(ctx context.Context, client *http.Client, u *url.URL) (*url.URL, error) {
+	var resp *http.Response
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, nil
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, nil
+	}
+	next, err := u.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Location %q: %w", location, err)
+	}
+	return next, nil
+}
+
+// newPublicHTTPClient returns a client for resolving user-supplied destinations that
+// only connects to public IP addresses, so it cannot be used to probe internal services
+func newPublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// Control sees the address actually dialled, after DNS resolution
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%w: %s", errPrivateAddress, host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		Timeout: timeout,
+	}
+}
+
+// isPublicIP reports whether ip is a globally routable unicast address
+func isPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+}
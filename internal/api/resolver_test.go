@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newRedirectServer serves /hop/N, redirecting to /hop/N+1 until last, which answers 200
+func newRedirectServer(t *testing.T, last int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if n >= last {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/hop/%d", n+1), http.StatusFound)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolveFollowsRedirects(t *testing.T) {
+	server := newRedirectServer(t, 3)
+	resolver := &RedirectResolver{Client: server.Client(), MaxDepth: 5}
+
+	got, err := resolver.Resolve(context.Background(), server.URL+"/hop/0")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if want := server.URL + "/hop/3"; got != want {
+		t.Errorf("Resolve() = %q, want %q", got, want)
+	}
+}
+
+func TestResolveDepthCap(t *testing.T) {
+	server := newRedirectServer(t, 3)
+
+	resolver := &RedirectResolver{Client: server.Client(), MaxDepth: 3}
+	if _, err := resolver.Resolve(context.Background(), server.URL+"/hop/0"); err != nil {
+		t.Errorf("exactly MaxDepth redirects: error = %v", err)
+	}
+
+	resolver.MaxDepth = 2
+	if _, err := resolver.Resolve(context.Background(), server.URL+"/hop/0"); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("more than MaxDepth redirects: error = %v, want %v", err, ErrTooManyRedirects)
+	}
+}
+
+func TestResolveDetectsLoops(t *testing.T) {
+	// Two servers bouncing between each other, as two shorteners pointing at each other would
+	var a, b *httptest.Server
+	a = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, b.URL+"/from-a", http.StatusMovedPermanently)
+	}))
+	defer a.Close()
+	b = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, a.URL+"/start", http.StatusTemporaryRedirect)
+	}))
+	defer b.Close()
+
+	resolver := &RedirectResolver{Client: a.Client(), MaxDepth: 10}
+	_, err := resolver.Resolve(context.Background(), a.URL+"/start")
+	if !errors.Is(err, ErrRedirectLoop) {
+		t.Errorf("Resolve() error = %v, want %v", err, ErrRedirectLoop)
+	}
+}
+
+func TestResolveChecksEveryHop(t *testing.T) {
+	server := newRedirectServer(t, 3)
+	errBlocked := errors.New("blocked")
+
+	var checked []string
+	resolver := &RedirectResolver{
+		Client:   server.Client(),
+		MaxDepth: 5,
+		Check: func(u *url.URL) error {
+			checked = append(checked, u.Path)
+			if u.Path == "/hop/2" {
+				return errBlocked
+			}
+			return nil
+		},
+	}
+
+	if _, err := resolver.Resolve(context.Background(), server.URL+"/hop/0"); !errors.Is(err, errBlocked) {
+		t.Errorf("Resolve() error = %v, want %v", err, errBlocked)
+	}
+	if want := []string{"/hop/0", "/hop/1", "/hop/2"}; fmt.Sprint(checked) != fmt.Sprint(want) {
+		t.Errorf("checked %v, want %v", checked, want)
+	}
+}
+
+func TestResolveFallsBackToGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case r.URL.Path == "/":
+			http.Redirect(w, r, "/final", http.StatusSeeOther)
+		}
+	}))
+	defer server.Close()
+
+	resolver := &RedirectResolver{Client: server.Client(), MaxDepth: 5}
+	got, err := resolver.Resolve(context.Background(), server.URL+"/")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if want := server.URL + "/final"; got != want {
+		t.Errorf("Resolve() = %q, want %q", got, want)
+	}
+}
+
+func TestPublicHTTPClientRefusesLoopback(t *testing.T) {
+	server := newRedirectServer(t, 0)
+
+	_, err := newPublicHTTPClient(resolveTimeout).Get(server.URL + "/hop/0")
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("Get() error = %v, want %v", err, errPrivateAddress)
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+// statsIntervals are the bucket sizes the stats endpoint accepts, with the range reported
+// when the request gives no from
+var statsIntervals = map[string]struct {
+	size         time.Duration
+	defaultRange time.Duration
+}{
+	"minute": {time.Minute, time.Hour},
+	"hour":   {time.Hour, 24 * time.Hour},
+	"day":    {24 * time.Hour, 30 * 24 * time.Hour},
+}
+
+// maxStatsBuckets caps how many buckets one stats request may ask for, a day of minutes
+const maxStatsBuckets = 1440
+
+// ClickBucket is the number of clicks in the interval starting at Start
+type ClickBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+	// UniqueVisitors is only known for daily buckets
+	UniqueVisitors *int64 `json:"unique_visitors,omitempty"`
+}
+
+// addDailyVisitors fills in the unique visitors of daily buckets, leaving days without any at zero
+func addDailyVisitors(buckets []ClickBucket, days []store.DailyVisitors) {
+	visitors := make(map[time.Time]int64, len(days))
+	for _, day := range days {
+		visitors[day.Day.UTC()] = day.Visitors
+	}
+	for i := range buckets {
+		n := visitors[buckets[i].Start]
+		buckets[i].UniqueVisitors = &n
+	}
+}
+
+// LinkStats reports a link's clicks over time in minute, hour or day buckets, with its unique visitors
+// on the days the range covers, given the link's management token or the admin token. from and to are
+// RFC 3339 timestamps; to defaults to now and from to a range suited to the interval.
+func (h *Handler) LinkStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := r.PathValue("code")
+	query := r.URL.Query()
+
+	name := query.Get("interval")
+	if name == "" {
+		name = "hour"
+	}
+	interval, ok := statsIntervals[name]
+	if !ok {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "interval must be minute, hour or day"})
+		return
+	}
+
+	to := time.Now()
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid to timestamp"})
+			return
+		}
+		to = t
+	}
+	from := to.Add(-interval.defaultRange)
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid from timestamp"})
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+		return
+	}
+	if to.Sub(from.Truncate(interval.size)) > maxStatsBuckets*interval.size {
+		h.respondWithJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Range spans more than " + strconv.Itoa(maxStatsBuckets) + " buckets; use a shorter range or a longer interval",
+		})
+		return
+	}
+
+	// Who clicked when is for the link's owner and admins, not anyone who knows the short URL
+	if h.hasAdminToken(r) {
+		urlData, err := h.store.GetURLData(ctx, code)
+		if err != nil {
+			h.respondWithStoreError(w, r, err)
+			return
+		}
+		if urlData == nil {
+			h.respondWithJSON(w, http.StatusNotFound, map[string]string{"error": store.ErrLinkNotFound.Error()})
+			return
+		}
+	} else if h.authorizeLink(w, r) == nil {
+		return
+	}
+
+	counts, err := h.store.CountClicks(ctx, code, from, to, interval.size)
+	if err != nil {
+		h.respondWithStoreError(w, r, err)
+		return
+	}
+
+	visitors, err := h.store.GetUniqueVisitors(ctx, code, from, to)
+	if err != nil {
+		h.respondWithStoreError(w, r, err)
+		return
+	}
+
+	var total int64
+	buckets := make([]ClickBucket, len(counts))
+	for i, count := range counts {
+		buckets[i] = ClickBucket{Start: count.Start, Clicks: count.Clicks}
+		total += count.Clicks
+	}
+	if name == "day" {
+		addDailyVisitors(buckets, visitors.Days)
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]any{
+		"short_url":       h.config.BaseURL + "/" + code,
+		"interval":        name,
+		"from":            from,
+		"to":              to,
+		"total_clicks":    total,
+		"unique_visitors": visitors.Total,
+		"buckets":         buckets,
+	})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yingtu35/ShortenMe/internal/config"
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+func TestLinkStats(t *testing.T) {
+	memoryStore, handler, r := newTestServer(t, config.Config{AdminToken: testAdminToken})
+	r.Get("/api/links/{code}/stats", handler.LinkStats)
+
+	ctx := context.Background()
+	if _, err := memoryStore.CreateShortURL(ctx, "https://example.com/campaign", store.CreateOptions{Alias: "campaign", ManageToken: "token"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, visitor := range []string{"alice", "alice", "bob"} {
+		if _, err := memoryStore.FollowLink(ctx, "campaign", store.ClickEvent{Visitor: visitor}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	getWithToken := func(target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	get := func(target string) *httptest.ResponseRecorder {
+		return getWithToken(target, "token")
+	}
+
+	rr := get("/api/links/campaign/stats?interval=minute")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var response struct {
+		Interval       string        `json:"interval"`
+		TotalClicks    int64         `json:"total_clicks"`
+		UniqueVisitors int64         `json:"unique_visitors"`
+		Buckets        []ClickBucket `json:"buckets"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Interval != "minute" || response.TotalClicks != 3 || response.UniqueVisitors != 2 {
+		t.Errorf("response = %+v, want 3 clicks by 2 visitors by minute", response)
+	}
+	// The default range for minutes is the last hour
+	if n := len(response.Buckets); n < 60 || n > 61 {
+		t.Errorf("got %d buckets, want an hour of minutes", n)
+	}
+	var sum int64
+	for _, bucket := range response.Buckets {
+		sum += bucket.Clicks
+	}
+	if sum != 3 {
+		t.Errorf("buckets add up to %d clicks, want 3", sum)
+	}
+	if response.Buckets[0].UniqueVisitors != nil {
+		t.Errorf("minute bucket has unique visitors %d, want them left out", *response.Buckets[0].UniqueVisitors)
+	}
+
+	rr = get("/api/links/campaign/stats?interval=day")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	response.Buckets = nil
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if today := response.Buckets[len(response.Buckets)-1]; today.Clicks != 3 || today.UniqueVisitors == nil || *today.UniqueVisitors != 2 {
+		t.Errorf("today's bucket = %+v, want 3 clicks by 2 visitors", today)
+	}
+	if first := response.Buckets[0]; first.UniqueVisitors == nil || *first.UniqueVisitors != 0 {
+		t.Errorf("first day's bucket = %+v, want no visitors", first)
+	}
+
+	rr = get("/api/links/campaign/stats?interval=day&from=2020-01-01T00:00:00Z&to=2020-01-03T00:00:00Z")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	response.Buckets = nil
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.TotalClicks != 0 || response.UniqueVisitors != 0 || len(response.Buckets) != 2 {
+		t.Errorf("response = %+v, want two empty days", response)
+	}
+
+	for _, tt := range []struct {
+		target string
+		status int
+	}{
+		{"/api/links/nonexistent/stats", http.StatusNotFound},
+		{"/api/links/campaign/stats?interval=week", http.StatusBadRequest},
+		{"/api/links/campaign/stats?from=yesterday", http.StatusBadRequest},
+		{"/api/links/campaign/stats?from=2025-01-02T00:00:00Z&to=2025-01-01T00:00:00Z", http.StatusBadRequest},
+		{"/api/links/campaign/stats?interval=minute&from=2025-01-01T00:00:00Z&to=2025-01-03T00:00:00Z", http.StatusBadRequest},
+	} {
+		if rr := get(tt.target); rr.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.target, rr.Code, tt.status)
+		}
+	}
+
+	// Only the owner and admins see the statistics
+	for _, tt := range []struct {
+		token  string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		{testAdminToken, http.StatusOK},
+	} {
+		if rr := getWithToken("/api/links/campaign/stats", tt.token); rr.Code != tt.status {
+			t.Errorf("GET stats with token %q = %d, want %d", tt.token, rr.Code, tt.status)
+		}
+	}
+	if rr := getWithToken("/api/links/nonexistent/stats", testAdminToken); rr.Code != http.StatusNotFound {
+		t.Errorf("GET stats of an unknown link as admin = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/yingtu35/ShortenMe/internal/threat"
+)
+
+// ThreatWarning is the interstitial shown instead of redirecting to a destination on a threat list
+type ThreatWarning struct {
+	ShortURL    string
+	OriginalURL string
+	Threat      string
+}
+
+// Threats returns the threat lists checked at creation and redirect, so that they can be loaded and kept up to date
+func (h *Handler) Threats() *threat.List {
+	return h.threats
+}
+
+// threatListedMessage is what users are told when they try to shorten a listed destination
+func threatListedMessage(threatType threat.Type) string {
+	return "Destination is listed as " + threatType.Description()
+}
+
+// respondWithThreat rejects a listed destination on a JSON endpoint
+func (h *Handler) respondWithThreat(w http.ResponseWriter, threatType threat.Type) {
+	h.respondWithJSON(w, http.StatusForbidden, map[string]string{
+		"error":       threatListedMessage(threatType),
+		"threat_type": string(threatType),
+	})
+}
+
+// threatWarning serves the interstitial for a link whose destination is on a threat list
+func (h *Handler) threatWarning(w http.ResponseWriter, shortURL, originalURL string, threatType threat.Type) {
+	tmpl := template.Must(template.ParseFiles(h.templateDir + "/threat-warning.html"))
+	err := tmpl.Execute(w, ThreatWarning{
+		ShortURL:    shortURL,
+		OriginalURL: originalURL,
+		Threat:      threatType.Description(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ReloadThreatLists rereads the threat list files straight away
+func (h *Handler) ReloadThreatLists(w http.ResponseWriter, r *http.Request) {
+	if err := h.threats.Reload(); err != nil {
+		h.respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	h.respondWithJSON(w, http.StatusOK, map[string]int{"prefixes": h.threats.Len()})
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yingtu35/ShortenMe/internal/config"
+)
+
+// writeThreatList writes a phishing list file holding 4-byte hash prefixes of expressions
+func writeThreatList(t *testing.T, path string, expressions ...string) {
+	t.Helper()
+
+	var hashes []byte
+	for _, expression := range expressions {
+		hash := sha256.Sum256([]byte(expression))
+		hashes = append(hashes, hash[:4]...)
+	}
+	data := `{"listUpdateResponses": [{"threatType": "SOCIAL_ENGINEERING", "additions": [` +
+		`{"rawHashes": {"prefixSize": 4, "rawHashes": "` + base64.StdEncoding.EncodeToString(hashes) + `"}}]}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollbackChecksThreatLists(t *testing.T) {
+	listPath := filepath.Join(t.TempDir(), "phishing.json")
+	writeThreatList(t, listPath)
+
+	memoryStore, handler, r := setupRolledBackLink(t, config.Config{ThreatLists: []string{listPath}}, "https://login.evil.example/")
+
+	// The old destination is listed after the link moved away from it
+	writeThreatList(t, listPath, "evil.example/")
+	if err := handler.Threats().Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	rr := rollbackRequest(r, "managed", "token", 1)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("rollback to a listed destination returned %v, want %v: %s", rr.Code, http.StatusForbidden, rr.Body.String())
+	}
+	if body := rr.Body.String(); !strings.Contains(body, `"threat_type":"SOCIAL_ENGINEERING"`) {
+		t.Errorf("rollback to a listed destination: body = %s, want the threat type", body)
+	}
+	if urlData, err := memoryStore.GetURLData(context.Background(), "managed"); err != nil || urlData.OriginalURL != "https://example.com/new" {
+		t.Errorf("destination after rejected rollback = %v, %v; want https://example.com/new", urlData, err)
+	}
+}
+
+func TestThreatLists(t *testing.T) {
+	listPath := filepath.Join(t.TempDir(), "phishing.json")
+	writeThreatList(t, listPath)
+
+	_, handler, r := newTestServer(t, config.Config{ThreatLists: []string{listPath}})
+	if err := handler.Threats().Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	r.Post("/api/shorten", handler.APIShorten)
+	r.Get("/{shortURL}", handler.Redirect)
+
+	shorten := func(destination string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(`{"url": "`+destination+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Created before the destination was listed
+	rr := shorten("https://login.evil.example/account")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("shorten before listing: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var created map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	code := created["short_url"][strings.LastIndex(created["short_url"], "/")+1:]
+
+	// Listed without a restart
+	writeThreatList(t, listPath, "evil.example/")
+	if err := handler.Threats().Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	rr = shorten("https://www.evil.example/")
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("shorten listed destination: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, `"threat_type":"SOCIAL_ENGINEERING"`) {
+		t.Errorf("shorten listed destination: body = %s, want the threat type", body)
+	}
+
+	req := httptest.NewRequest("GET", "/"+code, nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("redirect to listed destination: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if location := rr.Header().Get("Location"); location != "" {
+		t.Errorf("redirect to listed destination: Location = %q, want none", location)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, "listed as phishing") || !strings.Contains(body, "https://login.evil.example/account") {
+		t.Errorf("warning page does not name the threat and destination: %s", body)
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/httprate"
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+const (
+	// unlockCookieTTL is how long a correct password keeps a link unlocked
+	unlockCookieTTL = 10 * time.Minute
+	// maxUnlockFailures wrong passwords per link and IP are allowed per unlockFailureWindow
+	maxUnlockFailures   = 5
+	unlockFailureWindow = 15 * time.Minute
+)
+
+type UnlockForm struct {
+	ShortURL string
+	Error    string
+}
+
+// newUnlockSecret returns the configured cookie secret, or a random one that
+// only lives as long as the process if none is configured
+func newUnlockSecret(configured string) []byte {
+	if configured != "" {
+		return []byte(configured)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Failed to generate cookie secret: %v", err)
+	}
+	return secret
+}
+
+// unlockCookieName is scoped per link so unlocking one link does not unlock others
+func unlockCookieName(shortURL string) string {
+	return "unlock_" + shortURL
+}
+
+// signUnlock returns the MAC binding shortURL to the cookie expiry
+func (h *Handler) signUnlock(shortURL, expires string) string {
+	mac := hmac.New(sha256.New, h.unlockSecret)
+	mac.Write([]byte(shortURL + "|" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// setUnlockCookie remembers that the client entered the right password for shortURL
+func (h *Handler) setUnlockCookie(w http.ResponseWriter, shortURL string) {
+	expiresAt := time.Now().Add(unlockCookieTTL)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookieName(shortURL),
+		Value:    expires + "." + h.signUnlock(shortURL, expires),
+		Path:     "/" + shortURL,
+		Expires:  expiresAt,
+		MaxAge:   int(unlockCookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.config.BaseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// isUnlocked reports whether the request carries a valid, unexpired unlock cookie for shortURL
+func (h *Handler) isUnlocked(r *http.Request, shortURL string) bool {
+	cookie, err := r.Cookie(unlockCookieName(shortURL))
+	if err != nil {
+		return false
+	}
+
+	expires, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+	if !hmac.Equal([]byte(signature), []byte(h.signUnlock(shortURL, expires))) {
+		return false
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Now().Unix() < expiresAt
+}
+
+// Unlock checks the password submitted for a protected link. On success it sets
+// an unlock cookie, counts the click and redirects; failures are rate limited
+// per link and client IP.
+func (h *Handler) Unlock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	shortURL := r.PathValue("shortURL")
+	if shortURL == "" {
+		http.Error(w, "Short URL is required", http.StatusBadRequest)
+		return
+	}
+	if !store.ValidCode(shortURL) {
+		h.renderNotFound(w, shortURL)
+		return
+	}
+
+	ip, err := httprate.KeyByIP(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	limitKey := shortURL + "|" + ip
+
+	if _, rate, err := h.unlockFailures.Status(limitKey); err == nil && rate >= maxUnlockFailures {
+		w.Header().Set("Retry-After", strconv.Itoa(int(unlockFailureWindow.Seconds())))
+		w.WriteHeader(http.StatusTooManyRequests)
+		tmpl := template.Must(template.ParseFiles(h.templateDir + "/unlock.html"))
+		err = tmpl.Execute(w, UnlockForm{ShortURL: shortURL, Error: "Too many incorrect attempts. Please try again later."})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	urlData, err := h.store.GetURLData(ctx, shortURL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if urlData == nil {
+		tmpl := template.Must(template.ParseFiles(h.templateDir + "/not-found.html"))
+		err = tmpl.Execute(w, NotFound{ShortURL: shortURL})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	if !urlData.CheckPassword(r.PostFormValue("password")) {
+		h.unlockFailures.OnLimit(w, r, limitKey)
+
+		w.WriteHeader(http.StatusUnauthorized)
+		tmpl := template.Must(template.ParseFiles(h.templateDir + "/unlock.html"))
+		err = tmpl.Execute(w, UnlockForm{ShortURL: shortURL, Error: "Incorrect password."})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	if urlData.HasPassword() {
+		h.setUnlockCookie(w, shortURL)
+	}
+	h.followLink(w, r, shortURL)
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yingtu35/ShortenMe/internal/config"
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+// setupProtectedLink creates a router over a memory store holding one password-protected link
+func setupProtectedLink(t *testing.T) (*store.MemoryStore, http.Handler) {
+	t.Helper()
+
+	memoryStore, handler, r := newTestServer(t, config.Config{CookieSecret: "test-secret"})
+	_, err := memoryStore.CreateShortURL(context.Background(), "https://example.com/private", store.CreateOptions{
+		Alias:    "private",
+		Password: "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create protected link: %v", err)
+	}
+
+	r.Get("/{shortURL}", handler.Redirect)
+	r.Post("/{shortURL}", handler.Unlock)
+
+	return memoryStore, r
+}
+
+func submitPassword(r http.Handler, password, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/private", strings.NewReader("password="+password))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func clickCount(t *testing.T, s *store.MemoryStore) int64 {
+	t.Helper()
+
+	count, err := s.GetClickCount(context.Background(), "private")
+	if err != nil {
+		t.Fatalf("GetClickCount() error = %v", err)
+	}
+	return count
+}
+
+func TestRedirectShowsUnlockForm(t *testing.T) {
+	memoryStore, r := setupProtectedLink(t)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/private", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if location := rr.Header().Get("Location"); location != "" {
+		t.Errorf("protected link redirected to %q before unlock", location)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, "password protected") || !strings.Contains(body, `name="password"`) {
+		t.Errorf("handler did not render the unlock form: %v", body)
+	}
+	if got := clickCount(t, memoryStore); got != 0 {
+		t.Errorf("click count = %v before unlock, want 0", got)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	memoryStore, r := setupProtectedLink(t)
+
+	// A wrong password is refused and not counted as a click
+	rr := submitPassword(r, "guess", "192.0.2.1:1234")
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: got status %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if !strings.Contains(rr.Body.String(), "Incorrect password") {
+		t.Error("wrong password: response does not explain the failure")
+	}
+	if got := clickCount(t, memoryStore); got != 0 {
+		t.Errorf("click count = %v after wrong password, want 0", got)
+	}
+
+	// The right password redirects, counts one click and sets the unlock cookie
+	rr = submitPassword(r, "s3cret", "192.0.2.1:1234")
+	if rr.Code != http.StatusFound {
+		t.Fatalf("correct password: got status %v want %v", rr.Code, http.StatusFound)
+	}
+	if location := rr.Header().Get("Location"); location != "https://example.com/private" {
+		t.Errorf("correct password: redirected to %q", location)
+	}
+	if got := clickCount(t, memoryStore); got != 1 {
+		t.Errorf("click count = %v after unlock, want 1", got)
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "unlock_private" || !cookies[0].HttpOnly {
+		t.Fatalf("unlock cookie not set as expected: %+v", cookies)
+	}
+
+	// The cookie lets the visitor straight through on later visits
+	req := httptest.NewRequest("GET", "/private", nil)
+	req.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Errorf("visit with unlock cookie: got status %v want %v", rr.Code, http.StatusFound)
+	}
+
+	// A tampered cookie is ignored
+	forged := *cookies[0]
+	forged.Value = strings.Replace(forged.Value, ".", ".x", 1)
+	req = httptest.NewRequest("GET", "/private", nil)
+	req.AddCookie(&forged)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Location") != "" {
+		t.Errorf("visit with forged cookie: got status %v, location %q, want the unlock form",
+			rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+func TestUnlockRateLimitsFailures(t *testing.T) {
+	memoryStore, r := setupProtectedLink(t)
+
+	for i := 0; i < maxUnlockFailures; i++ {
+		if rr := submitPassword(r, "guess", "192.0.2.1:1234"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got status %v want %v", i+1, rr.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Once the limit is hit even the right password is refused from that IP
+	rr := submitPassword(r, "s3cret", "192.0.2.1:1234")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("after %d failures: got status %v want %v", maxUnlockFailures, rr.Code, http.StatusTooManyRequests)
+	}
+	if got := clickCount(t, memoryStore); got != 0 {
+		t.Errorf("click count = %v while rate limited, want 0", got)
+	}
+
+	// Other visitors are unaffected
+	if rr := submitPassword(r, "s3cret", "198.51.100.7:1234"); rr.Code != http.StatusFound {
+		t.Errorf("other IP: got status %v want %v", rr.Code, http.StatusFound)
+	}
+}
@@ -1,20 +1,93 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds application configuration
 type Config struct {
-	BaseURL string
-	Port    string
+	BaseURL      string
+	Port         string
+	StoreBackend string
+	// AppEnv is the deployment environment, such as development or production
+	AppEnv string
+	// CookieSecret signs unlock cookies for password-protected links and keys reporter and visitor
+	// hashes. It is required in production; elsewhere a random one is used if empty, which resets
+	// all of them on every restart and differs between replicas.
+	CookieSecret string
+	// DeletedLinkRetention is how long a deleted link can still be restored before it is purged
+	DeletedLinkRetention time.Duration
+	// PurgeInterval is how often deleted links and click events past their retention period are purged
+	PurgeInterval time.Duration
+	// ClickEventRetention is how long the event of each redirect is kept; zero keeps them forever
+	ClickEventRetention time.Duration
+	// AdminToken authorises the admin API; the admin API is disabled if empty
+	AdminToken string
+	// StripQueryParams are query parameters removed from destinations, such as tracking
+	// parameters; a trailing '*' matches a prefix
+	StripQueryParams []string
+	// SortQueryParams orders the query parameters of destinations by name
+	SortQueryParams bool
+	// ShortenerHosts are other URL shorteners whose links are rejected as destinations,
+	// along with links back to BaseURL
+	ShortenerHosts []string
+	// ResolveRedirects follows each new destination's redirects to reject loops and
+	// chains through shorteners
+	ResolveRedirects bool
+	// MaxRedirects is how many redirects a destination may go through when they are resolved
+	MaxRedirects int
+	// PolicyFile holds the destination allow and deny policies; if empty they are kept in the store
+	PolicyFile string
+	// PolicyReloadInterval is how often policies are reloaded from their source; 0 disables reloading
+	PolicyReloadInterval time.Duration
+	// ThreatLists are files of phishing and malware URL hash prefixes checked at creation and redirect
+	ThreatLists []string
+	// ThreatListReloadInterval is how often the threat lists are reloaded; 0 disables reloading
+	ThreatListReloadInterval time.Duration
+	// ReportThreshold is how many networks must report a link before it is suspended
+	// until reviewed; 0 never suspends links automatically
+	ReportThreshold int
+}
+
+// defaultShortenerHosts are well-known URL shorteners
+var defaultShortenerHosts = []string{
+	"bit.ly", "bitly.com", "buff.ly", "cutt.ly", "goo.gl", "is.gd", "ow.ly",
+	"rb.gy", "rebrand.ly", "shorturl.at", "t.co", "t.ly", "tiny.cc", "tinyurl.com",
 }
 
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
 	return &Config{
-		BaseURL: getEnvOrDefault("SHORTENME_URL", "http://localhost:8080"),
-		Port:    getEnvOrDefault("PORT", "8080"),
+		BaseURL:      getEnvOrDefault("SHORTENME_URL", "http://localhost:8080"),
+		Port:         getEnvOrDefault("PORT", "8080"),
+		StoreBackend: getEnvOrDefault("STORE_BACKEND", "redis"),
+		AppEnv:       getEnvOrDefault("APP_ENV", "development"),
+		CookieSecret: os.Getenv("COOKIE_SECRET"),
+
+		DeletedLinkRetention: getDurationOrDefault("DELETED_LINK_RETENTION", 30*24*time.Hour),
+		PurgeInterval:        getDurationOrDefault("PURGE_INTERVAL", time.Hour),
+		ClickEventRetention:  getDurationOrDefault("CLICK_EVENT_RETENTION", 90*24*time.Hour),
+
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+
+		StripQueryParams: getListOrDefault("STRIP_QUERY_PARAMS", nil),
+		SortQueryParams:  getBoolOrDefault("SORT_QUERY_PARAMS", false),
+
+		ShortenerHosts:   getListOrDefault("SHORTENER_HOSTS", defaultShortenerHosts),
+		ResolveRedirects: getBoolOrDefault("RESOLVE_REDIRECTS", false),
+		MaxRedirects:     getIntOrDefault("MAX_REDIRECTS", 5),
+
+		PolicyFile:           os.Getenv("POLICY_FILE"),
+		PolicyReloadInterval: getDurationOrDefault("POLICY_RELOAD_INTERVAL", 30*time.Second),
+
+		ThreatLists:              getListOrDefault("THREAT_LISTS", nil),
+		ThreatListReloadInterval: getDurationOrDefault("THREAT_LIST_RELOAD_INTERVAL", 5*time.Minute),
+
+		ReportThreshold: getIntOrDefault("REPORT_THRESHOLD", 0),
 	}
 }
 
@@ -25,3 +98,67 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getDurationOrDefault parses an environment variable as a duration, falling back to
+// the default if it is unset or invalid
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Printf("Warning: invalid %s %q, using %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getListOrDefault splits a comma-separated environment variable, dropping empty entries
+func getListOrDefault(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getBoolOrDefault parses an environment variable as a boolean, falling back to
+// the default if it is unset or invalid
+func getBoolOrDefault(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+// getIntOrDefault parses an environment variable as a non-negative integer, falling back to
+// the default if it is unset or invalid
+func getIntOrDefault(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Warning: invalid %s %q, using %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Source supplies the policy document an Engine enforces
+type Source interface {
+	Load(ctx context.Context) ([]byte, error)
+}
+
+// FileSource reads the policy document from a file
+type FileSource string
+
+func (f FileSource) Load(context.Context) ([]byte, error) {
+	return os.ReadFile(string(f))
+}
+
+// DocumentStore is the part of the store that keeps the policy document
+type DocumentStore interface {
+	GetPolicyDocument(ctx context.Context) (string, error)
+}
+
+// StoreSource reads the policy document saved in the store
+type StoreSource struct {
+	Store DocumentStore
+}
+
+func (s StoreSource) Load(ctx context.Context) ([]byte, error) {
+	document, err := s.Store.GetPolicyDocument(ctx)
+	return []byte(document), err
+}
+
+// Engine enforces the policies of a Source, reloading them when the document changes
+type Engine struct {
+	source Source
+
+	mu       sync.RWMutex
+	set      *Set
+	document []byte
+}
+
+// NewEngine returns an Engine for source that allows everything until it is first reloaded
+func NewEngine(source Source) *Engine {
+	return &Engine{source: source, set: &Set{}}
+}
+
+// Source returns where the engine loads its policies from
+func (e *Engine) Source() Source {
+	return e.source
+}
+
+// Check returns a *Violation if rawURL breaks one of the current policies
+func (e *Engine) Check(rawURL string) error {
+	e.mu.RLock()
+	set := e.set
+	e.mu.RUnlock()
+	return set.Check(rawURL)
+}
+
+// Reload loads the document from the source and, if it changed, starts enforcing it.
+// An invalid document is reported and the previous policies stay in force.
+func (e *Engine) Reload(ctx context.Context) error {
+	document, err := e.source.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.mu.RLock()
+	unchanged := e.document != nil && bytes.Equal(document, e.document)
+	e.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	set, err := Parse(document)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.set, e.document = set, document
+	e.mu.Unlock()
+	log.Printf("Loaded %d destination policies", len(set.policies))
+	return nil
+}
+
+// Run reloads the policies once per interval until ctx is done
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Reload(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to reload destination policies: %v", err)
+			}
+		}
+	}
+}
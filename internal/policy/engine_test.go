@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngineReloadsFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "policy.json")
+	write := func(document string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(document), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"policies": [{"name": "abuse", "action": "deny", "rules": ["evil.example"]}]}`)
+	engine := NewEngine(FileSource(path))
+	if err := engine.Check("https://evil.example/"); err != nil {
+		t.Errorf("Check() before the first reload = %v, want nil", err)
+	}
+	if err := engine.Reload(ctx); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if err := engine.Check("https://evil.example/"); err == nil {
+		t.Error("Check(evil.example) = nil, want a violation")
+	}
+
+	write(`{"policies": [{"name": "abuse", "action": "deny", "rules": ["worse.example"]}]}`)
+	if err := engine.Reload(ctx); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if err := engine.Check("https://evil.example/"); err != nil {
+		t.Errorf("Check(evil.example) after reload = %v, want nil", err)
+	}
+	if err := engine.Check("https://worse.example/"); err == nil {
+		t.Error("Check(worse.example) after reload = nil, want a violation")
+	}
+
+	// A broken document is reported and the last good policies stay in force
+	write(`{"policies": [`)
+	if err := engine.Reload(ctx); err == nil {
+		t.Error("Reload() of an invalid document succeeded")
+	}
+	if err := engine.Check("https://worse.example/"); err == nil {
+		t.Error("Check(worse.example) after a failed reload = nil, want a violation")
+	}
+}
+
+type documentStore string
+
+func (d documentStore) GetPolicyDocument(context.Context) (string, error) {
+	return string(d), nil
+}
+
+func TestEngineStoreSource(t *testing.T) {
+	engine := NewEngine(StoreSource{Store: documentStore(`{"policies": [{"name": "internal", "action": "allow", "rules": ["*.corp.example"]}]}`)})
+	if err := engine.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if err := engine.Check("https://example.com/"); err == nil {
+		t.Error("Check(example.com) = nil, want a violation")
+	}
+	if err := engine.Check("https://wiki.corp.example/"); err != nil {
+		t.Errorf("Check(wiki.corp.example) = %v, want nil", err)
+	}
+}
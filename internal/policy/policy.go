@@ -0,0 +1,208 @@
+// Package policy decides which destination hosts may be shortened, from named allow and deny policies
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Action says what a policy does with the hosts its rules match
+type Action string
+
+const (
+	// Allow policies only let through destinations matching one of their rules
+	Allow Action = "allow"
+	// Deny policies reject destinations matching any of their rules
+	Deny Action = "deny"
+)
+
+// Policy is a named list of rules. A rule is one of:
+//
+//	example.com       the exact host
+//	*.example.com     any subdomain of example.com, but not example.com itself
+//	/regexp/          a regular expression matching the whole host
+//	10.0.0.0/8        IP literal hosts within the CIDR range
+type Policy struct {
+	Name   string   `json:"name"`
+	Action Action   `json:"action"`
+	Rules  []string `json:"rules"`
+}
+
+// Document is the JSON form policies are written in
+type Document struct {
+	Policies []Policy `json:"policies"`
+}
+
+// Violation is the error returned for a destination a policy rejects
+type Violation struct {
+	// Policy is the name of the violated policy
+	Policy string `json:"policy"`
+	Action Action `json:"action"`
+	// Rule is the deny rule the host matched; it is empty for allow policies
+	Rule string `json:"rule,omitempty"`
+	Host string `json:"host"`
+}
+
+func (v *Violation) Error() string {
+	if v.Action == Deny {
+		return fmt.Sprintf("destination host %s is denied by policy %q (rule %s)", v.Host, v.Policy, v.Rule)
+	}
+	return fmt.Sprintf("destination host %s is not allowed by policy %q", v.Host, v.Policy)
+}
+
+// Set is a parsed Document. Every policy must be satisfied: a destination is rejected if it
+// matches a deny policy or fails to match any rule of an allow policy. The zero Set allows everything.
+type Set struct {
+	policies []compiledPolicy
+}
+
+type compiledPolicy struct {
+	name   string
+	action Action
+	rules  []rule
+}
+
+// rule is one compiled rule; exactly one of its matchers is set
+type rule struct {
+	source string
+	host   string
+	suffix string
+	re     *regexp.Regexp
+	cidr   *net.IPNet
+}
+
+// Parse reads a Document. Blank input is an empty Set.
+func Parse(data []byte) (*Set, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &Set{}, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var doc Document
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+	return Compile(doc)
+}
+
+// Compile checks every policy in doc and builds the Set enforcing them
+func Compile(doc Document) (*Set, error) {
+	set := &Set{}
+	names := map[string]bool{}
+	for _, p := range doc.Policies {
+		if p.Name == "" {
+			return nil, errors.New("every policy needs a name")
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("policy %q is defined twice", p.Name)
+		}
+		names[p.Name] = true
+		if p.Action != Allow && p.Action != Deny {
+			return nil, fmt.Errorf("policy %q: action must be %q or %q", p.Name, Allow, Deny)
+		}
+
+		compiled := compiledPolicy{name: p.Name, action: p.Action}
+		for _, source := range p.Rules {
+			r, err := parseRule(source)
+			if err != nil {
+				return nil, fmt.Errorf("policy %q: %w", p.Name, err)
+			}
+			compiled.rules = append(compiled.rules, r)
+		}
+		set.policies = append(set.policies, compiled)
+	}
+	return set, nil
+}
+
+func parseRule(source string) (rule, error) {
+	r := rule{source: source}
+	value := strings.ToLower(strings.TrimSpace(source))
+
+	switch {
+	case len(value) > 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/"):
+		// Compiled from the original text, as case matters in patterns such as \D
+		pattern := strings.TrimSpace(source)
+		re, err := regexp.Compile(`^(?i:` + pattern[1:len(pattern)-1] + `)$`)
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid regexp rule %q: %w", source, err)
+		}
+		r.re = re
+	case strings.Contains(value, "/"):
+		_, cidr, err := net.ParseCIDR(value)
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid CIDR rule %q: %w", source, err)
+		}
+		r.cidr = cidr
+	case strings.HasPrefix(value, "*."):
+		if !validHost(value[2:]) {
+			return rule{}, fmt.Errorf("invalid wildcard rule %q", source)
+		}
+		r.suffix = value[1:]
+	default:
+		if !validHost(value) {
+			return rule{}, fmt.Errorf("invalid host rule %q", source)
+		}
+		r.host = value
+	}
+	return r, nil
+}
+
+// validHost rejects rule hosts that could never equal a normalized destination host
+func validHost(host string) bool {
+	return host != "" && !strings.ContainsAny(host, "*/ :@?#[]")
+}
+
+func (r rule) match(host string, ip net.IP) bool {
+	switch {
+	case r.re != nil:
+		return r.re.MatchString(host)
+	case r.cidr != nil:
+		return ip != nil && r.cidr.Contains(ip)
+	case r.suffix != "":
+		return strings.HasSuffix(host, r.suffix)
+	default:
+		return host == r.host
+	}
+}
+
+// Check returns a *Violation for the first policy rawURL breaks, in document order
+func (s *Set) Check(rawURL string) error {
+	if len(s.policies) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	ip := net.ParseIP(host)
+
+	for _, p := range s.policies {
+		matched, ok := p.match(host, ip)
+		switch {
+		case p.action == Deny && ok:
+			return &Violation{Policy: p.name, Action: Deny, Rule: matched, Host: host}
+		case p.action == Allow && !ok:
+			return &Violation{Policy: p.name, Action: Allow, Host: host}
+		}
+	}
+	return nil
+}
+
+// match returns the first rule of p matching the host
+func (p compiledPolicy) match(host string, ip net.IP) (string, bool) {
+	for _, r := range p.rules {
+		if r.match(host, ip) {
+			return r.source, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,92 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+const testDocument = `{
+	"policies": [
+		{"name": "abuse", "action": "deny", "rules": ["evil.example", "*.phish.example", "/bad-[0-9]+\\.example/", "203.0.113.0/24"]},
+		{"name": "internal-only", "action": "allow", "rules": ["corp.example", "*.corp.example", "10.0.0.0/8", "2001:db8::/32"]}
+	]
+}`
+
+func TestCheck(t *testing.T) {
+	set, err := Parse([]byte(testDocument))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		url    string
+		policy string
+		rule   string
+	}{
+		{"https://corp.example/a", "", ""},
+		{"https://wiki.corp.example/a", "", ""},
+		{"https://WIKI.Corp.Example./a", "", ""},
+		{"http://10.1.2.3:8080/", "", ""},
+		{"http://[2001:db8::1]/", "", ""},
+		{"https://example.com/", "internal-only", ""},
+		{"https://notcorp.example/", "internal-only", ""},
+		{"http://192.168.0.1/", "internal-only", ""},
+		{"https://evil.example/", "abuse", "evil.example"},
+		{"https://login.phish.example/", "abuse", "*.phish.example"},
+		{"https://phish.example/", "internal-only", ""},
+		{"https://BAD-42.example/", "abuse", `/bad-[0-9]+\.example/`},
+		{"https://xbad-42.example/", "internal-only", ""},
+		{"http://203.0.113.9/", "abuse", "203.0.113.0/24"},
+	}
+
+	for _, tt := range tests {
+		err := set.Check(tt.url)
+		if tt.policy == "" {
+			if err != nil {
+				t.Errorf("Check(%q) = %v, want nil", tt.url, err)
+			}
+			continue
+		}
+
+		var violation *Violation
+		if !errors.As(err, &violation) {
+			t.Errorf("Check(%q) = %v, want a violation of %q", tt.url, err, tt.policy)
+			continue
+		}
+		if violation.Policy != tt.policy || violation.Rule != tt.rule {
+			t.Errorf("Check(%q) violated %q (rule %q), want %q (rule %q)", tt.url, violation.Policy, violation.Rule, tt.policy, tt.rule)
+		}
+	}
+}
+
+func TestEmptySetAllowsEverything(t *testing.T) {
+	for _, document := range []string{"", "  \n", `{"policies": []}`} {
+		set, err := Parse([]byte(document))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", document, err)
+		}
+		if err := set.Check("https://anything.example/"); err != nil {
+			t.Errorf("Parse(%q).Check() = %v, want nil", document, err)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	documents := map[string]string{
+		"not json":       `policies`,
+		"unknown field":  `{"policies": [], "mode": "strict"}`,
+		"missing name":   `{"policies": [{"action": "deny", "rules": ["a.example"]}]}`,
+		"duplicate name": `{"policies": [{"name": "a", "action": "deny"}, {"name": "a", "action": "allow"}]}`,
+		"bad action":     `{"policies": [{"name": "a", "action": "block"}]}`,
+		"bad regexp":     `{"policies": [{"name": "a", "action": "deny", "rules": ["/(/"]}]}`,
+		"bad CIDR":       `{"policies": [{"name": "a", "action": "deny", "rules": ["10.0.0.0/33"]}]}`,
+		"bad wildcard":   `{"policies": [{"name": "a", "action": "deny", "rules": ["*."]}]}`,
+		"inner wildcard": `{"policies": [{"name": "a", "action": "deny", "rules": ["a.*.example"]}]}`,
+	}
+
+	for name, document := range documents {
+		if _, err := Parse([]byte(document)); err == nil {
+			t.Errorf("%s: Parse() succeeded, want an error", name)
+		}
+	}
+}
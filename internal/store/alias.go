@@ -0,0 +1,65 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+)
+
+var (
+	// ErrInvalidAlias is returned when a custom alias fails validation
+	ErrInvalidAlias = errors.New("invalid alias")
+	// ErrAliasTaken is returned when a custom alias is already in use
+	ErrAliasTaken = errors.New("alias is already taken")
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// reservedWords are paths served by the app itself and internal store keys.
+// Aliases are compared case-insensitively so "API" cannot pass for "api".
+var reservedWords = map[string]bool{
+	"api":            true,
+	"health":         true,
+	"terms":          true,
+	"privacy":        true,
+	"static":         true,
+	"shorten":        true,
+	"click-counts":   true,
+	"favicon":        true,
+	"admin":          true,
+	"report":         true,
+	"url_counter":    true,
+	"schema_version": true,
+}
+
+// IsReserved reports whether code would shadow an app route or internal key
+func IsReserved(code string) bool {
+	return reservedWords[strings.ToLower(code)]
+}
+
+// ValidCode reports whether code could name a link. Generated codes and aliases only use letters,
+// digits, '-' and '_' and are never reserved words, so anything else, such as an internal store
+// key, must not be looked up as a link.
+func ValidCode(code string) bool {
+	return code != "" && len(code) <= maxAliasLength && aliasPattern.MatchString(code) && !IsReserved(code)
+}
+
+// ValidateAlias checks that alias can be used as a custom short code
+func ValidateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return fmt.Errorf("%w: must be between %d and %d characters", ErrInvalidAlias, minAliasLength, maxAliasLength)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("%w: only letters, digits, '-' and '_' are allowed", ErrInvalidAlias)
+	}
+	if IsReserved(alias) {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidAlias, alias)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxAllocationAttempts bounds how many counter values are skipped before giving up
+const maxAllocationAttempts = 100
+
+// allocateCode hands out the next free generated short code.
+//
+// Counter values are drawn from next and encoded as base62. Codes that shadow
+// a reserved route are skipped without being offered to claim; claim stores
+// the link under code and reports false when the code is already in use
+// (for example by a custom alias), in which case allocation skips forward.
+func allocateCode(ctx context.Context, next func(ctx context.Context) (int64, error), claim func(ctx context.Context, code string) (bool, error)) (string, error) {
+	for attempt := 0; attempt < maxAllocationAttempts; attempt++ {
+		id, err := next(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to increment counter: %w", err)
+		}
+
+		code := EncodeBase62(id)
+		if IsReserved(code) {
+			continue
+		}
+
+		claimed, err := claim(ctx, code)
+		if err != nil {
+			return "", fmt.Errorf("failed to store URL: %w", err)
+		}
+		if claimed {
+			return code, nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to allocate a free short code after %d attempts", maxAllocationAttempts)
+}
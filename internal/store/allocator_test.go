@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestAllocateCode(t *testing.T) {
+	apiID, err := DecodeBase62("api")
+	if err != nil {
+		t.Fatalf("DecodeBase62() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		start    int64
+		taken    map[string]bool
+		want     string
+		wantErr  bool
+		wantNext int
+	}{
+		{
+			name:     "free code is used as is",
+			start:    1,
+			want:     "1",
+			wantNext: 1,
+		},
+		{
+			name:     "reserved code is skipped",
+			start:    apiID,
+			want:     EncodeBase62(apiID + 1),
+			wantNext: 2,
+		},
+		{
+			name:     "code claimed by an alias is skipped",
+			start:    apiID + 1,
+			taken:    map[string]bool{EncodeBase62(apiID + 1): true, EncodeBase62(apiID + 2): true},
+			want:     EncodeBase62(apiID + 3),
+			wantNext: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := tt.start - 1
+			calls := 0
+			next := func(context.Context) (int64, error) {
+				calls++
+				counter++
+				return counter, nil
+			}
+			claim := func(_ context.Context, code string) (bool, error) {
+				if IsReserved(code) {
+					t.Errorf("claim() offered reserved code %q", code)
+				}
+				return !tt.taken[code], nil
+			}
+
+			got, err := allocateCode(context.Background(), next, claim)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("allocateCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("allocateCode() = %q, want %q", got, tt.want)
+			}
+			if calls != tt.wantNext {
+				t.Errorf("allocateCode() drew %d counter values, want %d", calls, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestAllocateCodeGivesUp(t *testing.T) {
+	var counter int64
+	next := func(context.Context) (int64, error) {
+		counter++
+		return counter, nil
+	}
+	claim := func(context.Context, string) (bool, error) {
+		return false, nil
+	}
+
+	if _, err := allocateCode(context.Background(), next, claim); err == nil {
+		t.Error("allocateCode() expected error when every code is taken")
+	}
+	if counter != maxAllocationAttempts {
+		t.Errorf("allocateCode() drew %d counter values, want %d", counter, maxAllocationAttempts)
+	}
+}
+
+func TestGeneratedCodesAvoidReservedWordsAndAliases(t *testing.T) {
+	healthID, err := DecodeBase62("health")
+	if err != nil {
+		t.Fatalf("DecodeBase62() error = %v", err)
+	}
+	afterHealth := EncodeBase62(healthID + 1)
+
+	backends := []struct {
+		name string
+		// setup returns a store whose url_counter is positioned so the next generated code is "health"
+		setup func(t *testing.T) Store
+	}{
+		{
+			name: "redis",
+			setup: func(t *testing.T) Store {
+				store := setupTestRedis(t)
+				if err := store.client.Set(context.Background(), "url_counter", healthID-1, 0).Err(); err != nil {
+					t.Fatalf("Failed to seed counter: %v", err)
+				}
+				return store
+			},
+		},
+		{
+			name: "memory",
+			setup: func(t *testing.T) Store {
+				store := setupTestMemory(t)
+				store.counter = healthID - 1
+				return store
+			},
+		},
+		{
+			name: "sqlite",
+			setup: func(t *testing.T) Store {
+				store := setupTestSQLite(t)
+				if _, err := store.db.Exec(`INSERT INTO counters (name, value) VALUES ('url_counter', ?)`, healthID-1); err != nil {
+					t.Fatalf("Failed to seed counter: %v", err)
+				}
+				return store
+			},
+		},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			store := b.setup(t)
+			ctx := context.Background()
+
+			// Someone already claimed the code right after the reserved word as an alias
+			if _, err := store.CreateShortURL(ctx, "https://example.com/alias", CreateOptions{Alias: afterHealth}); err != nil {
+				t.Fatalf("CreateShortURL() alias error = %v", err)
+			}
+
+			shortURL, err := store.CreateShortURL(ctx, "https://example.com/generated", CreateOptions{})
+			if err != nil {
+				t.Fatalf("CreateShortURL() error = %v", err)
+			}
+			code := shortURL[len(os.Getenv("SHORTENME_URL"))+1:]
+
+			if want := EncodeBase62(healthID + 2); code != want {
+				t.Errorf("generated code = %q, want %q", code, want)
+			}
+
+			// The alias must still point at its own destination
+			if got, err := store.GetOriginalURL(ctx, afterHealth); err != nil || got != "https://example.com/alias" {
+				t.Errorf("GetOriginalURL(%q) = %q, %v, want https://example.com/alias", afterHealth, got, err)
+			}
+		})
+	}
+}
+
+func TestDecodeBase62(t *testing.T) {
+	for _, n := range []int64{0, 1, 61, 62, 3843, 1 << 40} {
+		got, err := DecodeBase62(EncodeBase62(n))
+		if err != nil || got != n {
+			t.Errorf("DecodeBase62(EncodeBase62(%d)) = %d, %v", n, got, err)
+		}
+	}
+
+	if _, err := DecodeBase62("no-dash"); err == nil {
+		t.Error("DecodeBase62() expected error for invalid character")
+	}
+}
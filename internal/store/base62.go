@@ -1,5 +1,10 @@
 package store
 
+import (
+	"fmt"
+	"strings"
+)
+
 const (
 	base62Chars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 )
@@ -17,3 +22,20 @@ func EncodeBase62(num int64) string {
 	}
 	return string(result)
 }
+
+// DecodeBase62 converts a base62 string back to the number it encodes
+func DecodeBase62(s string) (int64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty base62 string")
+	}
+
+	var num int64
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(base62Chars, s[i])
+		if digit < 0 {
+			return 0, fmt.Errorf("invalid base62 character %q", s[i])
+		}
+		num = num*62 + int64(digit)
+	}
+	return num, nil
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidBucketSize is returned when counting clicks in buckets other than a minute, an hour or a day
+var ErrInvalidBucketSize = errors.New("bucket size must be a minute, an hour or a day")
+
+// ClickEvent records one redirect of a link
+type ClickEvent struct {
+	Code string `json:"code"`
+	// Timestamp is set by the store when the click is counted
+	Timestamp      time.Time `json:"timestamp"`
+	Referrer       string    `json:"referrer,omitempty"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	AcceptLanguage string    `json:"accept_language,omitempty"`
+	// IP is the visitor's address with its host bits zeroed
+	IP string `json:"ip,omitempty"`
+	// Visitor is a hash identifying the visitor, counted towards the link's unique visitors
+	// for the day but not kept in the click log
+	Visitor string `json:"-"`
+}
+
+// ClickCount is the number of clicks of a link in the bucket starting at Start
+type ClickCount struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+}
+
+// clickBucketNames are the bucket sizes clicks are counted in, named as Redis keeps them
+var clickBucketNames = map[time.Duration]string{
+	time.Minute:    "minute",
+	time.Hour:      "hour",
+	24 * time.Hour: "day",
+}
+
+// clickBuckets returns the empty buckets of size from the one holding from up to to, aligned to UTC
+func clickBuckets(from, to time.Time, size time.Duration) ([]ClickCount, error) {
+	if _, ok := clickBucketNames[size]; !ok {
+		return nil, ErrInvalidBucketSize
+	}
+	start := from.UTC().Truncate(size)
+	var buckets []ClickCount
+	for t := start; t.Before(to); t = t.Add(size) {
+		buckets = append(buckets, ClickCount{Start: t})
+	}
+	return buckets, nil
+}
+
+// inRange reports whether t is within [from, to), a zero bound leaving that side open
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+// DailyVisitors is the number of unique visitors to a link on the UTC day starting at Day
+type DailyVisitors struct {
+	Day      time.Time `json:"day"`
+	Visitors int64     `json:"visitors"`
+}
+
+// UniqueVisitors counts the distinct visitors of a link, which Redis only approximates
+type UniqueVisitors struct {
+	// Total is the number of distinct visitors across all of Days
+	Total int64 `json:"total"`
+	// Days lists the days with any visitors, oldest first
+	Days []DailyVisitors `json:"days"`
+}
+
+// visitorDay is the start of the UTC day holding t, the granularity unique visitors are counted at
+func visitorDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// visitorDaysFrom widens a from bound to the start of its day, so every day overlapping a range is counted
+func visitorDaysFrom(from time.Time) time.Time {
+	if from.IsZero() {
+		return from
+	}
+	return visitorDay(from)
+}
@@ -0,0 +1,20 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/yingtu35/ShortenMe/internal/store"
+	"github.com/yingtu35/ShortenMe/internal/store/storetest"
+)
+
+func TestRedisStoreConformance(t *testing.T) {
+	storetest.Run(t, store.NewTestRedis)
+}
+
+func TestMemoryStoreConformance(t *testing.T) {
+	storetest.Run(t, store.NewTestMemory)
+}
+
+func TestSQLiteStoreConformance(t *testing.T) {
+	storetest.Run(t, store.NewTestSQLite)
+}
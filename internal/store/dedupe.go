@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrDedupeConflict is returned when reuse is requested together with options that make a link unique
+var ErrDedupeConflict = errors.New("dedupe cannot be combined with an alias, expiry, click limit or password")
+
+// dedupeBackend is what createOrReuse needs from a backend: its reverse index from
+// normalized destination to code, and a way to create links without formatting the short URL
+type dedupeBackend interface {
+	GetURLData(ctx context.Context, shortURL string) (*URLData, error)
+	createLink(ctx context.Context, originalURL string, opts CreateOptions) (string, error)
+	// lookupDedupe returns the code or claim recorded under key, or "" if there is none
+	lookupDedupe(ctx context.Context, key string) (string, error)
+	// swapDedupe atomically records next under key if old is still recorded there and reports
+	// whether it did. An empty old means no entry; an empty next removes the entry.
+	swapDedupe(ctx context.Context, key, old, next string) (bool, error)
+}
+
+const (
+	// dedupeClaimPrefix marks an entry claimed by a request still creating its link
+	dedupeClaimPrefix = "claim:"
+	// dedupeClaimTimeout is how long a claim holds before another request may take it over,
+	// in case the request holding it died
+	dedupeClaimTimeout = 10 * time.Second
+	// dedupeClaimPoll is how often a request waiting on another's claim looks again
+	dedupeClaimPoll = 20 * time.Millisecond
+)
+
+// fullShortURL turns a code into the short URL handed back to callers
+func fullShortURL(code string) string {
+	return os.Getenv("SHORTENME_URL") + "/" + code
+}
+
+// createOrReuse implements CreateOrReuseShortURL for every backend. A request that finds no
+// usable link claims the index entry before creating one, so concurrent first requests for a
+// destination wait for the one that won the claim and reuse its link.
+func createOrReuse(ctx context.Context, b dedupeBackend, originalURL string, opts CreateOptions) (string, bool, error) {
+	if opts.Alias != "" || opts.ExpiresIn != 0 || !opts.ExpiresAt.IsZero() || opts.MaxClicks != 0 || opts.Password != "" {
+		return "", false, ErrDedupeConflict
+	}
+	if originalURL == "" {
+		return "", false, fmt.Errorf("original URL is required")
+	}
+
+	normalized := normalizeForDedupe(originalURL)
+	key := dedupeKey(opts.DedupeScope, normalized)
+
+	for {
+		current, err := b.lookupDedupe(ctx, key)
+		if err != nil {
+			return "", false, err
+		}
+
+		if deadline, ok := parseDedupeClaim(current); ok {
+			if time.Now().Before(deadline) {
+				select {
+				case <-ctx.Done():
+					return "", false, ctx.Err()
+				case <-time.After(dedupeClaimPoll):
+				}
+				continue
+			}
+		} else if current != "" {
+			urlData, err := b.GetURLData(ctx, current)
+			if err != nil {
+				return "", false, err
+			}
+			// Links that were deleted, disabled or pointed elsewhere since are not handed out again
+			if urlData != nil && urlData.IsActive() && normalizeForDedupe(urlData.OriginalURL) == normalized {
+				return fullShortURL(current), false, nil
+			}
+		}
+
+		claim, err := newDedupeClaim()
+		if err != nil {
+			return "", false, err
+		}
+		claimed, err := b.swapDedupe(ctx, key, current, claim)
+		if err != nil {
+			return "", false, err
+		}
+		if !claimed {
+			// Another request changed the entry first; look at what it recorded
+			continue
+		}
+
+		code, err := b.createLink(ctx, originalURL, opts)
+		if err != nil {
+			// Hand the entry back so waiting requests do not sit out the claim timeout
+			if _, releaseErr := b.swapDedupe(context.WithoutCancel(ctx), key, claim, current); releaseErr != nil {
+				return "", false, errors.Join(err, releaseErr)
+			}
+			return "", false, err
+		}
+		// If the claim timed out and was taken over, the link is still ours but not the one reused
+		if _, err := b.swapDedupe(ctx, key, claim, code); err != nil {
+			return "", false, err
+		}
+
+		return fullShortURL(code), true, nil
+	}
+}
+
+// newDedupeClaim returns a claim on an index entry that holds until dedupeClaimTimeout from now
+func newDedupeClaim() (string, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate claim: %w", err)
+	}
+	deadline := time.Now().Add(dedupeClaimTimeout).UnixNano()
+	return dedupeClaimPrefix + strconv.FormatInt(deadline, 10) + ":" + hex.EncodeToString(nonce), nil
+}
+
+// parseDedupeClaim returns when the claim in entry stops holding, if entry is a claim
+func parseDedupeClaim(entry string) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(entry, dedupeClaimPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	deadline, _, _ := strings.Cut(rest, ":")
+	ns, err := strconv.ParseInt(deadline, 10, 64)
+	if err != nil {
+		return time.Time{}, true
+	}
+	return time.Unix(0, ns), true
+}
+
+// normalizeForDedupe returns the form destinations are compared in: scheme and host
+// lowercased, since they are case-insensitive. Anything unparseable is compared as is.
+func normalizeForDedupe(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u.String()
+}
+
+// dedupeKey names the reverse index entry for a normalized destination within a scope.
+// Hashing keeps keys short however long the URL is.
+func dedupeKey(scope, normalizedURL string) string {
+	sum := sha256.Sum256([]byte(scope + "\n" + normalizedURL))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,28 @@
+package store
+
+import "testing"
+
+// The constructors below expose the per-backend test setup to the external
+// store_test package, which cannot import storetest from inside package store
+// without a cycle.
+
+// NewTestRedis returns an empty RedisStore on the test database that reads time from clock
+func NewTestRedis(t *testing.T, clock TimeProvider) Store {
+	store := setupTestRedis(t)
+	store.timeProvider = clock
+	return store
+}
+
+// NewTestMemory returns an empty MemoryStore that reads time from clock
+func NewTestMemory(t *testing.T, clock TimeProvider) Store {
+	store := setupTestMemory(t)
+	store.timeProvider = clock
+	return store
+}
+
+// NewTestSQLite returns an empty SQLiteStore in a temporary file that reads time from clock
+func NewTestSQLite(t *testing.T, clock TimeProvider) Store {
+	store := setupTestSQLite(t)
+	store.timeProvider = clock
+	return store
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListLimit is the page size used when ListOptions.Limit is not set
+	DefaultListLimit = 50
+	// MaxListLimit is the largest page ListLinks returns
+	MaxListLimit = 500
+)
+
+// ErrInvalidCursor is returned when a ListLinks cursor was not produced by a previous page
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListOptions select and page through links, newest first. Zero values mean no filter.
+type ListOptions struct {
+	// Cursor continues after the last link of a previous page; empty starts from the newest link
+	Cursor string
+	// Limit is the page size, DefaultListLimit if zero and at most MaxListLimit
+	Limit int
+
+	// CreatedAfter and CreatedBefore bound the creation time, inclusive
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// MinClicks and MaxClicks bound the click count, inclusive
+	MinClicks *int64
+	MaxClicks *int64
+	// Host only matches links whose destination host equals it, ignoring case
+	Host string
+	// Status only matches links in that status
+	Status LinkStatus
+	// Tag only matches links carrying that tag, compared in normalized form
+	Tag string
+}
+
+// LinkRecord is a stored link together with its short code
+type LinkRecord struct {
+	Code string `json:"code"`
+	URLData
+}
+
+// LinkPage is one page of ListLinks results
+type LinkPage struct {
+	Links []LinkRecord
+	// NextCursor fetches the following page; it is empty on the last page
+	NextCursor string
+}
+
+// limit returns the page size to use
+func (o ListOptions) limit() int {
+	return pageSize(o.Limit)
+}
+
+// pageSize applies DefaultListLimit and MaxListLimit to a requested number of results
+func pageSize(n int) int {
+	switch {
+	case n <= 0:
+		return DefaultListLimit
+	case n > MaxListLimit:
+		return MaxListLimit
+	default:
+		return n
+	}
+}
+
+// matches reports whether a link passes every filter in o
+func (o ListOptions) matches(d URLData) bool {
+	if !o.CreatedAfter.IsZero() && d.CreatedAt.Before(o.CreatedAfter) {
+		return false
+	}
+	if !o.CreatedBefore.IsZero() && d.CreatedAt.After(o.CreatedBefore) {
+		return false
+	}
+	if o.MinClicks != nil && d.ClickCount < *o.MinClicks {
+		return false
+	}
+	if o.MaxClicks != nil && d.ClickCount > *o.MaxClicks {
+		return false
+	}
+	if o.Status != "" && d.Status != o.Status {
+		return false
+	}
+	if o.Tag != "" && !d.HasTag(o.Tag) {
+		return false
+	}
+	if o.Host != "" {
+		u, err := url.Parse(d.OriginalURL)
+		if err != nil || !strings.EqualFold(u.Hostname(), o.Host) {
+			return false
+		}
+	}
+	return true
+}
+
+// listCursor is the position of a link in newest-first order
+type listCursor struct {
+	createdAt int64 // Unix nanoseconds
+	code      string
+}
+
+// encodeCursor returns the opaque cursor pointing just after rec
+func encodeCursor(rec LinkRecord) string {
+	raw := strconv.FormatInt(rec.CreatedAt.UnixNano(), 10) + ":" + rec.Code
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor from encodeCursor; an empty cursor gives ok == false
+func decodeCursor(cursor string) (c listCursor, ok bool, err error) {
+	if cursor == "" {
+		return listCursor{}, false, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return listCursor{}, false, ErrInvalidCursor
+	}
+	createdAt, code, found := strings.Cut(string(raw), ":")
+	if !found || code == "" {
+		return listCursor{}, false, ErrInvalidCursor
+	}
+	c.createdAt, err = strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return listCursor{}, false, ErrInvalidCursor
+	}
+	c.code = code
+
+	return c, true, nil
+}
+
+// after reports whether rec comes after the cursor in newest-first order
+func (c listCursor) after(rec LinkRecord) bool {
+	createdAt := rec.CreatedAt.UnixNano()
+	return createdAt < c.createdAt || (createdAt == c.createdAt && rec.Code < c.code)
+}
+
+// sortNewestFirst orders records the way ListLinks returns them
+func sortNewestFirst(records []LinkRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.Code > b.Code
+	})
+}
+
+// newLinkPage returns the first limit records, with a cursor to the rest if there are more
+func newLinkPage(records []LinkRecord, limit int) LinkPage {
+	var page LinkPage
+	if len(records) > limit {
+		records = records[:limit]
+		page.NextCursor = encodeCursor(records[limit-1])
+	}
+	page.Links = records
+	return page
+}
@@ -0,0 +1,583 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a thread-safe, in-process Store intended for local development and tests.
+// All data is lost when the process exits.
+type MemoryStore struct {
+	mu           sync.Mutex
+	counter      int64
+	urls         map[string]URLData
+	history      map[string][]DestinationChange
+	dedupe       map[string]string
+	policy       string
+	reports      map[string][]Report
+	clicks       map[string][]ClickEvent
+	visitors     map[string]map[time.Time]map[string]struct{}
+	timeProvider TimeProvider
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		urls:         make(map[string]URLData),
+		history:      make(map[string][]DestinationChange),
+		dedupe:       make(map[string]string),
+		reports:      make(map[string][]Report),
+		clicks:       make(map[string][]ClickEvent),
+		visitors:     make(map[string]map[time.Time]map[string]struct{}),
+		timeProvider: DefaultTimeProvider{},
+	}
+}
+
+func (s *MemoryStore) CreateShortURL(ctx context.Context, originalURL string, opts CreateOptions) (string, error) {
+	code, err := s.createLink(ctx, originalURL, opts)
+	if err != nil {
+		return "", err
+	}
+	return fullShortURL(code), nil
+}
+
+func (s *MemoryStore) CreateOrReuseShortURL(ctx context.Context, originalURL string, opts CreateOptions) (string, bool, error) {
+	return createOrReuse(ctx, s, originalURL, opts)
+}
+
+// createLink stores a new link and returns its code
+func (s *MemoryStore) createLink(ctx context.Context, originalURL string, opts CreateOptions) (string, error) {
+	urlData, err := newURLData(originalURL, opts, s.timeProvider.Now())
+	if err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	claim := func(_ context.Context, code string) (bool, error) {
+		if _, taken := s.urls[code]; taken {
+			return false, nil
+		}
+		s.urls[code] = urlData
+		s.history[code] = []DestinationChange{{
+			Version:     1,
+			OriginalURL: urlData.OriginalURL,
+			ChangedAt:   urlData.CreatedAt,
+			Actor:       ActorCreator,
+		}}
+		return true, nil
+	}
+
+	shortURL := opts.Alias
+	if shortURL != "" {
+		if claimed, _ := claim(ctx, shortURL); !claimed {
+			return "", ErrAliasTaken
+		}
+	} else {
+		// Mirror Redis INCR semantics so codes match across backends
+		shortURL, err = allocateCode(ctx,
+			func(context.Context) (int64, error) {
+				s.counter++
+				return s.counter, nil
+			},
+			claim,
+		)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return shortURL, nil
+}
+
+func (s *MemoryStore) lookupDedupe(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dedupe[key], nil
+}
+
+func (s *MemoryStore) swapDedupe(ctx context.Context, key, old, next string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dedupe[key] != old {
+		return false, nil
+	}
+	if next == "" {
+		delete(s.dedupe, key)
+	} else {
+		s.dedupe[key] = next
+	}
+	return true, nil
+}
+
+func (s *MemoryStore) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
+	return s.FollowLink(ctx, shortURL, ClickEvent{})
+}
+
+func (s *MemoryStore) FollowLink(ctx context.Context, shortURL string, click ClickEvent) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urlData, ok := s.urls[shortURL]
+	if !ok {
+		return "", nil
+	}
+	if err := urlData.statusError(); err != nil {
+		return "", err
+	}
+	now := s.timeProvider.Now()
+	if urlData.isExpired(now) {
+		return "", ErrLinkExpired
+	}
+	if urlData.clickLimitReached() {
+		return "", ErrClickLimitReached
+	}
+
+	urlData.ClickCount++
+	s.urls[shortURL] = urlData
+
+	if click.Visitor != "" {
+		days := s.visitors[shortURL]
+		if days == nil {
+			days = make(map[time.Time]map[string]struct{})
+			s.visitors[shortURL] = days
+		}
+		day := visitorDay(now)
+		if days[day] == nil {
+			days[day] = make(map[string]struct{})
+		}
+		days[day][click.Visitor] = struct{}{}
+	}
+
+	click.Code = shortURL
+	click.Timestamp = now
+	click.Visitor = ""
+	s.clicks[shortURL] = append(s.clicks[shortURL], click)
+
+	return urlData.OriginalURL, nil
+}
+
+func (s *MemoryStore) ListClickEvents(ctx context.Context, shortURL string, from, to time.Time) ([]ClickEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []ClickEvent
+	for _, event := range s.clicks[shortURL] {
+		if inRange(event.Timestamp, from, to) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *MemoryStore) CountClicks(ctx context.Context, shortURL string, from, to time.Time, size time.Duration) ([]ClickCount, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	buckets, err := clickBuckets(from, to, size)
+	if err != nil || len(buckets) == 0 {
+		return buckets, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := buckets[0].Start
+	for _, event := range s.clicks[shortURL] {
+		if inRange(event.Timestamp, start, to) {
+			buckets[event.Timestamp.Sub(start)/size].Clicks++
+		}
+	}
+	return buckets, nil
+}
+
+func (s *MemoryStore) PurgeClickEvents(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for code, events := range s.clicks {
+		// Events are appended in time order, so the expired ones are a prefix
+		n := 0
+		for n < len(events) && events[n].Timestamp.Before(before) {
+			n++
+		}
+		if n == len(events) {
+			delete(s.clicks, code)
+		} else if n > 0 {
+			s.clicks[code] = slices.Clone(events[n:])
+		}
+		purged += int64(n)
+	}
+
+	for code, days := range s.visitors {
+		for day := range days {
+			if !day.Add(24 * time.Hour).After(before) {
+				delete(days, day)
+			}
+		}
+		if len(days) == 0 {
+			delete(s.visitors, code)
+		}
+	}
+
+	return purged, nil
+}
+
+func (s *MemoryStore) GetUniqueVisitors(ctx context.Context, shortURL string, from, to time.Time) (UniqueVisitors, error) {
+	if err := ctx.Err(); err != nil {
+		return UniqueVisitors{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var counts UniqueVisitors
+	all := make(map[string]struct{})
+	from = visitorDaysFrom(from)
+	for day, visitors := range s.visitors[shortURL] {
+		if !inRange(day, from, to) {
+			continue
+		}
+		counts.Days = append(counts.Days, DailyVisitors{Day: day, Visitors: int64(len(visitors))})
+		for visitor := range visitors {
+			all[visitor] = struct{}{}
+		}
+	}
+	slices.SortFunc(counts.Days, func(a, b DailyVisitors) int {
+		return a.Day.Compare(b.Day)
+	})
+	counts.Total = int64(len(all))
+	return counts, nil
+}
+
+func (s *MemoryStore) GetClickCount(ctx context.Context, shortURL string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urlData, ok := s.urls[shortURL]
+	if !ok {
+		return -1, nil
+	}
+
+	return urlData.ClickCount, nil
+}
+
+func (s *MemoryStore) GetURLData(ctx context.Context, shortURL string) (*URLData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urlData, ok := s.urls[shortURL]
+	if !ok {
+		return nil, nil
+	}
+
+	return &urlData, nil
+}
+
+func (s *MemoryStore) UpdateLink(ctx context.Context, shortURL string, update LinkUpdate) error {
+	if err := validateLinkUpdate(update); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urlData, ok := s.urls[shortURL]
+	if !ok {
+		return ErrLinkNotFound
+	}
+	if update.OriginalURL != nil {
+		urlData.OriginalURL = *update.OriginalURL
+		s.history[shortURL] = append(s.history[shortURL], DestinationChange{
+			Version:     len(s.history[shortURL]) + 1,
+			OriginalURL: *update.OriginalURL,
+			ChangedAt:   s.timeProvider.Now(),
+			Actor:       update.Actor,
+		})
+	}
+	s.urls[shortURL] = urlData
+
+	return nil
+}
+
+func (s *MemoryStore) SetLinkStatus(ctx context.Context, shortURL string, status LinkStatus) error {
+	if !status.Valid() {
+		return ErrInvalidStatus
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urlData, ok := s.urls[shortURL]
+	if !ok {
+		return ErrLinkNotFound
+	}
+	urlData.Status = status
+	urlData.DeletedAt = time.Time{}
+	if status == StatusDeleted {
+		urlData.DeletedAt = s.timeProvider.Now()
+	}
+	s.urls[shortURL] = urlData
+
+	return nil
+}
+
+func (s *MemoryStore) RestoreLink(ctx context.Context, shortURL string, retention time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urlData, ok := s.urls[shortURL]
+	if !ok {
+		return ErrLinkNotFound
+	}
+	if err := urlData.restoreError(s.timeProvider.Now(), retention); err != nil {
+		return err
+	}
+	urlData.Status = StatusActive
+	urlData.DeletedAt = time.Time{}
+	s.urls[shortURL] = urlData
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteLink(ctx context.Context, shortURL string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.urls[shortURL]; !ok {
+		return ErrLinkNotFound
+	}
+	delete(s.urls, shortURL)
+	delete(s.history, shortURL)
+	delete(s.reports, shortURL)
+	delete(s.clicks, shortURL)
+	delete(s.visitors, shortURL)
+
+	return nil
+}
+
+func (s *MemoryStore) PurgeDeletedLinks(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for code, urlData := range s.urls {
+		if urlData.Status == StatusDeleted && !urlData.DeletedAt.After(deletedBefore) {
+			delete(s.urls, code)
+			delete(s.history, code)
+			delete(s.reports, code)
+			delete(s.clicks, code)
+			delete(s.visitors, code)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (s *MemoryStore) ListLinks(ctx context.Context, opts ListOptions) (LinkPage, error) {
+	cursor, hasCursor, err := decodeCursor(opts.Cursor)
+	if err != nil {
+		return LinkPage{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return LinkPage{}, err
+	}
+
+	s.mu.Lock()
+	records := make([]LinkRecord, 0, len(s.urls))
+	for code, urlData := range s.urls {
+		rec := LinkRecord{Code: code, URLData: urlData}
+		if (!hasCursor || cursor.after(rec)) && opts.matches(urlData) {
+			records = append(records, rec)
+		}
+	}
+	s.mu.Unlock()
+
+	sortNewestFirst(records)
+
+	return newLinkPage(records, opts.limit()), nil
+}
+
+// SearchLinks matches every link against the query; the memory store keeps no index
+func (s *MemoryStore) SearchLinks(ctx context.Context, opts SearchOptions) ([]LinkRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	query := searchTokens(opts.Query)
+	if len(query) == 0 {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	var records []LinkRecord
+	for code, urlData := range s.urls {
+		if matchesSearch(searchTerms(code, urlData), query) {
+			records = append(records, LinkRecord{Code: code, URLData: urlData})
+		}
+	}
+	s.mu.Unlock()
+
+	sortNewestFirst(records)
+	if limit := opts.limit(); len(records) > limit {
+		records = records[:limit]
+	}
+
+	return records, nil
+}
+
+func (s *MemoryStore) GetLinkHistory(ctx context.Context, shortURL string) ([]DestinationChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.urls[shortURL]; !ok {
+		return nil, nil
+	}
+
+	// Copy so callers cannot modify the stored history
+	return append([]DestinationChange{}, s.history[shortURL]...), nil
+}
+
+func (s *MemoryStore) GetPolicyDocument(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.policy, nil
+}
+
+func (s *MemoryStore) SavePolicyDocument(ctx context.Context, document string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = document
+	return nil
+}
+
+func (s *MemoryStore) AddReport(ctx context.Context, shortURL string, report Report) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.urls[shortURL]; !ok {
+		return 0, ErrLinkNotFound
+	}
+	reports := s.reports[shortURL]
+	for _, open := range reports {
+		if open.Reporter == report.Reporter {
+			return int64(len(reports)), nil
+		}
+	}
+
+	report.CreatedAt = s.timeProvider.Now()
+	s.reports[shortURL] = append(reports, report)
+	return int64(len(reports) + 1), nil
+}
+
+func (s *MemoryStore) ListReportedLinks(ctx context.Context, limit int) ([]ReportedLink, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	links := make([]ReportedLink, 0, len(s.reports))
+	for code, reports := range s.reports {
+		links = append(links, ReportedLink{Code: code, Reports: slices.Clone(reports)})
+	}
+	s.mu.Unlock()
+
+	sortReportedLinks(links)
+	if size := pageSize(limit); len(links) > size {
+		links = links[:size]
+	}
+	return links, nil
+}
+
+func (s *MemoryStore) ClearReports(ctx context.Context, shortURL string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cleared := len(s.reports[shortURL])
+	delete(s.reports, shortURL)
+	return int64(cleared), nil
+}
+
+// Ping only fails if ctx is already done as there is no connection to check
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Close is a no-op; it exists so MemoryStore satisfies Backend
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setupTestMemory creates a new in-memory store with a fixed clock
+func setupTestMemory(t *testing.T) *MemoryStore {
+	t.Helper()
+
+	store := NewMemoryStore()
+	store.timeProvider = &mockTimeProvider{now: time.Now()}
+
+	return store
+}
+
+func TestMemoryCreateShortURL(t *testing.T) {
+	store := setupTestMemory(t)
+
+	tests := []struct {
+		name        string
+		originalURL string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "first URL gets the first counter value",
+			originalURL: "https://example.com",
+			want:        os.Getenv("SHORTENME_URL") + "/1",
+			wantErr:     false,
+		},
+		{
+			name:        "second URL gets the next counter value",
+			originalURL: "https://example.org",
+			want:        os.Getenv("SHORTENME_URL") + "/2",
+			wantErr:     false,
+		},
+		{
+			name:        "empty URL",
+			originalURL: "",
+			want:        "",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.CreateShortURL(context.Background(), tt.originalURL, CreateOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateShortURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("CreateShortURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryGetOriginalURLAndClickCount(t *testing.T) {
+	store := setupTestMemory(t)
+
+	originalURL := "https://example.com"
+	shortURL, err := store.CreateShortURL(context.Background(), originalURL, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+	shortCode := shortURL[len(os.Getenv("SHORTENME_URL"))+1:]
+
+	for i := 0; i < 3; i++ {
+		got, err := store.GetOriginalURL(context.Background(), shortCode)
+		if err != nil {
+			t.Fatalf("GetOriginalURL() error = %v", err)
+		}
+		if got != originalURL {
+			t.Errorf("GetOriginalURL() = %v, want %v", got, originalURL)
+		}
+	}
+
+	if got, err := store.GetClickCount(context.Background(), shortCode); err != nil || got != 3 {
+		t.Errorf("GetClickCount() = %v, %v, want 3, <nil>", got, err)
+	}
+
+	if got, err := store.GetOriginalURL(context.Background(), "nonexistent"); err != nil || got != "" {
+		t.Errorf("GetOriginalURL(nonexistent) = %q, %v, want \"\", <nil>", got, err)
+	}
+	if got, err := store.GetClickCount(context.Background(), "nonexistent"); err != nil || got != -1 {
+		t.Errorf("GetClickCount(nonexistent) = %v, %v, want -1, <nil>", got, err)
+	}
+}
+
+func TestMemoryConcurrentClicks(t *testing.T) {
+	store := setupTestMemory(t)
+
+	shortURL, err := store.CreateShortURL(context.Background(), "https://example.com", CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+	shortCode := shortURL[len(os.Getenv("SHORTENME_URL"))+1:]
+
+	const clicks = 100
+	var wg sync.WaitGroup
+	for i := 0; i < clicks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.GetOriginalURL(context.Background(), shortCode); err != nil {
+				t.Errorf("GetOriginalURL() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, err := store.GetClickCount(context.Background(), shortCode); err != nil || got != clicks {
+		t.Errorf("GetClickCount() = %v, %v, want %v, <nil>", got, err, clicks)
+	}
+}
+
+func TestMemoryPing(t *testing.T) {
+	store := setupTestMemory(t)
+
+	if err := store.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+}
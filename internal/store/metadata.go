@@ -0,0 +1,102 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxTags                = 20
+	maxTagLength           = 50
+	maxTitleLength         = 200
+	maxDescriptionLength   = 1000
+	maxMetadataEntries     = 20
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 500
+)
+
+var (
+	// ErrInvalidTags is returned when a link's tags fail validation
+	ErrInvalidTags = errors.New("invalid tags")
+	// ErrInvalidMetadata is returned when a link's title, description or metadata fail validation
+	ErrInvalidMetadata = errors.New("invalid metadata")
+)
+
+// NormalizeTag returns the form a tag is stored and matched in: trimmed and lowercase
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags validates tags and returns them normalized, in their original order without duplicates
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidTags, maxTags)
+	}
+
+	var normalized []string
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" {
+			return nil, fmt.Errorf("%w: tags must not be empty", ErrInvalidTags)
+		}
+		if err := checkText(tag, maxTagLength); err != nil {
+			return nil, fmt.Errorf("%w: tag %q %v", ErrInvalidTags, tag, err)
+		}
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// validateMetadata checks the free-form descriptive fields of a link
+func validateMetadata(title, description string, metadata map[string]string) error {
+	if err := checkText(title, maxTitleLength); err != nil {
+		return fmt.Errorf("%w: title %v", ErrInvalidMetadata, err)
+	}
+	if err := checkText(description, maxDescriptionLength); err != nil {
+		return fmt.Errorf("%w: description %v", ErrInvalidMetadata, err)
+	}
+
+	if len(metadata) > maxMetadataEntries {
+		return fmt.Errorf("%w: at most %d metadata entries are allowed", ErrInvalidMetadata, maxMetadataEntries)
+	}
+	for key, value := range metadata {
+		if key == "" {
+			return fmt.Errorf("%w: metadata keys must not be empty", ErrInvalidMetadata)
+		}
+		if err := checkText(key, maxMetadataKeyLength); err != nil {
+			return fmt.Errorf("%w: metadata key %q %v", ErrInvalidMetadata, key, err)
+		}
+		if err := checkText(value, maxMetadataValueLength); err != nil {
+			return fmt.Errorf("%w: metadata value of %q %v", ErrInvalidMetadata, key, err)
+		}
+	}
+	return nil
+}
+
+// checkText rejects text that is too long or is not printable UTF-8.
+// Newlines and tabs are allowed so descriptions can span lines.
+func checkText(text string, maxLength int) error {
+	if !utf8.ValidString(text) {
+		return errors.New("must be valid UTF-8")
+	}
+	if utf8.RuneCountInString(text) > maxLength {
+		return fmt.Errorf("must be at most %d characters", maxLength)
+	}
+	for _, r := range text {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return errors.New("must not contain control characters")
+		}
+	}
+	return nil
+}
+
+// HasTag reports whether the link carries tag, compared in normalized form
+func (d URLData) HasTag(tag string) bool {
+	return slices.Contains(d.Tags, NormalizeTag(tag))
+}
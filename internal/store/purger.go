@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Purger periodically and permanently removes soft-deleted links once their retention period has passed,
+// along with click events older than their own retention period
+type Purger struct {
+	store          Store
+	retention      time.Duration
+	clickRetention time.Duration
+	interval       time.Duration
+	timeProvider   TimeProvider
+}
+
+// NewPurger returns a Purger that checks s every interval for links deleted more than retention ago
+// and click events recorded more than clickRetention ago. A zero clickRetention keeps click events forever.
+func NewPurger(s Store, retention, clickRetention, interval time.Duration) *Purger {
+	return &Purger{
+		store:          s,
+		retention:      retention,
+		clickRetention: clickRetention,
+		interval:       interval,
+		timeProvider:   DefaultTimeProvider{},
+	}
+}
+
+// PurgeOnce removes every link deleted more than the retention period ago
+func (p *Purger) PurgeOnce(ctx context.Context) (int64, error) {
+	return p.store.PurgeDeletedLinks(ctx, p.timeProvider.Now().Add(-p.retention))
+}
+
+// PurgeClickEventsOnce removes every click event recorded more than the click retention period ago
+func (p *Purger) PurgeClickEventsOnce(ctx context.Context) (int64, error) {
+	if p.clickRetention <= 0 {
+		return 0, nil
+	}
+	return p.store.PurgeClickEvents(ctx, p.timeProvider.Now().Add(-p.clickRetention))
+}
+
+// Run purges once per interval until ctx is done
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := p.PurgeOnce(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Failed to purge deleted links: %v", err)
+				}
+			} else if purged > 0 {
+				log.Printf("Purged %d deleted links", purged)
+			}
+
+			purged, err = p.PurgeClickEventsOnce(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Failed to purge click events: %v", err)
+				}
+			} else if purged > 0 {
+				log.Printf("Purged %d click events", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPurgerRespectsRetention(t *testing.T) {
+	clock := &mockTimeProvider{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.timeProvider = clock
+	ctx := context.Background()
+
+	if _, err := store.CreateShortURL(ctx, "https://example.com/old", CreateOptions{Alias: "old-link"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if _, err := store.CreateShortURL(ctx, "https://example.com/new", CreateOptions{Alias: "new-link"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	if err := store.SetLinkStatus(ctx, "old-link", StatusDeleted); err != nil {
+		t.Fatalf("SetLinkStatus() error = %v", err)
+	}
+	clock.now = clock.now.Add(12 * time.Hour)
+	if err := store.SetLinkStatus(ctx, "new-link", StatusDeleted); err != nil {
+		t.Fatalf("SetLinkStatus() error = %v", err)
+	}
+
+	purger := NewPurger(store, 24*time.Hour, 0, time.Hour)
+	purger.timeProvider = clock
+
+	// Only the link deleted a full retention period ago goes
+	clock.now = clock.now.Add(12 * time.Hour)
+	if purged, err := purger.PurgeOnce(ctx); err != nil || purged != 1 {
+		t.Fatalf("PurgeOnce() = %v, %v, want 1", purged, err)
+	}
+	if urlData, _ := store.GetURLData(ctx, "old-link"); urlData != nil {
+		t.Error("old-link survived its retention period")
+	}
+	if urlData, _ := store.GetURLData(ctx, "new-link"); urlData == nil {
+		t.Error("new-link was purged before its retention period ended")
+	}
+}
+
+func TestPurgerRun(t *testing.T) {
+	store := NewMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := store.CreateShortURL(ctx, "https://example.com", CreateOptions{Alias: "gone"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if err := store.SetLinkStatus(ctx, "gone", StatusDeleted); err != nil {
+		t.Fatalf("SetLinkStatus() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		NewPurger(store, 0, 0, 10*time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		urlData, err := store.GetURLData(ctx, "gone")
+		if err != nil {
+			t.Fatalf("GetURLData() error = %v", err)
+		}
+		if urlData == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Run() did not purge the deleted link")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() did not return after its context was cancelled")
+	}
+}
+
+func TestPurgerClickEventRetention(t *testing.T) {
+	clock := &mockTimeProvider{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.timeProvider = clock
+	ctx := context.Background()
+
+	if _, err := store.CreateShortURL(ctx, "https://example.com", CreateOptions{Alias: "clicked"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if _, err := store.GetOriginalURL(ctx, "clicked"); err != nil {
+		t.Fatalf("GetOriginalURL() error = %v", err)
+	}
+	clock.now = clock.now.Add(12 * time.Hour)
+	if _, err := store.GetOriginalURL(ctx, "clicked"); err != nil {
+		t.Fatalf("GetOriginalURL() error = %v", err)
+	}
+
+	// Without a click retention nothing is removed
+	keepAll := NewPurger(store, 0, 0, time.Hour)
+	keepAll.timeProvider = clock
+	clock.now = clock.now.Add(12*time.Hour + time.Minute)
+	if purged, err := keepAll.PurgeClickEventsOnce(ctx); err != nil || purged != 0 {
+		t.Fatalf("PurgeClickEventsOnce() without retention = %v, %v, want 0", purged, err)
+	}
+
+	purger := NewPurger(store, 0, 24*time.Hour, time.Hour)
+	purger.timeProvider = clock
+	if purged, err := purger.PurgeClickEventsOnce(ctx); err != nil || purged != 1 {
+		t.Fatalf("PurgeClickEventsOnce() = %v, %v, want 1", purged, err)
+	}
+	events, err := store.ListClickEvents(ctx, "clicked", time.Time{}, time.Time{})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("ListClickEvents() = %v, %v, want the newer click only", events, err)
+	}
+	// The click count is not affected
+	if count, _ := store.GetClickCount(ctx, "clicked"); count != 2 {
+		t.Errorf("GetClickCount() = %d, want 2", count)
+	}
+}
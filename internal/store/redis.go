@@ -4,33 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-// TimeProvider defines an interface for getting the current time
-type TimeProvider interface {
-	Now() time.Time
-}
-
-// DefaultTimeProvider implements TimeProvider using the system clock
-type DefaultTimeProvider struct{}
-
-func (DefaultTimeProvider) Now() time.Time {
-	return time.Now()
-}
-
-type URLData struct {
-	OriginalURL string    `json:"original_url"`
-	CreatedAt   time.Time `json:"created_at"`
-	ClickCount  int64     `json:"click_count"`
-}
-
 type RedisStore struct {
 	client       *redis.Client
 	timeProvider TimeProvider
+
+	// expiredLinkTTL is how long an expired link is kept before Redis deletes it; zero keeps it forever
+	expiredLinkTTL time.Duration
 }
 
 func NewRedisStore() (*RedisStore, error) {
@@ -42,11 +30,22 @@ func NewRedisStore() (*RedisStore, error) {
 		return nil, fmt.Errorf("missing required Redis environment variables")
 	}
 
+	var expiredLinkTTL time.Duration
+	if v := os.Getenv("REDIS_EXPIRED_LINK_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_EXPIRED_LINK_TTL: %w", err)
+		}
+		expiredLinkTTL = ttl
+	}
+
 	client := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Username: username,
 		Password: password,
 		DB:       0,
+		// Honour context deadlines on socket reads and writes, not only while waiting for a connection
+		ContextTimeoutEnabled: true,
 	})
 
 	// Test the connection
@@ -55,9 +54,15 @@ func NewRedisStore() (*RedisStore, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
+	// Bring stored data up to the current layout
+	if err := migrateRedis(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to migrate Redis data: %w", err)
+	}
+
 	return &RedisStore{
-		client:       client,
-		timeProvider: DefaultTimeProvider{},
+		client:         client,
+		timeProvider:   DefaultTimeProvider{},
+		expiredLinkTTL: expiredLinkTTL,
 	}, nil
 }
 
@@ -65,51 +70,361 @@ func (s *RedisStore) Close() error {
 	return s.client.Close()
 }
 
-func (s *RedisStore) CreateShortURL(originalURL string) (string, error) {
-	if originalURL == "" {
-		return "", fmt.Errorf("original URL is required")
+func (s *RedisStore) CreateShortURL(ctx context.Context, originalURL string, opts CreateOptions) (string, error) {
+	code, err := s.createLink(ctx, originalURL, opts)
+	if err != nil {
+		return "", err
 	}
+	return fullShortURL(code), nil
+}
 
-	ctx := context.Background()
+func (s *RedisStore) CreateOrReuseShortURL(ctx context.Context, originalURL string, opts CreateOptions) (string, bool, error) {
+	return createOrReuse(ctx, s, originalURL, opts)
+}
 
-	// Get the next ID using Redis INCR
-	id, err := s.client.Incr(ctx, "url_counter").Result()
+// createLink stores a new link and returns its code
+func (s *RedisStore) createLink(ctx context.Context, originalURL string, opts CreateOptions) (string, error) {
+	// Create URL data
+	urlData, err := newURLData(originalURL, opts, s.timeProvider.Now())
+	if err != nil {
+		return "", err
+	}
+	firstDestination, err := json.Marshal(DestinationChange{
+		OriginalURL: urlData.OriginalURL,
+		ChangedAt:   urlData.CreatedAt,
+		Actor:       ActorCreator,
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to increment counter: %w", err)
+		return "", fmt.Errorf("failed to encode history: %w", err)
+	}
+
+	// Let Redis drop expired links once they have been shown as expired for long enough
+	var deleteAt any = ""
+	if !urlData.ExpiresAt.IsZero() && s.expiredLinkTTL > 0 {
+		deleteAt = urlData.ExpiresAt.Add(s.expiredLinkTTL).UnixMilli()
 	}
+	fields := hashArgs(urlData.toHash())
 
-	// Convert ID to base62 string
-	shortURL := EncodeBase62(id)
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
 
-	// Create URL data
-	urlData := URLData{
-		OriginalURL: originalURL,
-		CreatedAt:   s.timeProvider.Now(),
-		ClickCount:  0,
+	claim := func(ctx context.Context, code string) (bool, error) {
+		args := append([]any{firstDestination, urlData.CreatedAt.UnixMilli(), deleteAt, len(fields)}, fields...)
+		for _, term := range searchTerms(code, urlData) {
+			args = append(args, term)
+		}
+		keys := []string{code, historyKey(code), createdLinksKey, searchDocKey(code), searchTermsKey, expiringLinksKey, expiringTagsKey}
+		created, err := createIfAbsentScript.Run(ctx, s.client, keys, args...).Int()
+		return created == 1, err
 	}
 
-	// Convert to JSON
-	data, err := json.Marshal(urlData)
+	shortURL := opts.Alias
+	if shortURL != "" {
+		claimed, err := claim(ctx, shortURL)
+		if err != nil {
+			return "", fmt.Errorf("failed to store URL: %w", err)
+		}
+		if !claimed {
+			return "", ErrAliasTaken
+		}
+	} else {
+		// Draw IDs from Redis INCR, skipping codes that are reserved or already claimed by an alias
+		shortURL, err = allocateCode(ctx,
+			func(ctx context.Context) (int64, error) {
+				return s.client.Incr(ctx, "url_counter").Result()
+			},
+			claim,
+		)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return shortURL, nil
+}
+
+// createIfAbsentScript stores a URL hash only if the key is unused, so two callers
+// can never both claim the same code, and in the same step starts its destination
+// history, sets its TTL and adds it to the creation, tag and search indexes.
+// KEYS are the link hash, its history list, createdLinksKey, its searchDocKey,
+// searchTermsKey, expiringLinksKey and expiringTagsKey. ARGV[1] is the first history
+// entry, ARGV[2] the creation index score, ARGV[3] when to delete the link in Unix
+// milliseconds or "" to keep it, ARGV[4] the number n of hash arguments, the next n
+// are the hash as field/value pairs and the rest are its search terms.
+var createIfAbsentScript = redis.NewScript(dropExpiredTagsLua + reindexLua + `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+-- A link that held the code until its TTL ran out may not have been swept yet
+dropExpiredTags(KEYS[6], KEYS[7], KEYS[1])
+local n = tonumber(ARGV[4])
+redis.call('HSET', KEYS[1], unpack(ARGV, 5, 4 + n))
+redis.call('DEL', KEYS[2])
+redis.call('RPUSH', KEYS[2], ARGV[1])
+redis.call('ZADD', KEYS[3], ARGV[2], KEYS[1])
+local tags = redis.call('HGET', KEYS[1], 'tags')
+if tags then
+	for _, tag in ipairs(cjson.decode(tags)) do
+		redis.call('SADD', 'tag:' .. tag, KEYS[1])
+	end
+end
+if ARGV[3] ~= '' then
+	redis.call('PEXPIREAT', KEYS[1], ARGV[3])
+	redis.call('PEXPIREAT', KEYS[2], ARGV[3])
+	redis.call('ZADD', KEYS[6], ARGV[3], KEYS[1])
+	if tags then
+		redis.call('HSET', KEYS[7], KEYS[1], tags)
+	end
+end
+reindex(KEYS[4], KEYS[5], KEYS[1], {unpack(ARGV, 5 + n)})
+return 1
+`)
+
+// expiringLinksKey is a sorted set of the codes of links with a TTL, scored by when Redis
+// deletes them in Unix milliseconds, so the purge can drop them from the indexes afterwards
+const expiringLinksKey = "links:expiring"
+
+// expiringTagsKey is a hash from the codes of tagged links with a TTL to their tags field,
+// which is gone with the link hash by the time the purge removes them from their tag sets
+const expiringTagsKey = "links:expiring:tags"
+
+// dropExpiredTagsLua defines dropExpiredTags(expiringKey, tagsKey, code), which removes code
+// from the tag sets recorded for it in tagsKey and forgets it in expiringKey and tagsKey.
+// expiringKey is expiringLinksKey and tagsKey expiringTagsKey.
+const dropExpiredTagsLua = `
+local function dropExpiredTags(expiringKey, tagsKey, code)
+	local tags = redis.call('HGET', tagsKey, code)
+	if tags then
+		for _, tag in ipairs(cjson.decode(tags)) do
+			redis.call('SREM', 'tag:' .. tag, code)
+		end
+	end
+	redis.call('ZREM', expiringKey, code)
+	redis.call('HDEL', tagsKey, code)
+end
+`
+
+// createdLinksKey is a sorted set of every code scored by creation time in Unix milliseconds,
+// which float scores hold exactly. ListLinks pages through it instead of scanning the keyspace.
+const createdLinksKey = "links:created"
+
+// dedupeIndexKey is a hash from dedupeKey values to the code created for them, or to the claim
+// of a request creating one. A link records its entry as its dedupe_key field, so deleting or
+// purging the link removes the entry too. Reusable links never expire, so none goes by a TTL.
+const dedupeIndexKey = "links:dedupe"
+
+// swapDedupeScript sets field ARGV[1] of the hash KEYS[1] to ARGV[3], or removes it if ARGV[3]
+// is empty, provided it still holds ARGV[2] (empty meaning the field is unset), returning 1 if so.
+// KEYS[2], if given, is the link hash ARGV[3] names; it records ARGV[1] as its dedupe_key so the
+// entry can be removed along with the link.
+var swapDedupeScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], ARGV[1]) or ''
+if current ~= ARGV[2] then
+	return 0
+end
+if ARGV[3] == '' then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+else
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+end
+if KEYS[2] and redis.call('EXISTS', KEYS[2]) == 1 then
+	redis.call('HSET', KEYS[2], 'dedupe_key', ARGV[1])
+end
+return 1
+`)
+
+func (s *RedisStore) lookupDedupe(ctx context.Context, key string) (string, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	code, err := s.client.HGet(ctx, dedupeIndexKey, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal URL data: %w", err)
+		return "", fmt.Errorf("failed to look up existing link: %w", err)
+	}
+	return code, nil
+}
+
+func (s *RedisStore) swapDedupe(ctx context.Context, key, old, next string) (bool, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	// The first claim on a destination is the common case and needs no script
+	if old == "" && next != "" {
+		claimed, err := s.client.HSetNX(ctx, dedupeIndexKey, key, next).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to record link for reuse: %w", err)
+		}
+		return claimed, nil
 	}
 
-	// Store the mapping in Redis
-	err = s.client.Set(ctx, shortURL, data, 0).Err()
+	keys := []string{dedupeIndexKey}
+	if _, isClaim := parseDedupeClaim(next); next != "" && !isClaim {
+		keys = append(keys, next)
+	}
+	swapped, err := swapDedupeScript.Run(ctx, s.client, keys, key, old, next).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to record link for reuse: %w", err)
+	}
+	return swapped == 1, nil
+}
+
+// policyDocumentKey holds the destination policy document
+const policyDocumentKey = "policy:document"
+
+func (s *RedisStore) GetPolicyDocument(ctx context.Context) (string, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	document, err := s.client.Get(ctx, policyDocumentKey).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to store URL: %w", err)
+		return "", fmt.Errorf("failed to get policy document: %w", err)
+	}
+	return document, nil
+}
+
+func (s *RedisStore) SavePolicyDocument(ctx context.Context, document string) error {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	if err := s.client.Set(ctx, policyDocumentKey, document, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save policy document: %w", err)
 	}
+	return nil
+}
 
-	fullShortURL := os.Getenv("SHORTENME_URL") + "/" + shortURL
+// tagKey names the set of codes carrying a tag, which must already be normalized
+func tagKey(tag string) string {
+	return "tag:" + tag
+}
 
-	return fullShortURL, nil
+// historyKey names the list holding a link's destination history as JSON entries, oldest first.
+// Codes cannot contain ':', so it never collides with a link.
+func historyKey(shortURL string) string {
+	return "history:" + shortURL
 }
 
-func (s *RedisStore) GetOriginalURL(shortURL string) (string, error) {
-	ctx := context.Background()
+// resolveScript checks that a link may still be followed, counts the click and
+// returns {status, original_url} in a single atomic step, so two visitors can
+// never both take the last allowed click. HINCRBY alone would create a hash
+// for unknown codes, so existence is checked first.
+// KEYS are the link hash, its click stream, the day's unique visitor HyperLogLog,
+// the link's index of those and its click counts. ARGV[1] is the current time in Unix nanoseconds,
+// ARGV[2] the same in milliseconds, ARGV[3] the start of the day in milliseconds,
+// ARGV[4] the visitor, if any, and the rest are the click event's fields and values.
+// The event's ID is taken from ARGV[2] rather than the server clock, moving the
+// sequence on if the stream already holds a later one.
+var resolveScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+local link = redis.call('HMGET', KEYS[1], 'original_url', 'expires_at', 'max_clicks', 'click_count', 'status')
+if link[5] == 'disabled' or link[5] == 'deleted' or link[5] == 'suspended' then
+	return {link[5], link[1]}
+end
+local expiresAt = tonumber(link[2])
+if expiresAt and expiresAt <= tonumber(ARGV[1]) then
+	return {'expired', link[1]}
+end
+local maxClicks = tonumber(link[3])
+if maxClicks and maxClicks > 0 and (tonumber(link[4]) or 0) >= maxClicks then
+	return {'limit', link[1]}
+end
+redis.call('HINCRBY', KEYS[1], 'click_count', 1)
+local ms, seq = tonumber(ARGV[2]), 0
+redis.call('HINCRBY', KEYS[5], string.format('minute:%d', ms - ms % 60000), 1)
+redis.call('HINCRBY', KEYS[5], string.format('hour:%d', ms - ms % 3600000), 1)
+redis.call('HINCRBY', KEYS[5], 'day:' .. ARGV[3], 1)
+local last = redis.call('XREVRANGE', KEYS[2], '+', '-', 'COUNT', 1)[1]
+if last then
+	local lastMs, lastSeq = string.match(last[1], '^(%d+)-(%d+)$')
+	lastMs, lastSeq = tonumber(lastMs), tonumber(lastSeq)
+	if lastMs >= ms then
+		ms, seq = lastMs, lastSeq + 1
+	end
+end
+redis.call('XADD', KEYS[2], string.format('%d-%d', ms, seq), unpack(ARGV, 5))
+if ARGV[4] ~= '' then
+	redis.call('PFADD', KEYS[3], ARGV[4])
+	redis.call('ZADD', KEYS[4], ARGV[3], KEYS[3])
+end
+-- Expire the events and visitor counts along with a link that has a TTL
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+	for i = 2, #KEYS do
+		if redis.call('EXISTS', KEYS[i]) == 1 then
+			redis.call('PEXPIRE', KEYS[i], ttl)
+		end
+	end
+end
+return {'ok', link[1]}
+`)
 
-	// Get the URL data from Redis
-	data, err := s.client.Get(ctx, shortURL).Result()
+// clicksKey names the stream of a link's click events, with IDs from the click time in milliseconds
+func clicksKey(shortURL string) string {
+	return "clicks:" + shortURL
+}
+
+// clickCountsKey names the hash of a link's click counts, from the bucket size name and the
+// bucket's start in Unix milliseconds, such as "hour:1740790800000", to the clicks in it
+func clickCountsKey(shortURL string) string {
+	return "clickcounts:" + shortURL
+}
+
+// trimClickCountsScript removes the buckets of the click counts hash KEYS[1] that ended no later
+// than ARGV[1], in Unix milliseconds, along with the click events they summarize
+var trimClickCountsScript = redis.NewScript(`
+local sizes = {minute = 60000, hour = 3600000, day = 86400000}
+for _, field in ipairs(redis.call('HKEYS', KEYS[1])) do
+	local name, start = string.match(field, '^(%a+):(%d+)$')
+	if start and sizes[name] and tonumber(start) + sizes[name] <= tonumber(ARGV[1]) then
+		redis.call('HDEL', KEYS[1], field)
+	end
+end
+return 0
+`)
+
+// visitorDaysKey names the sorted set of a link's daily unique visitor HyperLogLogs, scored by
+// the start of their day in Unix milliseconds
+func visitorDaysKey(shortURL string) string {
+	return "visitors:" + shortURL
+}
+
+// visitorsKey names the HyperLogLog of a link's unique visitors on the UTC day starting at day
+func visitorsKey(shortURL string, day time.Time) string {
+	return visitorDaysKey(shortURL) + ":" + day.Format(time.DateOnly)
+}
+
+func (s *RedisStore) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
+	return s.FollowLink(ctx, shortURL, ClickEvent{})
+}
+
+func (s *RedisStore) FollowLink(ctx context.Context, shortURL string, click ClickEvent) (string, error) {
+	// Link hashes share the keyspace with the store's own keys, which are never valid codes
+	if !ValidCode(shortURL) {
+		return "", nil
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	now := s.timeProvider.Now()
+	day := visitorDay(now)
+	keys := []string{shortURL, clicksKey(shortURL), visitorsKey(shortURL, day), visitorDaysKey(shortURL), clickCountsKey(shortURL)}
+	args := []any{
+		now.UnixNano(), now.UnixMilli(), day.UnixMilli(), click.Visitor,
+		"ts", now.UnixNano(),
+		"referrer", click.Referrer,
+		"user_agent", click.UserAgent,
+		"accept_language", click.AcceptLanguage,
+		"ip", click.IP,
+	}
+	result, err := resolveScript.Run(ctx, s.client, keys, args...).StringSlice()
 	if err == redis.Nil {
 		return "", nil
 	}
@@ -117,50 +432,1278 @@ func (s *RedisStore) GetOriginalURL(shortURL string) (string, error) {
 		return "", fmt.Errorf("failed to get URL: %w", err)
 	}
 
-	// Parse the URL data
-	var urlData URLData
-	if err := json.Unmarshal([]byte(data), &urlData); err != nil {
-		return "", fmt.Errorf("failed to unmarshal URL data: %w", err)
+	status, originalURL := result[0], result[1]
+	switch status {
+	case "disabled":
+		return "", ErrLinkDisabled
+	case "deleted":
+		return "", ErrLinkDeleted
+	case "suspended":
+		return "", ErrLinkSuspended
+	case "expired":
+		return "", ErrLinkExpired
+	case "limit":
+		return "", ErrClickLimitReached
+	}
+
+	return originalURL, nil
+}
+
+func (s *RedisStore) GetUniqueVisitors(ctx context.Context, shortURL string, from, to time.Time) (UniqueVisitors, error) {
+	if !ValidCode(shortURL) {
+		return UniqueVisitors{}, nil
 	}
 
-	// Increment click count
-	urlData.ClickCount++
-	updatedData, err := json.Marshal(urlData)
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	rangeBy := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if from = visitorDaysFrom(from); !from.IsZero() {
+		rangeBy.Min = strconv.FormatInt(from.UnixMilli(), 10)
+	}
+	if !to.IsZero() {
+		rangeBy.Max = "(" + strconv.FormatInt(to.UnixMilli(), 10)
+	}
+	days, err := s.client.ZRangeByScoreWithScores(ctx, visitorDaysKey(shortURL), rangeBy).Result()
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal updated URL data: %w", err)
+		return UniqueVisitors{}, fmt.Errorf("failed to list visitor days: %w", err)
+	}
+	if len(days) == 0 {
+		return UniqueVisitors{}, nil
 	}
 
-	// Update Redis with new click count
-	if err := s.client.Set(ctx, shortURL, updatedData, 0).Err(); err != nil {
-		return "", fmt.Errorf("failed to update click count: %w", err)
+	keys := make([]string, 0, len(days)+1)
+	keys = append(keys, visitorDaysKey(shortURL)+":union")
+	for _, day := range days {
+		keys = append(keys, day.Member.(string))
+	}
+	counts, err := countVisitorsScript.Run(ctx, s.client, keys).Int64Slice()
+	if err != nil {
+		return UniqueVisitors{}, fmt.Errorf("failed to count visitors: %w", err)
 	}
 
-	return urlData.OriginalURL, nil
+	visitors := UniqueVisitors{Total: counts[0], Days: make([]DailyVisitors, len(days))}
+	for i, day := range days {
+		visitors.Days[i] = DailyVisitors{
+			Day:      time.UnixMilli(int64(day.Score)).UTC(),
+			Visitors: counts[i+1],
+		}
+	}
+	return visitors, nil
 }
 
-func (s *RedisStore) GetClickCount(shortURL string) (int64, error) {
-	ctx := context.Background()
+// countVisitorsScript estimates the visitors in each HyperLogLog named by KEYS[2:] and in their
+// union, returning {union, counts...}. The union is merged into the scratch key KEYS[1] and
+// counted there, then dropped again.
+var countVisitorsScript = redis.NewScript(`
+local counts = {0}
+for i = 2, #KEYS do
+	counts[i] = redis.call('PFCOUNT', KEYS[i])
+end
+redis.call('PFMERGE', KEYS[1], unpack(KEYS, 2))
+counts[1] = redis.call('PFCOUNT', KEYS[1])
+redis.call('DEL', KEYS[1])
+return counts
+`)
+
+// dropVisitorsScript deletes a link's daily unique visitor HyperLogLogs along with their index,
+// KEYS[1]
+var dropVisitorsScript = redis.NewScript(`
+for _, key in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+	redis.call('DEL', key)
+end
+redis.call('DEL', KEYS[1])
+return 0
+`)
 
-	// Get the URL data from Redis
-	data, err := s.client.Get(ctx, shortURL).Result()
+// clickEventBatch is how many stream entries ListClickEvents reads per round trip
+const clickEventBatch = 1000
+
+func (s *RedisStore) ListClickEvents(ctx context.Context, shortURL string, from, to time.Time) ([]ClickEvent, error) {
+	if !ValidCode(shortURL) {
+		return nil, nil
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	// Stream IDs only have millisecond precision, so the range is widened to whole
+	// milliseconds and the events' own timestamps are checked exactly
+	start, end := "-", "+"
+	if !from.IsZero() {
+		start = strconv.FormatInt(from.UnixMilli(), 10)
+	}
+	if !to.IsZero() {
+		end = strconv.FormatInt(to.UnixMilli(), 10)
+	}
+
+	var events []ClickEvent
+	for {
+		messages, err := s.client.XRangeN(ctx, clicksKey(shortURL), start, end, clickEventBatch).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list click events: %w", err)
+		}
+		for _, message := range messages {
+			event, err := clickEventFromStream(shortURL, message.Values)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse click event %s of %q: %w", message.ID, shortURL, err)
+			}
+			if inRange(event.Timestamp, from, to) {
+				events = append(events, event)
+			}
+		}
+		if len(messages) < clickEventBatch {
+			return events, nil
+		}
+		// Carry on after the last entry read
+		start = "(" + messages[len(messages)-1].ID
+	}
+}
+
+// clickEventFromStream converts a click stream entry back into a ClickEvent
+func clickEventFromStream(shortURL string, values map[string]any) (ClickEvent, error) {
+	field := func(name string) string {
+		v, _ := values[name].(string)
+		return v
+	}
+	ts, err := strconv.ParseInt(field("ts"), 10, 64)
+	if err != nil {
+		return ClickEvent{}, fmt.Errorf("invalid ts %q: %w", field("ts"), err)
+	}
+	return ClickEvent{
+		Code:           shortURL,
+		Timestamp:      time.Unix(0, ts),
+		Referrer:       field("referrer"),
+		UserAgent:      field("user_agent"),
+		AcceptLanguage: field("accept_language"),
+		IP:             field("ip"),
+	}, nil
+}
+
+func (s *RedisStore) CountClicks(ctx context.Context, shortURL string, from, to time.Time, size time.Duration) ([]ClickCount, error) {
+	buckets, err := clickBuckets(from, to, size)
+	if err != nil || len(buckets) == 0 || !ValidCode(shortURL) {
+		return buckets, err
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	fields := make([]string, len(buckets))
+	for i, bucket := range buckets {
+		fields[i] = clickBucketNames[size] + ":" + strconv.FormatInt(bucket.Start.UnixMilli(), 10)
+	}
+	counts, err := s.client.HMGet(ctx, clickCountsKey(shortURL), fields...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count clicks: %w", err)
+	}
+	for i, count := range counts {
+		if v, ok := count.(string); ok {
+			if buckets[i].Clicks, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid click count %q: %w", v, err)
+			}
+		}
+	}
+	return buckets, nil
+}
+
+func (s *RedisStore) PurgeClickEvents(ctx context.Context, before time.Time) (int64, error) {
+	// Every stream belongs to a link in createdLinksKey; a stream outliving its link
+	// through a TTL expires with it
+	minID := strconv.FormatInt(before.UnixMilli(), 10)
+	// Visitor days are scored by their start, so they have ended by before once they start a day earlier
+	lastDay := strconv.FormatInt(before.Add(-24*time.Hour).UnixMilli(), 10)
+	var purged int64
+	for offset := int64(0); ; offset += purgeBatch {
+		n, more, err := s.purgeClickEventsBatch(ctx, minID, lastDay, offset)
+		purged += n
+		if err != nil || !more {
+			return purged, err
+		}
+	}
+}
+
+// purgeClickEventsBatch trims the streams of the purgeBatch links from offset in createdLinksKey
+// to minID and deletes their visitor days starting no later than lastDay. It returns how many
+// events it removed and whether there may be more links.
+func (s *RedisStore) purgeClickEventsBatch(ctx context.Context, minID, lastDay string, offset int64) (int64, bool, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	codes, err := s.client.ZRange(ctx, createdLinksKey, offset, offset+purgeBatch-1).Result()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to list links: %w", err)
+	}
+
+	trimmed := make([]*redis.IntCmd, len(codes))
+	endedDays := make([]*redis.StringSliceCmd, len(codes))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, code := range codes {
+			trimmed[i] = pipe.XTrimMinID(ctx, clicksKey(code), minID)
+			// Eval rather than Run, as a pipeline cannot fall back to sending the script
+			trimClickCountsScript.Eval(ctx, pipe, []string{clickCountsKey(code)}, minID)
+			endedDays[i] = pipe.ZRangeByScore(ctx, visitorDaysKey(code), &redis.ZRangeBy{Min: "-inf", Max: lastDay})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to purge click events: %w", err)
+	}
+
+	// A day that has ended gets no more visitors, so its HyperLogLog can go without a script
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, code := range codes {
+			if days := endedDays[i].Val(); len(days) > 0 {
+				pipe.Del(ctx, days...)
+				pipe.ZRem(ctx, visitorDaysKey(code), days)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to purge visitors: %w", err)
+	}
+	var purged int64
+	for _, cmd := range trimmed {
+		purged += cmd.Val()
+	}
+
+	return purged, len(codes) == purgeBatch, nil
+}
+
+func (s *RedisStore) GetClickCount(ctx context.Context, shortURL string) (int64, error) {
+	if !ValidCode(shortURL) {
+		return -1, nil
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	// Get the click count from the URL hash
+	clickCount, err := s.client.HGet(ctx, shortURL, "click_count").Int64()
 	if err == redis.Nil {
 		return -1, nil
 	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to get URL: %w", err)
+		return 0, fmt.Errorf("failed to get click count: %w", err)
 	}
 
-	// Parse the URL data
-	var urlData URLData
-	if err := json.Unmarshal([]byte(data), &urlData); err != nil {
-		return 0, fmt.Errorf("failed to unmarshal URL data: %w", err)
+	return clickCount, nil
+}
+
+func (s *RedisStore) GetURLData(ctx context.Context, shortURL string) (*URLData, error) {
+	if !ValidCode(shortURL) {
+		return nil, nil
 	}
 
-	return urlData.ClickCount, nil
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	fields, err := s.client.HGetAll(ctx, shortURL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get URL: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	urlData, err := urlDataFromHash(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL data: %w", err)
+	}
+
+	return &urlData, nil
+}
+
+// updateIfExistsScript sets hash fields only on an existing link, so an update
+// racing a delete cannot recreate a partial hash, and re-indexes a changed destination
+// in the same step, so concurrent updates cannot leave the index behind the hash.
+// KEYS are the link hash, its history list, its searchDocKey and searchTermsKey.
+// ARGV[1] is a history entry to append, or empty if the destination is unchanged,
+// ARGV[2] the number n of hash arguments, the next n are field/value pairs and the
+// rest are the search terms of the new destination.
+var updateIfExistsScript = redis.NewScript(reindexLua + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local n = tonumber(ARGV[2])
+if n > 0 then
+	redis.call('HSET', KEYS[1], unpack(ARGV, 3, 2 + n))
+end
+if ARGV[1] ~= '' then
+	redis.call('RPUSH', KEYS[2], ARGV[1])
+	reindex(KEYS[3], KEYS[4], KEYS[1], {unpack(ARGV, 3 + n)})
+end
+return 1
+`)
+
+func (s *RedisStore) UpdateLink(ctx context.Context, shortURL string, update LinkUpdate) error {
+	if !ValidCode(shortURL) {
+		return ErrLinkNotFound
+	}
+
+	if err := validateLinkUpdate(update); err != nil {
+		return err
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	fields := map[string]any{}
+	change := []byte{}
+	var terms []string
+	if update.OriginalURL != nil {
+		fields["original_url"] = *update.OriginalURL
+
+		var err error
+		change, err = json.Marshal(DestinationChange{
+			OriginalURL: *update.OriginalURL,
+			ChangedAt:   s.timeProvider.Now(),
+			Actor:       update.Actor,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode history: %w", err)
+		}
+
+		// Title and tags never change after creation, so the terms to keep alongside the new
+		// destination can be read ahead of the script
+		current, err := s.client.HMGet(ctx, shortURL, "title", "tags").Result()
+		if err != nil {
+			return fmt.Errorf("failed to get URL: %w", err)
+		}
+		urlData, err := urlDataFromHash(presentFields([]string{"title", "tags"}, current))
+		if err != nil {
+			return fmt.Errorf("failed to parse URL data: %w", err)
+		}
+		urlData.OriginalURL = *update.OriginalURL
+		terms = searchTerms(shortURL, urlData)
+	}
+	hash := hashArgs(fields)
+	args := append([]any{change, len(hash)}, hash...)
+	for _, term := range terms {
+		args = append(args, term)
+	}
+
+	keys := []string{shortURL, historyKey(shortURL), searchDocKey(shortURL), searchTermsKey}
+	updated, err := updateIfExistsScript.Run(ctx, s.client, keys, args...).Int()
+	if err != nil {
+		return fmt.Errorf("failed to update URL: %w", err)
+	}
+	if updated == 0 {
+		return ErrLinkNotFound
+	}
+
+	return nil
+}
+
+// presentFields pairs the names of an HMGET with its values, leaving out missing fields
+func presentFields(names []string, values []any) map[string]string {
+	fields := make(map[string]string, len(names))
+	for i, v := range values {
+		if v, ok := v.(string); ok {
+			fields[names[i]] = v
+		}
+	}
+	return fields
+}
+
+func (s *RedisStore) ListLinks(ctx context.Context, opts ListOptions) (LinkPage, error) {
+	cursor, hasCursor, err := decodeCursor(opts.Cursor)
+	if err != nil {
+		return LinkPage{}, err
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	if opts.Tag != "" {
+		return s.listTaggedLinks(ctx, opts, cursor, hasCursor)
+	}
+
+	// Narrow the index walk by creation time; exact bounds are applied by opts.matches
+	minScore, maxScore := "-inf", "+inf"
+	if !opts.CreatedAfter.IsZero() {
+		minScore = strconv.FormatInt(opts.CreatedAfter.UnixMilli(), 10)
+	}
+	var cursorScore int64
+	if hasCursor {
+		cursorScore = time.Unix(0, cursor.createdAt).UnixMilli()
+		maxScore = strconv.FormatInt(cursorScore, 10)
+	}
+	if !opts.CreatedBefore.IsZero() && (!hasCursor || opts.CreatedBefore.UnixMilli() < cursorScore) {
+		maxScore = strconv.FormatInt(opts.CreatedBefore.UnixMilli(), 10)
+	}
+
+	limit := opts.limit()
+	batchSize := int64(limit + 1)
+	var records []LinkRecord
+
+	// Read batches until a page and one more match are found, so we know whether there is a next page
+	for offset := int64(0); len(records) <= limit; offset += batchSize {
+		entries, err := s.client.ZRevRangeByScoreWithScores(ctx, createdLinksKey, &redis.ZRangeBy{
+			Min:    minScore,
+			Max:    maxScore,
+			Offset: offset,
+			Count:  batchSize,
+		}).Result()
+		if err != nil {
+			return LinkPage{}, fmt.Errorf("failed to list links: %w", err)
+		}
+
+		hashes := make([]*redis.MapStringStringCmd, len(entries))
+		_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, entry := range entries {
+				hashes[i] = pipe.HGetAll(ctx, entry.Member.(string))
+			}
+			return nil
+		})
+		if err != nil {
+			return LinkPage{}, fmt.Errorf("failed to list links: %w", err)
+		}
+
+		var stale []any
+		for i, entry := range entries {
+			code := entry.Member.(string)
+			// Entries sharing the cursor's score are ordered by code; skip those up to the cursor
+			if hasCursor && int64(entry.Score) == cursorScore && code >= cursor.code {
+				continue
+			}
+
+			fields := hashes[i].Val()
+			if len(fields) == 0 {
+				// The link expired through its TTL; drop it from the index
+				stale = append(stale, code)
+				continue
+			}
+			urlData, err := urlDataFromHash(fields)
+			if err != nil {
+				return LinkPage{}, fmt.Errorf("failed to parse URL data of %q: %w", code, err)
+			}
+			if opts.matches(urlData) {
+				records = append(records, LinkRecord{Code: code, URLData: urlData})
+			}
+		}
+		if len(stale) > 0 {
+			if err := s.client.ZRem(ctx, createdLinksKey, stale...).Err(); err != nil {
+				return LinkPage{}, fmt.Errorf("failed to clean link index: %w", err)
+			}
+			offset -= int64(len(stale))
+		}
+
+		if int64(len(entries)) < batchSize {
+			break
+		}
+	}
+
+	return newLinkPage(records, limit), nil
+}
+
+// listTaggedLinks serves ListLinks from the tag's set, which is usually far smaller than the
+// creation-time index
+func (s *RedisStore) listTaggedLinks(ctx context.Context, opts ListOptions, cursor listCursor, hasCursor bool) (LinkPage, error) {
+	key := tagKey(NormalizeTag(opts.Tag))
+	codes, err := s.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return LinkPage{}, fmt.Errorf("failed to list links: %w", err)
+	}
+
+	hashes := make([]*redis.MapStringStringCmd, len(codes))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, code := range codes {
+			hashes[i] = pipe.HGetAll(ctx, code)
+		}
+		return nil
+	})
+	if err != nil {
+		return LinkPage{}, fmt.Errorf("failed to list links: %w", err)
+	}
+
+	var (
+		records []LinkRecord
+		stale   []any
+	)
+	for i, code := range codes {
+		fields := hashes[i].Val()
+		if len(fields) == 0 {
+			// The link expired through its TTL; drop it from the tag
+			stale = append(stale, code)
+			continue
+		}
+		urlData, err := urlDataFromHash(fields)
+		if err != nil {
+			return LinkPage{}, fmt.Errorf("failed to parse URL data of %q: %w", code, err)
+		}
+		rec := LinkRecord{Code: code, URLData: urlData}
+		if (!hasCursor || cursor.after(rec)) && opts.matches(urlData) {
+			records = append(records, rec)
+		}
+	}
+	if len(stale) > 0 {
+		if err := s.client.SRem(ctx, key, stale...).Err(); err != nil {
+			return LinkPage{}, fmt.Errorf("failed to clean tag index: %w", err)
+		}
+	}
+
+	sortNewestFirst(records)
+	return newLinkPage(records, opts.limit()), nil
+}
+
+// searchTermsKey is a sorted set of every indexed term, all scored 0 so that
+// ZRANGEBYLEX can expand a prefix into the terms starting with it
+const searchTermsKey = "search:terms"
+
+// searchTermKey names the set of codes a term was found in
+func searchTermKey(term string) string {
+	return "search:term:" + term
+}
+
+// searchDocKey names the set of terms a link is indexed under, so they can be dropped when it changes
+func searchDocKey(shortURL string) string {
+	return "search:doc:" + shortURL
+}
+
+// reindexLua defines reindex(docKey, termsKey, code, terms) for scripts that replace the terms
+// a link is indexed under, none to drop it from the index. docKey is the link's searchDocKey and
+// termsKey searchTermsKey. The per-term keys are built from the terms, so like the rest of the
+// store it expects a single Redis node.
+const reindexLua = `
+local function reindex(docKey, termsKey, code, terms)
+	for _, term in ipairs(redis.call('SMEMBERS', docKey)) do
+		local key = 'search:term:' .. term
+		redis.call('SREM', key, code)
+		if redis.call('SCARD', key) == 0 then
+			redis.call('ZREM', termsKey, term)
+		end
+	end
+	redis.call('DEL', docKey)
+	for _, term in ipairs(terms) do
+		redis.call('SADD', 'search:term:' .. term, code)
+		redis.call('ZADD', termsKey, 0, term)
+		redis.call('SADD', docKey, term)
+	end
+end
+`
+
+// indexScript replaces the terms a link is indexed under. KEYS are the link's
+// searchDocKey and searchTermsKey; ARGV[1] is the code and the rest are its new terms.
+var indexScript = redis.NewScript(reindexLua + `
+reindex(KEYS[1], KEYS[2], ARGV[1], {unpack(ARGV, 2)})
+return 1
+`)
+
+// indexLink makes a link findable by exactly the given terms
+func indexLink(ctx context.Context, client redis.Scripter, shortURL string, terms []string) error {
+	args := make([]any, 0, len(terms)+1)
+	args = append(args, shortURL)
+	for _, term := range terms {
+		args = append(args, term)
+	}
+	if err := indexScript.Run(ctx, client, []string{searchDocKey(shortURL), searchTermsKey}, args...).Err(); err != nil {
+		return fmt.Errorf("failed to index %q for search: %w", shortURL, err)
+	}
+	return nil
+}
+
+// maxSearchPrefixTerms caps how many indexed terms one search word expands to. Terms starting
+// with a word sort after the word itself, so an exact match is always kept, but a very short
+// word only finds links through the first terms it starts.
+const maxSearchPrefixTerms = 1000
+
+func (s *RedisStore) SearchLinks(ctx context.Context, opts SearchOptions) ([]LinkRecord, error) {
+	query := searchTokens(opts.Query)
+	if len(query) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	// A link matches if, for every token, it is in the set of some term starting with that token
+	var candidates map[string]bool
+	for _, token := range query {
+		terms, err := s.client.ZRangeByLex(ctx, searchTermsKey, &redis.ZRangeBy{
+			Min:   "[" + token,
+			Max:   "(" + prefixEnd(token),
+			Count: maxSearchPrefixTerms,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to search links: %w", err)
+		}
+		if len(terms) == 0 {
+			return nil, nil
+		}
+
+		keys := make([]string, len(terms))
+		for i, term := range terms {
+			keys[i] = searchTermKey(term)
+		}
+		codes, err := s.client.SUnion(ctx, keys...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to search links: %w", err)
+		}
+
+		matched := make(map[string]bool, len(codes))
+		for _, code := range codes {
+			if candidates == nil || candidates[code] {
+				matched[code] = true
+			}
+		}
+		candidates = matched
+		if len(candidates) == 0 {
+			return nil, nil
+		}
+	}
+
+	// Rank the matches newest first by their creation score, so only a page of link hashes is loaded
+	ranked := make([]redis.Z, 0, len(candidates))
+	scores := make([]*redis.FloatCmd, 0, len(candidates))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for code := range candidates {
+			ranked = append(ranked, redis.Z{Member: code})
+			scores = append(scores, pipe.ZScore(ctx, createdLinksKey, code))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to search links: %w", err)
+	}
+	for i, cmd := range scores {
+		score, err := cmd.Result()
+		if err == redis.Nil {
+			// A link missing from the creation index is ranked last rather than left out
+			score = math.Inf(-1)
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to search links: %w", err)
+		}
+		ranked[i].Score = score
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Member.(string) > ranked[j].Member.(string)
+	})
+
+	limit := opts.limit()
+	var records []LinkRecord
+	for len(records) < limit && len(ranked) > 0 {
+		batch := ranked[:min(limit-len(records), len(ranked))]
+		ranked = ranked[len(batch):]
+
+		hashes := make([]*redis.MapStringStringCmd, len(batch))
+		_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, entry := range batch {
+				hashes[i] = pipe.HGetAll(ctx, entry.Member.(string))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search links: %w", err)
+		}
+
+		for i, entry := range batch {
+			code := entry.Member.(string)
+			fields := hashes[i].Val()
+			if len(fields) == 0 {
+				// The link expired through its TTL; drop it from the index
+				if err := indexLink(ctx, s.client, code, nil); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			urlData, err := urlDataFromHash(fields)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse URL data of %q: %w", code, err)
+			}
+			records = append(records, LinkRecord{Code: code, URLData: urlData})
+		}
+	}
+
+	sortNewestFirst(records)
+	return records, nil
+}
+
+func (s *RedisStore) GetLinkHistory(ctx context.Context, shortURL string) ([]DestinationChange, error) {
+	if !ValidCode(shortURL) {
+		return nil, nil
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	var entries *redis.StringSliceCmd
+	var exists *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		exists = pipe.Exists(ctx, shortURL)
+		entries = pipe.LRange(ctx, historyKey(shortURL), 0, -1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history: %w", err)
+	}
+	if exists.Val() == 0 {
+		return nil, nil
+	}
+
+	history := make([]DestinationChange, 0, len(entries.Val()))
+	for i, entry := range entries.Val() {
+		var change DestinationChange
+		if err := json.Unmarshal([]byte(entry), &change); err != nil {
+			return nil, fmt.Errorf("failed to parse history entry %d: %w", i+1, err)
+		}
+		change.Version = i + 1
+		history = append(history, change)
+	}
+
+	return history, nil
+}
+
+// deletedLinksKey is a sorted set of soft-deleted codes scored by deletion time in Unix
+// nanoseconds, so the purger finds them without scanning every link
+const deletedLinksKey = "links:deleted"
+
+// setStatusScript changes the status of an existing link and keeps deletedLinksKey in step.
+// KEYS are the link hash and deletedLinksKey; ARGV[1] is the status and ARGV[2]
+// the deletion time, or empty unless the status is deleted.
+var setStatusScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if ARGV[2] ~= '' then
+	redis.call('HSET', KEYS[1], 'status', ARGV[1], 'deleted_at', ARGV[2])
+	redis.call('ZADD', KEYS[2], ARGV[2], KEYS[1])
+else
+	redis.call('HSET', KEYS[1], 'status', ARGV[1])
+	redis.call('HDEL', KEYS[1], 'deleted_at')
+	redis.call('ZREM', KEYS[2], KEYS[1])
+end
+return 1
+`)
+
+func (s *RedisStore) SetLinkStatus(ctx context.Context, shortURL string, status LinkStatus) error {
+	if !ValidCode(shortURL) {
+		return ErrLinkNotFound
+	}
+
+	if !status.Valid() {
+		return ErrInvalidStatus
+	}
+
+	deletedAt := ""
+	if status == StatusDeleted {
+		deletedAt = strconv.FormatInt(s.timeProvider.Now().UnixNano(), 10)
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	updated, err := setStatusScript.Run(ctx, s.client, []string{shortURL, deletedLinksKey}, string(status), deletedAt).Int()
+	if err != nil {
+		return fmt.Errorf("failed to set link status: %w", err)
+	}
+	if updated == 0 {
+		return ErrLinkNotFound
+	}
+
+	return nil
+}
+
+// restoreScript reactivates a link deleted after ARGV[1], in Unix nanoseconds, and drops it from
+// deletedLinksKey, returning 'ok'; otherwise it returns 'missing', 'active' or 'expired'.
+// KEYS are the link hash and deletedLinksKey.
+var restoreScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 'missing'
+end
+local link = redis.call('HMGET', KEYS[1], 'status', 'deleted_at')
+if link[1] ~= 'deleted' then
+	return 'active'
+end
+if not link[2] or tonumber(link[2]) <= tonumber(ARGV[1]) then
+	return 'expired'
+end
+redis.call('HSET', KEYS[1], 'status', 'active')
+redis.call('HDEL', KEYS[1], 'deleted_at')
+redis.call('ZREM', KEYS[2], KEYS[1])
+return 'ok'
+`)
+
+func (s *RedisStore) RestoreLink(ctx context.Context, shortURL string, retention time.Duration) error {
+	if !ValidCode(shortURL) {
+		return ErrLinkNotFound
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	// The same cutoff PurgeDeletedLinks is given
+	cutoff := s.timeProvider.Now().Add(-retention).UnixNano()
+	result, err := restoreScript.Run(ctx, s.client, []string{shortURL, deletedLinksKey}, cutoff).Text()
+	if err != nil {
+		return fmt.Errorf("failed to restore link: %w", err)
+	}
+	switch result {
+	case "missing":
+		return ErrLinkNotFound
+	case "active":
+		return ErrLinkNotDeleted
+	case "expired":
+		return ErrRestoreExpired
+	}
+	return nil
+}
+
+// purgeScript removes a link if it is still deleted since no later than ARGV[1], returning 1,
+// and drops it from deletedLinksKey if it was restored or has already gone, returning -1.
+// It returns 0 for a link that stays in deletedLinksKey.
+// KEYS are the link hash, its history list, deletedLinksKey, createdLinksKey, its reports
+// hash, reportQueueKey, its click stream, its visitor days, its click counts, dedupeIndexKey,
+// expiringLinksKey, expiringTagsKey, its searchDocKey and searchTermsKey; the link's tag sets
+// are named from its tags field and its daily visitor HyperLogLogs are read from its visitor days.
+var purgeScript = redis.NewScript(dropExpiredTagsLua + reindexLua + `
+local link = redis.call('HMGET', KEYS[1], 'status', 'deleted_at', 'tags', 'dedupe_key')
+if link[1] ~= 'deleted' then
+	redis.call('ZREM', KEYS[3], KEYS[1])
+	return -1
+end
+if not link[2] or tonumber(link[2]) > tonumber(ARGV[1]) then
+	return 0
+end
+if link[3] then
+	for _, tag in ipairs(cjson.decode(link[3])) do
+		redis.call('SREM', 'tag:' .. tag, KEYS[1])
+	end
+end
+for _, key in ipairs(redis.call('ZRANGE', KEYS[8], 0, -1)) do
+	redis.call('DEL', key)
+end
+if link[4] and redis.call('HGET', KEYS[10], link[4]) == KEYS[1] then
+	redis.call('HDEL', KEYS[10], link[4])
+end
+dropExpiredTags(KEYS[11], KEYS[12], KEYS[1])
+reindex(KEYS[13], KEYS[14], KEYS[1], {})
+redis.call('DEL', KEYS[1], KEYS[2], KEYS[5], KEYS[7], KEYS[8], KEYS[9])
+redis.call('ZREM', KEYS[3], KEYS[1])
+redis.call('ZREM', KEYS[4], KEYS[1])
+redis.call('ZREM', KEYS[6], KEYS[1])
+return 1
+`)
+
+// purgeBatch is how many links a purge handles under one operation timeout, so a large
+// keyspace spreads over several deadlines instead of missing a single one
+const purgeBatch = 100
+
+func (s *RedisStore) PurgeDeletedLinks(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	before := deletedBefore.UnixNano()
+	var purged, kept int64
+	for {
+		n, k, more, err := s.purgeDeletedBatch(ctx, before, kept)
+		purged += n
+		kept += k
+		if err != nil {
+			return purged, err
+		}
+		if !more {
+			break
+		}
+	}
+
+	// Links deleted through their TTL are already gone and not counted, but they leave index entries behind
+	return purged, s.sweepExpiredLinks(ctx, s.timeProvider.Now())
+}
+
+// purgeDeletedBatch purges the next purgeBatch links deleted no later than before, skipping the
+// first offset of them that earlier batches left in deletedLinksKey. It returns how many it purged
+// and left in place, and whether there may be more.
+func (s *RedisStore) purgeDeletedBatch(ctx context.Context, before, offset int64) (purged, kept int64, more bool, err error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	codes, err := s.client.ZRangeByScore(ctx, deletedLinksKey, &redis.ZRangeBy{
+		Min:    "-inf",
+		Max:    strconv.FormatInt(before, 10),
+		Offset: offset,
+		Count:  purgeBatch,
+	}).Result()
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("failed to list deleted links: %w", err)
+	}
+
+	for _, code := range codes {
+		keys := []string{code, historyKey(code), deletedLinksKey, createdLinksKey, reportsKey(code), reportQueueKey,
+			clicksKey(code), visitorDaysKey(code), clickCountsKey(code), dedupeIndexKey, expiringLinksKey, expiringTagsKey,
+			searchDocKey(code), searchTermsKey}
+		removed, err := purgeScript.Run(ctx, s.client, keys, before).Int()
+		if err != nil {
+			return purged, kept, false, fmt.Errorf("failed to purge %q: %w", code, err)
+		}
+		switch removed {
+		case 1:
+			purged++
+		case 0:
+			kept++
+		}
+	}
+
+	return purged, kept, len(codes) == purgeBatch, nil
+}
+
+// dropExpiredScript removes a link Redis deleted through its TTL from the creation, tag, search
+// and report indexes, returning 1, and forgets a link that exists without a TTL, returning -1.
+// It returns 0 for a link that still has its TTL running. KEYS are the link hash,
+// expiringLinksKey, expiringTagsKey, createdLinksKey, its searchDocKey, searchTermsKey, its
+// reports hash and reportQueueKey; the link's tag sets are named from expiringTagsKey.
+var dropExpiredScript = redis.NewScript(dropExpiredTagsLua + reindexLua + `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	if redis.call('PTTL', KEYS[1]) > 0 then
+		return 0
+	end
+	redis.call('ZREM', KEYS[2], KEYS[1])
+	redis.call('HDEL', KEYS[3], KEYS[1])
+	return -1
+end
+dropExpiredTags(KEYS[2], KEYS[3], KEYS[1])
+reindex(KEYS[5], KEYS[6], KEYS[1], {})
+redis.call('ZREM', KEYS[4], KEYS[1])
+redis.call('DEL', KEYS[7])
+redis.call('ZREM', KEYS[8], KEYS[1])
+return 1
+`)
+
+// sweepExpiredLinks drops the links Redis deleted through their TTL by now from the indexes
+// that outlive them
+func (s *RedisStore) sweepExpiredLinks(ctx context.Context, now time.Time) error {
+	var kept int64
+	for {
+		k, more, err := s.sweepExpiredBatch(ctx, now.UnixMilli(), kept)
+		kept += k
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// sweepExpiredBatch sweeps the next purgeBatch links due to be deleted no later than now, skipping
+// the first offset of them that earlier batches found still running their TTL. It returns how many
+// of them still are, and whether there may be more.
+func (s *RedisStore) sweepExpiredBatch(ctx context.Context, now, offset int64) (kept int64, more bool, err error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	codes, err := s.client.ZRangeByScore(ctx, expiringLinksKey, &redis.ZRangeBy{
+		Min:    "-inf",
+		Max:    strconv.FormatInt(now, 10),
+		Offset: offset,
+		Count:  purgeBatch,
+	}).Result()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to list expiring links: %w", err)
+	}
+
+	for _, code := range codes {
+		keys := []string{code, expiringLinksKey, expiringTagsKey, createdLinksKey, searchDocKey(code), searchTermsKey, reportsKey(code), reportQueueKey}
+		dropped, err := dropExpiredScript.Run(ctx, s.client, keys).Int()
+		if err != nil {
+			return kept, false, fmt.Errorf("failed to sweep %q: %w", code, err)
+		}
+		if dropped == 0 {
+			kept++
+		}
+	}
+
+	return kept, len(codes) == purgeBatch, nil
+}
+
+func (s *RedisStore) DeleteLink(ctx context.Context, shortURL string) error {
+	if !ValidCode(shortURL) {
+		return ErrLinkNotFound
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	// Tags never change after creation and the dedupe entry only ever names this link,
+	// so they can be read ahead of the transaction
+	current, err := s.client.HMGet(ctx, shortURL, "tags", "dedupe_key").Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+	var tags []string
+	if v, ok := current[0].(string); ok {
+		if err := json.Unmarshal([]byte(v), &tags); err != nil {
+			return fmt.Errorf("invalid tags %q: %w", v, err)
+		}
+	}
+	dedupe, _ := current[1].(string)
+
+	var deleted *redis.IntCmd
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.Del(ctx, shortURL)
+		for _, tag := range tags {
+			pipe.SRem(ctx, tagKey(tag), shortURL)
+		}
+		pipe.ZRem(ctx, expiringLinksKey, shortURL)
+		pipe.HDel(ctx, expiringTagsKey, shortURL)
+		if dedupe != "" {
+			// Eval rather than Run, as a pipeline cannot fall back to sending the script
+			swapDedupeScript.Eval(ctx, pipe, []string{dedupeIndexKey}, dedupe, shortURL, "")
+		}
+		pipe.Del(ctx, historyKey(shortURL))
+		pipe.ZRem(ctx, deletedLinksKey, shortURL)
+		pipe.ZRem(ctx, createdLinksKey, shortURL)
+		pipe.Del(ctx, reportsKey(shortURL))
+		pipe.ZRem(ctx, reportQueueKey, shortURL)
+		pipe.Del(ctx, clicksKey(shortURL))
+		pipe.Del(ctx, clickCountsKey(shortURL))
+		// Eval rather than Run, as a pipeline cannot fall back to sending the script
+		dropVisitorsScript.Eval(ctx, pipe, []string{visitorDaysKey(shortURL)})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+	if deleted.Val() == 0 {
+		return ErrLinkNotFound
+	}
+
+	return indexLink(ctx, s.client, shortURL, nil)
+}
+
+// reportQueueKey is the moderation queue: a sorted set of codes with open reports, scored
+// by when their first open report came in, in Unix milliseconds
+const reportQueueKey = "links:reported"
+
+// reportsKey names the hash of a link's open reports, from reporter to the report as JSON
+func reportsKey(shortURL string) string {
+	return "reports:" + shortURL
+}
+
+// addReportScript stores a report unless the reporter already has one open against the link.
+// KEYS are the link hash, its reports hash and reportQueueKey; ARGV[1] is the reporter,
+// ARGV[2] the report as JSON and ARGV[3] its queue score. It returns the number of open
+// reports, or -1 if the link does not exist.
+var addReportScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+if redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[2]) == 1 then
+	redis.call('ZADD', KEYS[3], 'NX', ARGV[3], KEYS[1])
+end
+return redis.call('HLEN', KEYS[2])
+`)
+
+func (s *RedisStore) AddReport(ctx context.Context, shortURL string, report Report) (int64, error) {
+	if !ValidCode(shortURL) {
+		return 0, ErrLinkNotFound
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	report.CreatedAt = s.timeProvider.Now()
+	data, err := json.Marshal(report)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	keys := []string{shortURL, reportsKey(shortURL), reportQueueKey}
+	open, err := addReportScript.Run(ctx, s.client, keys, report.Reporter, data, report.CreatedAt.UnixMilli()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to add report: %w", err)
+	}
+	if open < 0 {
+		return 0, ErrLinkNotFound
+	}
+	return open, nil
+}
+
+func (s *RedisStore) ListReportedLinks(ctx context.Context, limit int) ([]ReportedLink, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	codes, err := s.client.ZRange(ctx, reportQueueKey, 0, int64(pageSize(limit))-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reported links: %w", err)
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(codes))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, code := range codes {
+			cmds[i] = pipe.HGetAll(ctx, reportsKey(code))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reports: %w", err)
+	}
+
+	links := make([]ReportedLink, 0, len(codes))
+	for i, code := range codes {
+		var reports []Report
+		for _, v := range cmds[i].Val() {
+			var report Report
+			if err := json.Unmarshal([]byte(v), &report); err != nil {
+				return nil, fmt.Errorf("invalid report of %q: %w", code, err)
+			}
+			reports = append(reports, report)
+		}
+		if len(reports) == 0 {
+			continue
+		}
+		sortReports(reports)
+		links = append(links, ReportedLink{Code: code, Reports: reports})
+	}
+	sortReportedLinks(links)
+	return links, nil
+}
+
+// clearReportsScript drops a link's reports and takes it out of the queue, returning how many there were.
+// KEYS are the reports hash and reportQueueKey; ARGV[1] is the code.
+var clearReportsScript = redis.NewScript(`
+local cleared = redis.call('HLEN', KEYS[1])
+redis.call('DEL', KEYS[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+return cleared
+`)
+
+func (s *RedisStore) ClearReports(ctx context.Context, shortURL string) (int64, error) {
+	if !ValidCode(shortURL) {
+		return 0, nil
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	cleared, err := clearReportsScript.Run(ctx, s.client, []string{reportsKey(shortURL), reportQueueKey}, shortURL).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear reports: %w", err)
+	}
+	return cleared, nil
 }
 
 // Ping checks if the Redis connection is alive
-func (s *RedisStore) Ping() error {
-	ctx := context.Background()
+func (s *RedisStore) Ping(ctx context.Context) error {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
 	return s.client.Ping(ctx).Err()
 }
+
+// toHash converts URL data to the field layout of its Redis hash.
+// Timestamps compared inside Lua scripts are stored as Unix nanoseconds.
+func (d URLData) toHash() map[string]any {
+	fields := map[string]any{
+		"original_url": d.OriginalURL,
+		"created_at":   d.CreatedAt.Format(time.RFC3339Nano),
+		"click_count":  d.ClickCount,
+	}
+	if !d.ExpiresAt.IsZero() {
+		fields["expires_at"] = d.ExpiresAt.UnixNano()
+	}
+	if d.MaxClicks > 0 {
+		fields["max_clicks"] = d.MaxClicks
+	}
+	if d.PasswordHash != "" {
+		fields["password_hash"] = d.PasswordHash
+	}
+	if d.ManageTokenHash != "" {
+		fields["manage_token_hash"] = d.ManageTokenHash
+	}
+	if d.Status != "" {
+		fields["status"] = string(d.Status)
+	}
+	if !d.DeletedAt.IsZero() {
+		fields["deleted_at"] = d.DeletedAt.UnixNano()
+	}
+	if d.Title != "" {
+		fields["title"] = d.Title
+	}
+	if d.Description != "" {
+		fields["description"] = d.Description
+	}
+	// Marshalling string slices and maps cannot fail
+	if len(d.Tags) > 0 {
+		tags, _ := json.Marshal(d.Tags)
+		fields["tags"] = tags
+	}
+	if len(d.Metadata) > 0 {
+		metadata, _ := json.Marshal(d.Metadata)
+		fields["metadata"] = metadata
+	}
+	return fields
+}
+
+// hashArgs flattens hash fields into field/value script arguments
+func hashArgs(fields map[string]any) []any {
+	args := make([]any, 0, len(fields)*2)
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+	return args
+}
+
+// urlDataFromHash parses the fields of a Redis URL hash
+func urlDataFromHash(fields map[string]string) (URLData, error) {
+	var urlData URLData
+	urlData.OriginalURL = fields["original_url"]
+	urlData.PasswordHash = fields["password_hash"]
+	urlData.ManageTokenHash = fields["manage_token_hash"]
+	urlData.Status = LinkStatus(fields["status"])
+	if urlData.Status == "" {
+		urlData.Status = StatusActive
+	}
+
+	if v := fields["created_at"]; v != "" {
+		createdAt, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return URLData{}, fmt.Errorf("invalid created_at %q: %w", v, err)
+		}
+		urlData.CreatedAt = createdAt
+	}
+
+	if v := fields["click_count"]; v != "" {
+		clickCount, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return URLData{}, fmt.Errorf("invalid click_count %q: %w", v, err)
+		}
+		urlData.ClickCount = clickCount
+	}
+
+	if v := fields["expires_at"]; v != "" {
+		expiresAt, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return URLData{}, fmt.Errorf("invalid expires_at %q: %w", v, err)
+		}
+		urlData.ExpiresAt = time.Unix(0, expiresAt)
+	}
+
+	if v := fields["max_clicks"]; v != "" {
+		maxClicks, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return URLData{}, fmt.Errorf("invalid max_clicks %q: %w", v, err)
+		}
+		urlData.MaxClicks = maxClicks
+	}
+
+	if v := fields["deleted_at"]; v != "" {
+		deletedAt, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return URLData{}, fmt.Errorf("invalid deleted_at %q: %w", v, err)
+		}
+		urlData.DeletedAt = time.Unix(0, deletedAt)
+	}
+
+	urlData.Title = fields["title"]
+	urlData.Description = fields["description"]
+	if v := fields["tags"]; v != "" {
+		if err := json.Unmarshal([]byte(v), &urlData.Tags); err != nil {
+			return URLData{}, fmt.Errorf("invalid tags %q: %w", v, err)
+		}
+	}
+	if v := fields["metadata"]; v != "" {
+		if err := json.Unmarshal([]byte(v), &urlData.Metadata); err != nil {
+			return URLData{}, fmt.Errorf("invalid metadata %q: %w", v, err)
+		}
+	}
+
+	return urlData, nil
+}
@@ -0,0 +1,259 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisSchemaKey records how many of redisMigrations have been applied
+const redisSchemaKey = "schema_version"
+
+// redisMigrations upgrade data written by older versions of RedisStore.
+// Migration N (1-based) is redisMigrations[N-1]; each must be safe to re-run if interrupted.
+var redisMigrations = []func(ctx context.Context, client *redis.Client) error{
+	// 1: JSON-encoded URLData strings become hashes so clicks can be counted with HINCRBY
+	migrateJSONBlobsToHashes,
+	// 2: every link gets a destination history starting with its current destination
+	backfillDestinationHistory,
+	// 3: the disabled flag becomes the status field
+	migrateDisabledToStatus,
+	// 4: every link is added to the creation-time index used for listing
+	indexLinksByCreation,
+	// 5: every link is added to the search index
+	indexLinksForSearch,
+	// 6: every link with a TTL is recorded so its index entries can be swept once Redis deletes it
+	indexExpiringLinks,
+}
+
+// migrateRedis applies every migration newer than the version recorded under redisSchemaKey
+func migrateRedis(ctx context.Context, client *redis.Client) error {
+	current, err := client.Get(ctx, redisSchemaKey).Int()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if current > len(redisMigrations) {
+		return fmt.Errorf("redis schema version %d is newer than supported version %d", current, len(redisMigrations))
+	}
+
+	for i := current; i < len(redisMigrations); i++ {
+		version := i + 1
+		if err := redisMigrations[i](ctx, client); err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+		if err := client.Set(ctx, redisSchemaKey, version, 0).Err(); err != nil {
+			return fmt.Errorf("failed to record schema version %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// migrateJSONBlobsToHashes rewrites every legacy JSON string key as a URL hash
+func migrateJSONBlobsToHashes(ctx context.Context, client *redis.Client) error {
+	iter := client.ScanType(ctx, 0, "*", 100, "string").Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if key == "url_counter" || key == redisSchemaKey {
+			continue
+		}
+		if err := migrateJSONBlob(ctx, client, key); err != nil {
+			return fmt.Errorf("failed to migrate key %q: %w", key, err)
+		}
+	}
+	return iter.Err()
+}
+
+func migrateJSONBlob(ctx context.Context, client *redis.Client, key string) error {
+	convert := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var urlData URLData
+		if err := json.Unmarshal([]byte(data), &urlData); err != nil || urlData.OriginalURL == "" {
+			log.Printf("Skipping Redis key %q: not a URL record", key)
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.HSet(ctx, key, urlData.toHash())
+			return nil
+		})
+		return err
+	}
+
+	// WATCH the key so a click served by an older instance mid-migration is not lost;
+	// if the blob changed under us, convert the new value instead.
+	for {
+		err := client.Watch(ctx, convert, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+}
+
+// backfillHistoryScript starts the history of a link that has none, keeping any
+// TTL the link has. KEYS are the link hash and its history list.
+var backfillHistoryScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 or redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local link = redis.call('HMGET', KEYS[1], 'original_url', 'created_at')
+if not link[1] then
+	return 0
+end
+local entry = {original_url = link[1], actor = ARGV[1]}
+if link[2] then
+	entry.changed_at = link[2]
+end
+redis.call('RPUSH', KEYS[2], cjson.encode(entry))
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return 1
+`)
+
+// backfillDestinationHistory records the current destination of every link hash as its first history entry
+func backfillDestinationHistory(ctx context.Context, client *redis.Client) error {
+	iter := client.ScanType(ctx, 0, "*", 100, "hash").Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if strings.Contains(key, ":") {
+			// Auxiliary keys are namespaced with ':', which codes cannot contain
+			continue
+		}
+		if err := backfillHistoryScript.Run(ctx, client, []string{key, historyKey(key)}, ActorCreator).Err(); err != nil {
+			return fmt.Errorf("failed to backfill history of %q: %w", key, err)
+		}
+	}
+	return iter.Err()
+}
+
+// disabledToStatusScript rewrites the disabled flag of one link hash as its status
+var disabledToStatusScript = redis.NewScript(`
+local disabled = redis.call('HGET', KEYS[1], 'disabled')
+if not disabled then
+	return 0
+end
+if disabled == '1' then
+	redis.call('HSET', KEYS[1], 'status', 'disabled')
+end
+redis.call('HDEL', KEYS[1], 'disabled')
+return 1
+`)
+
+// migrateDisabledToStatus replaces the disabled flag on every link hash with a status
+func migrateDisabledToStatus(ctx context.Context, client *redis.Client) error {
+	iter := client.ScanType(ctx, 0, "*", 100, "hash").Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if strings.Contains(key, ":") {
+			continue
+		}
+		if err := disabledToStatusScript.Run(ctx, client, []string{key}).Err(); err != nil {
+			return fmt.Errorf("failed to migrate status of %q: %w", key, err)
+		}
+	}
+	return iter.Err()
+}
+
+// indexLinksByCreation adds every link hash to createdLinksKey
+func indexLinksByCreation(ctx context.Context, client *redis.Client) error {
+	iter := client.ScanType(ctx, 0, "*", 100, "hash").Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if strings.Contains(key, ":") {
+			continue
+		}
+
+		createdAt, err := client.HGet(ctx, key, "created_at").Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", key, err)
+		}
+		t, err := time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			log.Printf("Skipping Redis key %q: invalid created_at %q", key, createdAt)
+			continue
+		}
+
+		// NX keeps the score of links indexed by a newer instance mid-migration
+		if err := client.ZAddNX(ctx, createdLinksKey, redis.Z{Score: float64(t.UnixMilli()), Member: key}).Err(); err != nil {
+			return fmt.Errorf("failed to index %q: %w", key, err)
+		}
+	}
+	return iter.Err()
+}
+
+// indexLinksForSearch indexes every link hash under its search terms
+func indexLinksForSearch(ctx context.Context, client *redis.Client) error {
+	iter := client.ScanType(ctx, 0, "*", 100, "hash").Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if strings.Contains(key, ":") {
+			continue
+		}
+
+		originalURL, err := client.HGet(ctx, key, "original_url").Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", key, err)
+		}
+
+		if err := indexLink(ctx, client, key, searchTerms(key, URLData{OriginalURL: originalURL})); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// indexExpiringLinks records every link hash with a TTL in expiringLinksKey, with its tags in expiringTagsKey
+func indexExpiringLinks(ctx context.Context, client *redis.Client) error {
+	iter := client.ScanType(ctx, 0, "*", 100, "hash").Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if strings.Contains(key, ":") {
+			continue
+		}
+
+		ttl, err := client.PTTL(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read TTL of %q: %w", key, err)
+		}
+		if ttl <= 0 {
+			continue
+		}
+		tags, err := client.HGet(ctx, key, "tags").Result()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("failed to read %q: %w", key, err)
+		}
+
+		deleteAt := time.Now().Add(ttl).UnixMilli()
+		if err := client.ZAdd(ctx, expiringLinksKey, redis.Z{Score: float64(deleteAt), Member: key}).Err(); err != nil {
+			return fmt.Errorf("failed to index %q: %w", key, err)
+		}
+		if tags != "" {
+			if err := client.HSet(ctx, expiringTagsKey, key, tags).Err(); err != nil {
+				return fmt.Errorf("failed to index %q: %w", key, err)
+			}
+		}
+	}
+	return iter.Err()
+}
@@ -2,7 +2,12 @@ package store
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"os"
+	"slices"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -31,12 +36,15 @@ func setupTestRedis(t *testing.T) *RedisStore {
 		Username: os.Getenv("REDIS_USERNAME"),
 		Password: os.Getenv("REDIS_PASSWORD"),
 		DB:       1, // Use DB 1 for testing
+
+		ContextTimeoutEnabled: true,
 	})
 
-	// Test connection
+	// Test connection; the Lua scripts are only exercised against a real server, so a missing one is a failure
 	ctx := context.Background()
 	if err := client.Ping(ctx).Err(); err != nil {
-		t.Fatalf("Failed to connect to test Redis: %v", err)
+		_ = client.Close()
+		t.Fatalf("Failed to connect to test Redis at %s: %v", addr, err)
 	}
 
 	// Clear the test database
@@ -85,7 +93,7 @@ func TestCreateShortURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := store.CreateShortURL(tt.originalURL)
+			got, err := store.CreateShortURL(context.Background(), tt.originalURL, CreateOptions{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CreateShortURL() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -102,7 +110,7 @@ func TestGetOriginalURL(t *testing.T) {
 
 	// Create a test URL
 	originalURL := "https://example.com"
-	shortURL, err := store.CreateShortURL(originalURL)
+	shortURL, err := store.CreateShortURL(context.Background(), originalURL, CreateOptions{})
 	if err != nil {
 		t.Fatalf("Failed to create test URL: %v", err)
 	}
@@ -132,7 +140,7 @@ func TestGetOriginalURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := store.GetOriginalURL(tt.shortURL)
+			got, err := store.GetOriginalURL(context.Background(), tt.shortURL)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetOriginalURL() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -149,7 +157,7 @@ func TestGetClickCount(t *testing.T) {
 
 	// Create a test URL
 	originalURL := "https://example.com"
-	shortURL, err := store.CreateShortURL(originalURL)
+	shortURL, err := store.CreateShortURL(context.Background(), originalURL, CreateOptions{})
 	if err != nil {
 		t.Fatalf("Failed to create test URL: %v", err)
 	}
@@ -158,7 +166,7 @@ func TestGetClickCount(t *testing.T) {
 	shortCode := shortURL[len(os.Getenv("SHORTENME_URL"))+1:]
 
 	// Access the URL to increment click count
-	_, err = store.GetOriginalURL(shortCode)
+	_, err = store.GetOriginalURL(context.Background(), shortCode)
 	if err != nil {
 		t.Fatalf("Failed to access test URL: %v", err)
 	}
@@ -185,7 +193,7 @@ func TestGetClickCount(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := store.GetClickCount(tt.shortURL)
+			got, err := store.GetClickCount(context.Background(), tt.shortURL)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetClickCount() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -200,7 +208,634 @@ func TestGetClickCount(t *testing.T) {
 func TestPing(t *testing.T) {
 	store := setupTestRedis(t)
 
-	if err := store.Ping(); err != nil {
+	if err := store.Ping(context.Background()); err != nil {
 		t.Errorf("Ping() error = %v", err)
 	}
 }
+
+func TestConcurrentClicksAreNotLost(t *testing.T) {
+	store := setupTestRedis(t)
+
+	shortURL, err := store.CreateShortURL(context.Background(), "https://example.com", CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+	shortCode := shortURL[len(os.Getenv("SHORTENME_URL"))+1:]
+
+	// Simulate parallel redirects hitting the same popular link
+	const redirects = 200
+	var wg sync.WaitGroup
+	for i := 0; i < redirects; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.GetOriginalURL(context.Background(), shortCode); err != nil {
+				t.Errorf("GetOriginalURL() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := store.GetClickCount(context.Background(), shortCode)
+	if err != nil {
+		t.Fatalf("GetClickCount() error = %v", err)
+	}
+	if got != redirects {
+		t.Errorf("GetClickCount() = %v, want %v (increments were lost)", got, redirects)
+	}
+
+	// Counting clicks must not touch the other fields of the link
+	fields, err := store.client.HGetAll(context.Background(), shortCode).Result()
+	if err != nil {
+		t.Fatalf("HGetAll() error = %v", err)
+	}
+	if fields["original_url"] != "https://example.com" {
+		t.Errorf("original_url = %q after concurrent clicks, want https://example.com", fields["original_url"])
+	}
+}
+
+func TestMigrateJSONBlobsToHashes(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	// Seed data the way older versions of RedisStore wrote it
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	legacy, err := json.Marshal(URLData{
+		OriginalURL: "https://example.com/legacy",
+		CreatedAt:   createdAt,
+		ClickCount:  7,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal legacy data: %v", err)
+	}
+	if err := store.client.Set(ctx, "legacy1", legacy, 0).Err(); err != nil {
+		t.Fatalf("Failed to seed legacy key: %v", err)
+	}
+	if err := store.client.Set(ctx, "url_counter", 41, 0).Err(); err != nil {
+		t.Fatalf("Failed to seed counter: %v", err)
+	}
+
+	// Running twice must be harmless
+	for i := 0; i < 2; i++ {
+		if err := migrateRedis(ctx, store.client); err != nil {
+			t.Fatalf("migrateRedis() run %d error = %v", i+1, err)
+		}
+	}
+
+	if got, err := store.client.Type(ctx, "legacy1").Result(); err != nil || got != "hash" {
+		t.Fatalf("legacy key type = %q, %v, want hash", got, err)
+	}
+	if got, err := store.client.Get(ctx, "url_counter").Int64(); err != nil || got != 41 {
+		t.Errorf("url_counter = %v, %v, want 41 untouched", got, err)
+	}
+	if got, err := store.client.Get(ctx, redisSchemaKey).Int(); err != nil || got != len(redisMigrations) {
+		t.Errorf("schema version = %v, %v, want %v", got, err, len(redisMigrations))
+	}
+
+	if got, err := store.GetOriginalURL(ctx, "legacy1"); err != nil || got != "https://example.com/legacy" {
+		t.Errorf("GetOriginalURL() = %q, %v, want https://example.com/legacy", got, err)
+	}
+	if got, err := store.GetClickCount(ctx, "legacy1"); err != nil || got != 8 {
+		t.Errorf("GetClickCount() = %v, %v, want 8", got, err)
+	}
+
+	fields, err := store.client.HGetAll(ctx, "legacy1").Result()
+	if err != nil {
+		t.Fatalf("HGetAll() error = %v", err)
+	}
+	urlData, err := urlDataFromHash(fields)
+	if err != nil {
+		t.Fatalf("urlDataFromHash() error = %v", err)
+	}
+	if !urlData.CreatedAt.Equal(createdAt) {
+		t.Errorf("CreatedAt = %v, want %v", urlData.CreatedAt, createdAt)
+	}
+}
+
+func TestBackfillDestinationHistory(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	// Seed a link hash the way RedisStore wrote it before histories existed
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	urlData := URLData{OriginalURL: "https://example.com/legacy", CreatedAt: createdAt}
+	if err := store.client.HSet(ctx, "legacy1", urlData.toHash()).Err(); err != nil {
+		t.Fatalf("Failed to seed legacy hash: %v", err)
+	}
+	if err := store.client.PExpire(ctx, "legacy1", time.Hour).Err(); err != nil {
+		t.Fatalf("Failed to set legacy TTL: %v", err)
+	}
+	if err := store.client.Set(ctx, redisSchemaKey, 1, 0).Err(); err != nil {
+		t.Fatalf("Failed to seed schema version: %v", err)
+	}
+
+	if err := migrateRedis(ctx, store.client); err != nil {
+		t.Fatalf("migrateRedis() error = %v", err)
+	}
+	// Re-running the backfill must not add a second entry
+	if err := backfillDestinationHistory(ctx, store.client); err != nil {
+		t.Fatalf("backfillDestinationHistory() error = %v", err)
+	}
+
+	history, err := store.GetLinkHistory(ctx, "legacy1")
+	if err != nil {
+		t.Fatalf("GetLinkHistory() error = %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("GetLinkHistory() returned %d entries, want 1: %+v", len(history), history)
+	}
+	if got := history[0]; got.OriginalURL != "https://example.com/legacy" || !got.ChangedAt.Equal(createdAt) || got.Actor != ActorCreator {
+		t.Errorf("history[0] = %+v, want the legacy destination at %v", got, createdAt)
+	}
+
+	if ttl, err := store.client.PTTL(ctx, historyKey("legacy1")).Result(); err != nil || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("history PTTL() = %v, %v, want the link's TTL", ttl, err)
+	}
+}
+
+func TestMigrateDisabledToStatus(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	// Seed links with the disabled flag older versions of RedisStore wrote
+	for code, disabled := range map[string]string{"off": "1", "on": "0"} {
+		err := store.client.HSet(ctx, code, "original_url", "https://example.com/"+code, "disabled", disabled).Err()
+		if err != nil {
+			t.Fatalf("Failed to seed %q: %v", code, err)
+		}
+	}
+	if err := store.client.Set(ctx, redisSchemaKey, 2, 0).Err(); err != nil {
+		t.Fatalf("Failed to seed schema version: %v", err)
+	}
+
+	if err := migrateRedis(ctx, store.client); err != nil {
+		t.Fatalf("migrateRedis() error = %v", err)
+	}
+
+	if _, err := store.GetOriginalURL(ctx, "off"); err != ErrLinkDisabled {
+		t.Errorf("GetOriginalURL(off) error = %v, want ErrLinkDisabled", err)
+	}
+	if got, err := store.GetOriginalURL(ctx, "on"); err != nil || got != "https://example.com/on" {
+		t.Errorf("GetOriginalURL(on) = %q, %v, want https://example.com/on", got, err)
+	}
+	if exists, err := store.client.HExists(ctx, "off", "disabled").Result(); err != nil || exists {
+		t.Errorf("disabled field still present after migration: %v, %v", exists, err)
+	}
+}
+
+func TestIndexLinksByCreation(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	// Seed links written before the index existed
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, code := range []string{"older", "newer"} {
+		urlData := URLData{OriginalURL: "https://example.com/" + code, CreatedAt: createdAt.Add(time.Duration(i) * time.Hour)}
+		if err := store.client.HSet(ctx, code, urlData.toHash()).Err(); err != nil {
+			t.Fatalf("Failed to seed %q: %v", code, err)
+		}
+	}
+	if err := store.client.Set(ctx, redisSchemaKey, 3, 0).Err(); err != nil {
+		t.Fatalf("Failed to seed schema version: %v", err)
+	}
+
+	if err := migrateRedis(ctx, store.client); err != nil {
+		t.Fatalf("migrateRedis() error = %v", err)
+	}
+
+	page, err := store.ListLinks(ctx, ListOptions{})
+	if err != nil {
+		t.Fatalf("ListLinks() error = %v", err)
+	}
+	if len(page.Links) != 2 || page.Links[0].Code != "newer" || page.Links[1].Code != "older" {
+		t.Errorf("ListLinks() = %+v, want newer then older", page.Links)
+	}
+}
+
+func TestIndexLinksForSearch(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	// Seed a link written before the search index existed
+	urlData := URLData{OriginalURL: "https://example.com/legacy-page", CreatedAt: time.Now()}
+	if err := store.client.HSet(ctx, "legacy", urlData.toHash()).Err(); err != nil {
+		t.Fatalf("Failed to seed link: %v", err)
+	}
+	if err := store.client.Set(ctx, redisSchemaKey, 4, 0).Err(); err != nil {
+		t.Fatalf("Failed to seed schema version: %v", err)
+	}
+
+	if err := migrateRedis(ctx, store.client); err != nil {
+		t.Fatalf("migrateRedis() error = %v", err)
+	}
+
+	for _, query := range []string{"legacy", "example page"} {
+		records, err := store.SearchLinks(ctx, SearchOptions{Query: query})
+		if err != nil {
+			t.Fatalf("SearchLinks(%q) error = %v", query, err)
+		}
+		if len(records) != 1 || records[0].Code != "legacy" {
+			t.Errorf("SearchLinks(%q) = %+v, want the legacy link", query, records)
+		}
+	}
+}
+
+func TestSearchLinksDropsExpiredKeysFromIndex(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	if _, err := store.CreateShortURL(ctx, "https://example.com/gone", CreateOptions{Alias: "gone"}); err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+	// Simulate Redis expiring the link hash through its TTL
+	if err := store.client.Del(ctx, "gone").Err(); err != nil {
+		t.Fatalf("Failed to delete link hash: %v", err)
+	}
+
+	records, err := store.SearchLinks(ctx, SearchOptions{Query: "gone"})
+	if err != nil {
+		t.Fatalf("SearchLinks() error = %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("SearchLinks() = %+v, want no results", records)
+	}
+	if n, err := store.client.Exists(ctx, searchDocKey("gone"), searchTermKey("gone")).Result(); err != nil || n != 0 {
+		t.Errorf("search index still holds the expired link (%d keys, err %v)", n, err)
+	}
+	if n, err := store.client.ZCard(ctx, searchTermsKey).Result(); err != nil || n != 0 {
+		t.Errorf("search terms left behind: %d (err %v)", n, err)
+	}
+}
+
+func TestSearchLinksLoadsOnlyAPage(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+	clock := store.timeProvider.(*mockTimeProvider)
+
+	for _, alias := range []string{"promo-old", "promo-mid", "promo-new"} {
+		clock.now = clock.now.Add(time.Minute)
+		if _, err := store.CreateShortURL(ctx, "https://example.com/"+alias, CreateOptions{Alias: alias}); err != nil {
+			t.Fatalf("Failed to create %s: %v", alias, err)
+		}
+	}
+	// Simulate Redis expiring the newest link hash through its TTL
+	if err := store.client.Del(ctx, "promo-new").Err(); err != nil {
+		t.Fatalf("Failed to delete link hash: %v", err)
+	}
+
+	// The expired link takes no place in the page; the next newest fills it
+	records, err := store.SearchLinks(ctx, SearchOptions{Query: "promo", Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchLinks() error = %v", err)
+	}
+	if len(records) != 2 || records[0].Code != "promo-mid" || records[1].Code != "promo-old" {
+		t.Errorf("SearchLinks() = %+v, want promo-mid then promo-old", records)
+	}
+}
+
+func TestSearchLinksCapsPrefixExpansion(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	if _, err := store.CreateShortURL(ctx, "https://example.com/a", CreateOptions{Alias: "exact"}); err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+	// Flood the index with more terms starting with "a" than a search word expands to
+	filler := make([]redis.Z, maxSearchPrefixTerms)
+	for i := range filler {
+		filler[i] = redis.Z{Member: fmt.Sprintf("a%04d", i)}
+	}
+	if err := store.client.ZAdd(ctx, searchTermsKey, filler...).Err(); err != nil {
+		t.Fatalf("Failed to seed search terms: %v", err)
+	}
+
+	// The word itself sorts first, so an exact match survives the cap
+	records, err := store.SearchLinks(ctx, SearchOptions{Query: "a"})
+	if err != nil {
+		t.Fatalf("SearchLinks() error = %v", err)
+	}
+	if len(records) != 1 || records[0].Code != "exact" {
+		t.Errorf("SearchLinks(a) = %+v, want the exact link", records)
+	}
+}
+
+func TestTagIndexDropsRemovedLinks(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	for _, alias := range []string{"purged", "expired", "kept"} {
+		if _, err := store.CreateShortURL(ctx, "https://example.com/"+alias, CreateOptions{Alias: alias, Tags: []string{"spring"}}); err != nil {
+			t.Fatalf("Failed to create %q: %v", alias, err)
+		}
+	}
+
+	if err := store.SetLinkStatus(ctx, "purged", StatusDeleted); err != nil {
+		t.Fatalf("SetLinkStatus() error = %v", err)
+	}
+	if _, err := store.PurgeDeletedLinks(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PurgeDeletedLinks() error = %v", err)
+	}
+	// Simulate Redis expiring a link hash through its TTL
+	if err := store.client.Del(ctx, "expired").Err(); err != nil {
+		t.Fatalf("Failed to delete link hash: %v", err)
+	}
+
+	page, err := store.ListLinks(ctx, ListOptions{Tag: "spring"})
+	if err != nil {
+		t.Fatalf("ListLinks() error = %v", err)
+	}
+	if len(page.Links) != 1 || page.Links[0].Code != "kept" {
+		t.Errorf("ListLinks(spring) = %+v, want only kept", page.Links)
+	}
+	members, err := store.client.SMembers(ctx, tagKey("spring")).Result()
+	if err != nil {
+		t.Fatalf("SMembers() error = %v", err)
+	}
+	if len(members) != 1 || members[0] != "kept" {
+		t.Errorf("tag set = %v, want [kept]", members)
+	}
+}
+
+func TestListLinksDropsExpiredKeysFromIndex(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	var codes []string
+	for i := 0; i < 3; i++ {
+		shortURL, err := store.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		if err != nil {
+			t.Fatalf("Failed to create test URL: %v", err)
+		}
+		codes = append(codes, shortURL[len(os.Getenv("SHORTENME_URL"))+1:])
+	}
+
+	// Simulate Redis expiring a link hash through its TTL
+	if err := store.client.Del(ctx, codes[1]).Err(); err != nil {
+		t.Fatalf("Failed to delete link hash: %v", err)
+	}
+
+	page, err := store.ListLinks(ctx, ListOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("ListLinks() error = %v", err)
+	}
+	next, err := store.ListLinks(ctx, ListOptions{Limit: 1, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("ListLinks() error = %v", err)
+	}
+	if len(next.Links) != 1 || next.Links[0].Code == codes[1] || next.NextCursor != "" {
+		t.Errorf("second page = %+v, cursor %q, want one live link and no cursor", next.Links, next.NextCursor)
+	}
+
+	if _, err := store.client.ZScore(ctx, createdLinksKey, codes[1]).Result(); err != redis.Nil {
+		t.Errorf("expired link still in the index: %v", err)
+	}
+}
+
+func TestExpiredLinkTTL(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	shortURL, err := store.CreateShortURL(ctx, "https://example.com", CreateOptions{ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+	keepCode := shortURL[len(os.Getenv("SHORTENME_URL"))+1:]
+
+	// Without a configured TTL, expired links are kept
+	if ttl, err := store.client.PTTL(ctx, keepCode).Result(); err != nil || ttl != -1 {
+		t.Errorf("PTTL() without expiredLinkTTL = %v, %v, want -1 (no expiry)", ttl, err)
+	}
+
+	store.expiredLinkTTL = 24 * time.Hour
+	shortURL, err = store.CreateShortURL(ctx, "https://example.com", CreateOptions{ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+	dropCode := shortURL[len(os.Getenv("SHORTENME_URL"))+1:]
+
+	ttl, err := store.client.PTTL(ctx, dropCode).Result()
+	if err != nil {
+		t.Fatalf("PTTL() error = %v", err)
+	}
+	if ttl < 24*time.Hour || ttl > 25*time.Hour {
+		t.Errorf("PTTL() = %v, want between 24h and 25h (expiry plus retention)", ttl)
+	}
+
+	// Links without an expiry never get a TTL
+	shortURL, err = store.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+	foreverCode := shortURL[len(os.Getenv("SHORTENME_URL"))+1:]
+	if ttl, err := store.client.PTTL(ctx, foreverCode).Result(); err != nil || ttl != -1 {
+		t.Errorf("PTTL() for link without expiry = %v, %v, want -1", ttl, err)
+	}
+}
+
+func TestPurgeClickEventsInBatches(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	total := 2*purgeBatch + 1
+	for i := 0; i < total; i++ {
+		alias := "clicked-" + strconv.Itoa(i)
+		if _, err := store.CreateShortURL(ctx, "https://example.com", CreateOptions{Alias: alias}); err != nil {
+			t.Fatalf("Failed to create %q: %v", alias, err)
+		}
+		if _, err := store.FollowLink(ctx, alias, ClickEvent{}); err != nil {
+			t.Fatalf("FollowLink(%q) error = %v", alias, err)
+		}
+	}
+
+	purged, err := store.PurgeClickEvents(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("PurgeClickEvents() error = %v", err)
+	}
+	if purged != int64(total) {
+		t.Errorf("PurgeClickEvents() = %d, want %d", purged, total)
+	}
+}
+
+func TestPurgeDeletedLinksInBatches(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	total := 2*purgeBatch + 1
+	for i := 0; i < total; i++ {
+		alias := "deleted-" + strconv.Itoa(i)
+		if _, err := store.CreateShortURL(ctx, "https://example.com", CreateOptions{Alias: alias}); err != nil {
+			t.Fatalf("Failed to create %q: %v", alias, err)
+		}
+		if err := store.SetLinkStatus(ctx, alias, StatusDeleted); err != nil {
+			t.Fatalf("SetLinkStatus(%q) error = %v", alias, err)
+		}
+	}
+	// One link was deleted again after the cutoff and one restored, without the index catching up
+	if err := store.client.HSet(ctx, "deleted-0", "deleted_at", time.Now().Add(time.Hour).UnixNano()).Err(); err != nil {
+		t.Fatalf("Failed to move deleted_at: %v", err)
+	}
+	if err := store.client.HSet(ctx, "deleted-1", "status", string(StatusActive)).Err(); err != nil {
+		t.Fatalf("Failed to restore link: %v", err)
+	}
+
+	purged, err := store.PurgeDeletedLinks(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("PurgeDeletedLinks() error = %v", err)
+	}
+	if purged != int64(total-2) {
+		t.Errorf("PurgeDeletedLinks() = %d, want %d", purged, total-2)
+	}
+	remaining, err := store.client.ZRange(ctx, deletedLinksKey, 0, -1).Result()
+	if err != nil {
+		t.Fatalf("ZRange() error = %v", err)
+	}
+	if len(remaining) != 1 || remaining[0] != "deleted-0" {
+		t.Errorf("deleted index = %v, want only deleted-0", remaining)
+	}
+}
+
+func TestConcurrentUpdatesKeepSearchIndexInStep(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	if _, err := store.CreateShortURL(ctx, "https://example.com/start", CreateOptions{Alias: "moving", Title: "Spring sale"}); err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			destination := fmt.Sprintf("https://example.com/dest%d", i)
+			if err := store.UpdateLink(ctx, "moving", LinkUpdate{OriginalURL: &destination}); err != nil {
+				t.Errorf("UpdateLink() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	urlData, err := store.GetURLData(ctx, "moving")
+	if err != nil || urlData == nil {
+		t.Fatalf("GetURLData() = %v, %v", urlData, err)
+	}
+	indexed, err := store.client.SMembers(ctx, searchDocKey("moving")).Result()
+	if err != nil {
+		t.Fatalf("SMembers() error = %v", err)
+	}
+	want := searchTerms("moving", *urlData)
+	slices.Sort(indexed)
+	slices.Sort(want)
+	if !slices.Equal(indexed, want) {
+		t.Errorf("indexed terms = %v, want those of the final destination %v", indexed, want)
+	}
+}
+
+func TestPurgeSweepsLinksExpiredByTTL(t *testing.T) {
+	store := setupTestRedis(t)
+	store.expiredLinkTTL = time.Hour
+	clock := store.timeProvider.(*mockTimeProvider)
+	ctx := context.Background()
+
+	if _, err := store.CreateShortURL(ctx, "https://example.com/flash", CreateOptions{Alias: "flash", Tags: []string{"spring"}, ExpiresIn: time.Hour}); err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+	if _, err := store.CreateShortURL(ctx, "https://example.com/kept", CreateOptions{Alias: "kept", Tags: []string{"spring"}}); err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+
+	// A link still running its TTL keeps its index entries
+	if _, err := store.PurgeDeletedLinks(ctx, clock.now); err != nil {
+		t.Fatalf("PurgeDeletedLinks() error = %v", err)
+	}
+	if ok, err := store.client.SIsMember(ctx, tagKey("spring"), "flash").Result(); err != nil || !ok {
+		t.Errorf("tag set lost flash before its TTL ran out (%v, err %v)", ok, err)
+	}
+
+	// Simulate Redis deleting the link once its TTL runs out
+	if err := store.client.Del(ctx, "flash", historyKey("flash")).Err(); err != nil {
+		t.Fatalf("Failed to delete link hash: %v", err)
+	}
+	clock.now = clock.now.Add(3 * time.Hour)
+	if _, err := store.PurgeDeletedLinks(ctx, clock.now.Add(-time.Hour)); err != nil {
+		t.Fatalf("PurgeDeletedLinks() error = %v", err)
+	}
+
+	if members, err := store.client.SMembers(ctx, tagKey("spring")).Result(); err != nil || len(members) != 1 || members[0] != "kept" {
+		t.Errorf("tag set = %v, %v; want [kept]", members, err)
+	}
+	if n, err := store.client.Exists(ctx, searchDocKey("flash"), searchTermKey("flash"), expiringTagsKey).Result(); err != nil || n != 0 {
+		t.Errorf("index keys left behind by flash: %d (err %v)", n, err)
+	}
+	for _, key := range []string{createdLinksKey, expiringLinksKey} {
+		if err := store.client.ZScore(ctx, key, "flash").Err(); err != redis.Nil {
+			t.Errorf("ZScore(%s, flash) error = %v, want redis.Nil", key, err)
+		}
+	}
+}
+
+func TestDedupeEntryGoesWithLink(t *testing.T) {
+	store := setupTestRedis(t)
+	clock := store.timeProvider.(*mockTimeProvider)
+	ctx := context.Background()
+
+	reuse := func() string {
+		t.Helper()
+		shortURL, _, err := store.CreateOrReuseShortURL(ctx, "https://example.com/reused", CreateOptions{})
+		if err != nil {
+			t.Fatalf("CreateOrReuseShortURL() error = %v", err)
+		}
+		code := shortURL[len(os.Getenv("SHORTENME_URL"))+1:]
+		if n, err := store.client.HLen(ctx, dedupeIndexKey).Result(); err != nil || n != 1 {
+			t.Fatalf("dedupe entries = %d, %v; want 1", n, err)
+		}
+		return code
+	}
+
+	if err := store.DeleteLink(ctx, reuse()); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+	if n, err := store.client.HLen(ctx, dedupeIndexKey).Result(); err != nil || n != 0 {
+		t.Errorf("dedupe entries after DeleteLink = %d, %v; want 0", n, err)
+	}
+
+	if err := store.SetLinkStatus(ctx, reuse(), StatusDeleted); err != nil {
+		t.Fatalf("SetLinkStatus() error = %v", err)
+	}
+	if purged, err := store.PurgeDeletedLinks(ctx, clock.now.Add(time.Hour)); err != nil || purged != 1 {
+		t.Fatalf("PurgeDeletedLinks() = %d, %v; want 1", purged, err)
+	}
+	if n, err := store.client.HLen(ctx, dedupeIndexKey).Result(); err != nil || n != 0 {
+		t.Errorf("dedupe entries after PurgeDeletedLinks = %d, %v; want 0", n, err)
+	}
+}
+
+func TestIndexExpiringLinks(t *testing.T) {
+	store := setupTestRedis(t)
+	ctx := context.Background()
+
+	// Seed links written before expiring links were recorded
+	for _, code := range []string{"expiring", "forever"} {
+		urlData := URLData{OriginalURL: "https://example.com/" + code, CreatedAt: time.Now(), Tags: []string{"spring"}}
+		if err := store.client.HSet(ctx, code, urlData.toHash()).Err(); err != nil {
+			t.Fatalf("Failed to seed link: %v", err)
+		}
+	}
+	if err := store.client.PExpire(ctx, "expiring", time.Hour).Err(); err != nil {
+		t.Fatalf("Failed to set TTL: %v", err)
+	}
+	if err := store.client.Set(ctx, redisSchemaKey, 5, 0).Err(); err != nil {
+		t.Fatalf("Failed to seed schema version: %v", err)
+	}
+
+	if err := migrateRedis(ctx, store.client); err != nil {
+		t.Fatalf("migrateRedis() error = %v", err)
+	}
+
+	if codes, err := store.client.ZRange(ctx, expiringLinksKey, 0, -1).Result(); err != nil || len(codes) != 1 || codes[0] != "expiring" {
+		t.Errorf("expiring links = %v, %v; want [expiring]", codes, err)
+	}
+	if tags, err := store.client.HGet(ctx, expiringTagsKey, "expiring").Result(); err != nil || tags != `["spring"]` {
+		t.Errorf("recorded tags = %q, %v; want [\"spring\"]", tags, err)
+	}
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"slices"
+	"time"
+)
+
+// Report is a visitor's complaint that a link is malicious
+type Report struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details,omitempty"`
+	// Reporter identifies who sent the report without revealing them, such as a keyed hash of their IP
+	Reporter string `json:"reporter"`
+	// CreatedAt is set by the store when the report is added
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReportedLink is a link in the moderation queue with its open reports, oldest first
+type ReportedLink struct {
+	Code    string
+	Reports []Report
+}
+
+// sortReports orders a link's reports oldest first
+func sortReports(reports []Report) {
+	slices.SortStableFunc(reports, func(a, b Report) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+}
+
+// sortReportedLinks orders the moderation queue by each link's oldest report, then by code
+func sortReportedLinks(links []ReportedLink) {
+	slices.SortFunc(links, func(a, b ReportedLink) int {
+		if c := a.Reports[0].CreatedAt.Compare(b.Reports[0].CreatedAt); c != 0 {
+			return c
+		}
+		if a.Code < b.Code {
+			return -1
+		}
+		if a.Code > b.Code {
+			return 1
+		}
+		return 0
+	})
+}
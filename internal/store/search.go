@@ -0,0 +1,65 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SearchOptions select links by the words in their destination URL, code, title and tags.
+// Every word of Query must be the start of a word of the link, ignoring case.
+type SearchOptions struct {
+	Query string
+	// Limit caps the number of results, DefaultListLimit if zero and at most MaxListLimit
+	Limit int
+}
+
+// limit returns the number of results to return
+func (o SearchOptions) limit() int {
+	return pageSize(o.Limit)
+}
+
+// searchTokens splits text into lowercase runs of letters and digits, without duplicates
+func searchTokens(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(words))
+	tokens := words[:0]
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+// searchTerms returns the words a link can be found by
+func searchTerms(code string, d URLData) []string {
+	return searchTokens(strings.Join(append([]string{code, d.OriginalURL, d.Title}, d.Tags...), " "))
+}
+
+// matchesSearch reports whether every query token starts one of the terms
+func matchesSearch(terms, query []string) bool {
+	for _, token := range query {
+		found := false
+		for _, term := range terms {
+			if strings.HasPrefix(term, token) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// prefixEnd returns a string that sorts after every term starting with prefix,
+// for range scans over sorted terms. Terms hold only letters and digits, never utf8.MaxRune.
+func prefixEnd(prefix string) string {
+	return prefix + string(utf8.MaxRune)
+}
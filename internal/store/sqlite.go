@@ -0,0 +1,888 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore is a Store backed by an embedded SQLite database file,
+// for deployments that want durable links without running Redis.
+type SQLiteStore struct {
+	db           *sql.DB
+	timeProvider TimeProvider
+}
+
+func NewSQLiteStore() (*SQLiteStore, error) {
+	path := os.Getenv("SQLITE_PATH")
+	if path == "" {
+		return nil, fmt.Errorf("missing required SQLITE_PATH environment variable")
+	}
+
+	return openSQLiteStore(path)
+}
+
+// openSQLiteStore opens the database at dsn and brings its schema up to date
+func openSQLiteStore(dsn string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", dsn+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+
+	// SQLite allows a single writer; serialising on one connection avoids SQLITE_BUSY
+	// and keeps ":memory:" databases shared across calls.
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to connect to SQLite: %w", err)
+	}
+
+	if err := migrateSQLite(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to migrate SQLite schema: %w", err)
+	}
+
+	return &SQLiteStore{
+		db:           db,
+		timeProvider: DefaultTimeProvider{},
+	}, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) CreateShortURL(ctx context.Context, originalURL string, opts CreateOptions) (string, error) {
+	code, err := s.createLink(ctx, originalURL, opts)
+	if err != nil {
+		return "", err
+	}
+	return fullShortURL(code), nil
+}
+
+func (s *SQLiteStore) CreateOrReuseShortURL(ctx context.Context, originalURL string, opts CreateOptions) (string, bool, error) {
+	return createOrReuse(ctx, s, originalURL, opts)
+}
+
+// createLink stores a new link and returns its code
+func (s *SQLiteStore) createLink(ctx context.Context, originalURL string, opts CreateOptions) (string, error) {
+	urlData, err := newURLData(originalURL, opts, s.timeProvider.Now())
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Tags and metadata are stored as JSON; marshalling string slices and maps cannot fail
+	tags, metadata := "[]", "{}"
+	if len(urlData.Tags) > 0 {
+		encoded, _ := json.Marshal(urlData.Tags)
+		tags = string(encoded)
+	}
+	if len(urlData.Metadata) > 0 {
+		encoded, _ := json.Marshal(urlData.Metadata)
+		metadata = string(encoded)
+	}
+
+	claim := func(ctx context.Context, code string) (bool, error) {
+		res, err := tx.ExecContext(ctx, `INSERT INTO links (code, original_url, created_at, click_count, expires_at, max_clicks, password_hash, manage_token_hash, status,
+				title, description, tags, metadata)
+			VALUES (?, ?, ?, 0, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (code) DO NOTHING`,
+			code, urlData.OriginalURL, urlData.CreatedAt.UnixNano(), nullableTime(urlData.ExpiresAt), urlData.MaxClicks,
+			urlData.PasswordHash, urlData.ManageTokenHash, urlData.Status,
+			urlData.Title, urlData.Description, tags, metadata)
+		if err != nil {
+			return false, err
+		}
+		inserted, err := res.RowsAffected()
+		return inserted == 1, err
+	}
+
+	shortURL := opts.Alias
+	if shortURL != "" {
+		claimed, err := claim(ctx, shortURL)
+		if err != nil {
+			return "", fmt.Errorf("failed to store URL: %w", err)
+		}
+		if !claimed {
+			return "", ErrAliasTaken
+		}
+	} else {
+		// Get the next ID, mirroring Redis INCR on url_counter
+		shortURL, err = allocateCode(ctx,
+			func(ctx context.Context) (int64, error) {
+				var id int64
+				err := tx.QueryRowContext(ctx, `INSERT INTO counters (name, value) VALUES ('url_counter', 1)
+					ON CONFLICT (name) DO UPDATE SET value = value + 1
+					RETURNING value`).Scan(&id)
+				return id, err
+			},
+			claim,
+		)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := insertHistory(ctx, tx, shortURL, urlData.OriginalURL, urlData.CreatedAt, ActorCreator); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit URL: %w", err)
+	}
+
+	return shortURL, nil
+}
+
+func (s *SQLiteStore) lookupDedupe(ctx context.Context, key string) (string, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	var code string
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(code, claim) FROM link_dedupe WHERE key = ?`, key).Scan(&code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up existing link: %w", err)
+	}
+	return code, nil
+}
+
+func (s *SQLiteStore) swapDedupe(ctx context.Context, key, old, next string) (bool, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	// Claims are kept apart from codes, which must name an existing link
+	var code, claim any = next, nil
+	if _, ok := parseDedupeClaim(next); ok {
+		code, claim = nil, next
+	}
+
+	var result sql.Result
+	var err error
+	switch {
+	case old == "":
+		result, err = s.db.ExecContext(ctx, `INSERT INTO link_dedupe (key, code, claim) VALUES (?, ?, ?)
+			ON CONFLICT (key) DO NOTHING`, key, code, claim)
+	case next == "":
+		result, err = s.db.ExecContext(ctx, `DELETE FROM link_dedupe WHERE key = ? AND COALESCE(code, claim) = ?`, key, old)
+	default:
+		result, err = s.db.ExecContext(ctx, `UPDATE link_dedupe SET code = ?, claim = ? WHERE key = ? AND COALESCE(code, claim) = ?`,
+			code, claim, key, old)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record link for reuse: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record link for reuse: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (s *SQLiteStore) GetPolicyDocument(ctx context.Context) (string, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	var document string
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM settings WHERE name = 'policy_document'`).Scan(&document)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get policy document: %w", err)
+	}
+	return document, nil
+}
+
+func (s *SQLiteStore) SavePolicyDocument(ctx context.Context, document string) error {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO settings (name, value) VALUES ('policy_document', ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`, document)
+	if err != nil {
+		return fmt.Errorf("failed to save policy document: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
+	return s.FollowLink(ctx, shortURL, ClickEvent{})
+}
+
+func (s *SQLiteStore) FollowLink(ctx context.Context, shortURL string, click ClickEvent) (string, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	urlData, err := scanURLData(tx.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM links WHERE code = ?`, shortURL))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get URL: %w", err)
+	}
+
+	now := s.timeProvider.Now()
+	if err := urlData.statusError(); err != nil {
+		return "", err
+	}
+	if urlData.isExpired(now) {
+		return "", ErrLinkExpired
+	}
+	if urlData.clickLimitReached() {
+		return "", ErrClickLimitReached
+	}
+
+	// The transaction holds the only connection, so the check above and this increment are atomic
+	_, err = tx.ExecContext(ctx, `UPDATE links SET click_count = click_count + 1 WHERE code = ?`, shortURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to update click count: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO clicks (code, clicked_at, referrer, user_agent, accept_language, ip)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		shortURL, now.UnixNano(), click.Referrer, click.UserAgent, click.AcceptLanguage, click.IP)
+	if err != nil {
+		return "", fmt.Errorf("failed to record click: %w", err)
+	}
+
+	if click.Visitor != "" {
+		_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO link_visitors (code, day, visitor) VALUES (?, ?, ?)`,
+			shortURL, visitorDay(now).UnixNano(), click.Visitor)
+		if err != nil {
+			return "", fmt.Errorf("failed to record visitor: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit click: %w", err)
+	}
+
+	return urlData.OriginalURL, nil
+}
+
+func (s *SQLiteStore) ListClickEvents(ctx context.Context, shortURL string, from, to time.Time) ([]ClickEvent, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT clicked_at, referrer, user_agent, accept_language, ip FROM clicks WHERE code = ?`
+	args := []any{shortURL}
+	if !from.IsZero() {
+		query += ` AND clicked_at >= ?`
+		args = append(args, from.UnixNano())
+	}
+	if !to.IsZero() {
+		query += ` AND clicked_at < ?`
+		args = append(args, to.UnixNano())
+	}
+	query += ` ORDER BY clicked_at, id`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list click events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []ClickEvent
+	for rows.Next() {
+		event := ClickEvent{Code: shortURL}
+		var clickedAt int64
+		if err := rows.Scan(&clickedAt, &event.Referrer, &event.UserAgent, &event.AcceptLanguage, &event.IP); err != nil {
+			return nil, fmt.Errorf("failed to list click events: %w", err)
+		}
+		event.Timestamp = time.Unix(0, clickedAt)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list click events: %w", err)
+	}
+	return events, nil
+}
+
+func (s *SQLiteStore) CountClicks(ctx context.Context, shortURL string, from, to time.Time, size time.Duration) ([]ClickCount, error) {
+	buckets, err := clickBuckets(from, to, size)
+	if err != nil || len(buckets) == 0 {
+		return buckets, err
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	start := buckets[0].Start.UnixNano()
+	rows, err := s.db.QueryContext(ctx, `SELECT (clicked_at - ?) / ?, COUNT(*) FROM clicks
+		WHERE code = ? AND clicked_at >= ? AND clicked_at < ? GROUP BY 1`,
+		start, size.Nanoseconds(), shortURL, start, to.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count clicks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i, clicks int64
+		if err := rows.Scan(&i, &clicks); err != nil {
+			return nil, fmt.Errorf("failed to count clicks: %w", err)
+		}
+		buckets[i].Clicks = clicks
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count clicks: %w", err)
+	}
+	return buckets, nil
+}
+
+func (s *SQLiteStore) PurgeClickEvents(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM clicks WHERE clicked_at < ?`, before.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge click events: %w", err)
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge click events: %w", err)
+	}
+
+	// A visitor day is keyed by its start, so it has ended by before once it starts a day earlier
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM link_visitors WHERE day <= ?`, before.Add(-24*time.Hour).UnixNano()); err != nil {
+		return purged, fmt.Errorf("failed to purge visitors: %w", err)
+	}
+	return purged, nil
+}
+
+func (s *SQLiteStore) GetUniqueVisitors(ctx context.Context, shortURL string, from, to time.Time) (UniqueVisitors, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	where := `code = ?`
+	args := []any{shortURL}
+	if from = visitorDaysFrom(from); !from.IsZero() {
+		where += ` AND day >= ?`
+		args = append(args, from.UnixNano())
+	}
+	if !to.IsZero() {
+		where += ` AND day < ?`
+		args = append(args, to.UnixNano())
+	}
+
+	var visitors UniqueVisitors
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(DISTINCT visitor) FROM link_visitors WHERE `+where, args...).Scan(&visitors.Total)
+	if err != nil {
+		return UniqueVisitors{}, fmt.Errorf("failed to count visitors: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT day, COUNT(*) FROM link_visitors WHERE `+where+` GROUP BY day ORDER BY day`, args...)
+	if err != nil {
+		return UniqueVisitors{}, fmt.Errorf("failed to count visitors: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day, count int64
+		if err := rows.Scan(&day, &count); err != nil {
+			return UniqueVisitors{}, fmt.Errorf("failed to count visitors: %w", err)
+		}
+		visitors.Days = append(visitors.Days, DailyVisitors{Day: time.Unix(0, day).UTC(), Visitors: count})
+	}
+	if err := rows.Err(); err != nil {
+		return UniqueVisitors{}, fmt.Errorf("failed to count visitors: %w", err)
+	}
+	return visitors, nil
+}
+
+func (s *SQLiteStore) GetClickCount(ctx context.Context, shortURL string) (int64, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	var clickCount int64
+	err := s.db.QueryRowContext(ctx, `SELECT click_count FROM links WHERE code = ?`, shortURL).Scan(&clickCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get URL: %w", err)
+	}
+
+	return clickCount, nil
+}
+
+// linkColumns lists the links columns read by scanURLData, in order
+const linkColumns = `original_url, created_at, click_count, expires_at, max_clicks, password_hash, manage_token_hash, status, deleted_at,
+	title, description, tags, metadata`
+
+// scanURLData reads a links row selected with linkColumns, after any leading columns read into prefix
+func scanURLData(row interface{ Scan(dest ...any) error }, prefix ...any) (URLData, error) {
+	var (
+		urlData   URLData
+		createdAt int64
+		expiresAt sql.NullInt64
+		deletedAt sql.NullInt64
+		tags      string
+		metadata  string
+	)
+	err := row.Scan(append(prefix, &urlData.OriginalURL, &createdAt, &urlData.ClickCount, &expiresAt, &urlData.MaxClicks,
+		&urlData.PasswordHash, &urlData.ManageTokenHash, &urlData.Status, &deletedAt,
+		&urlData.Title, &urlData.Description, &tags, &metadata)...)
+	if err != nil {
+		return URLData{}, err
+	}
+	if err := json.Unmarshal([]byte(tags), &urlData.Tags); err != nil {
+		return URLData{}, fmt.Errorf("invalid tags %q: %w", tags, err)
+	}
+	if err := json.Unmarshal([]byte(metadata), &urlData.Metadata); err != nil {
+		return URLData{}, fmt.Errorf("invalid metadata %q: %w", metadata, err)
+	}
+	if len(urlData.Tags) == 0 {
+		urlData.Tags = nil
+	}
+	if len(urlData.Metadata) == 0 {
+		urlData.Metadata = nil
+	}
+
+	urlData.CreatedAt = time.Unix(0, createdAt)
+	if expiresAt.Valid {
+		urlData.ExpiresAt = time.Unix(0, expiresAt.Int64)
+	}
+	if deletedAt.Valid {
+		urlData.DeletedAt = time.Unix(0, deletedAt.Int64)
+	}
+
+	return urlData, nil
+}
+
+func (s *SQLiteStore) GetURLData(ctx context.Context, shortURL string) (*URLData, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	urlData, err := scanURLData(s.db.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM links WHERE code = ?`, shortURL))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get URL: %w", err)
+	}
+
+	return &urlData, nil
+}
+
+func (s *SQLiteStore) UpdateLink(ctx context.Context, shortURL string, update LinkUpdate) error {
+	if err := validateLinkUpdate(update); err != nil {
+		return err
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	// A NULL argument keeps the current destination
+	var originalURL any
+	if update.OriginalURL != nil {
+		originalURL = *update.OriginalURL
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `UPDATE links SET original_url = COALESCE(?, original_url) WHERE code = ?`,
+		originalURL, shortURL)
+	if err != nil {
+		return fmt.Errorf("failed to update URL: %w", err)
+	}
+	if updated, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update URL: %w", err)
+	} else if updated == 0 {
+		return ErrLinkNotFound
+	}
+
+	if update.OriginalURL != nil {
+		if err := insertHistory(ctx, tx, shortURL, *update.OriginalURL, s.timeProvider.Now(), update.Actor); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit URL update: %w", err)
+	}
+
+	return nil
+}
+
+// insertHistory records that shortURL started pointing at originalURL
+func insertHistory(ctx context.Context, tx *sql.Tx, shortURL, originalURL string, changedAt time.Time, actor string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO link_history (code, original_url, changed_at, actor) VALUES (?, ?, ?, ?)`,
+		shortURL, originalURL, changedAt.UnixNano(), actor)
+	if err != nil {
+		return fmt.Errorf("failed to record destination history: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListLinks(ctx context.Context, opts ListOptions) (LinkPage, error) {
+	cursor, hasCursor, err := decodeCursor(opts.Cursor)
+	if err != nil {
+		return LinkPage{}, err
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	// Everything but the host filter is pushed into SQL
+	var (
+		conditions []string
+		args       []any
+	)
+	if !opts.CreatedAfter.IsZero() {
+		conditions = append(conditions, `created_at >= ?`)
+		args = append(args, opts.CreatedAfter.UnixNano())
+	}
+	if !opts.CreatedBefore.IsZero() {
+		conditions = append(conditions, `created_at <= ?`)
+		args = append(args, opts.CreatedBefore.UnixNano())
+	}
+	if opts.MinClicks != nil {
+		conditions = append(conditions, `click_count >= ?`)
+		args = append(args, *opts.MinClicks)
+	}
+	if opts.MaxClicks != nil {
+		conditions = append(conditions, `click_count <= ?`)
+		args = append(args, *opts.MaxClicks)
+	}
+	if opts.Status != "" {
+		conditions = append(conditions, `status = ?`)
+		args = append(args, opts.Status)
+	}
+	if opts.Tag != "" {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM json_each(links.tags) WHERE value = ?)`)
+		args = append(args, NormalizeTag(opts.Tag))
+	}
+
+	limit := opts.limit()
+	batchSize := limit + 1
+	var records []LinkRecord
+
+	// Read batches until a page and one more match are found, so we know whether there is a next page
+	for len(records) <= limit {
+		where := append([]string{}, conditions...)
+		whereArgs := append([]any{}, args...)
+		if hasCursor {
+			where = append(where, `(created_at < ? OR (created_at = ? AND code < ?))`)
+			whereArgs = append(whereArgs, cursor.createdAt, cursor.createdAt, cursor.code)
+		}
+		query := `SELECT code, ` + linkColumns + ` FROM links`
+		if len(where) > 0 {
+			query += ` WHERE ` + strings.Join(where, ` AND `)
+		}
+		query += ` ORDER BY created_at DESC, code DESC LIMIT ?`
+
+		batch, err := s.queryLinkRecords(ctx, query, append(whereArgs, batchSize)...)
+		if err != nil {
+			return LinkPage{}, err
+		}
+		for _, rec := range batch {
+			if opts.matches(rec.URLData) {
+				records = append(records, rec)
+			}
+		}
+		if len(batch) < batchSize {
+			break
+		}
+		cursor = listCursor{createdAt: batch[len(batch)-1].CreatedAt.UnixNano(), code: batch[len(batch)-1].Code}
+		hasCursor = true
+	}
+
+	return newLinkPage(records, limit), nil
+}
+
+// queryLinkRecords runs a query selecting code followed by linkColumns
+func (s *SQLiteStore) queryLinkRecords(ctx context.Context, query string, args ...any) ([]LinkRecord, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var records []LinkRecord
+	for rows.Next() {
+		var rec LinkRecord
+		rec.URLData, err = scanURLData(rows, &rec.Code)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read link: %w", err)
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+
+	return records, nil
+}
+
+func (s *SQLiteStore) SearchLinks(ctx context.Context, opts SearchOptions) ([]LinkRecord, error) {
+	query := searchTokens(opts.Query)
+	if len(query) == 0 {
+		return nil, nil
+	}
+
+	// Tokens hold only letters and digits, so they can be quoted as FTS5 prefix queries as they are
+	phrases := make([]string, len(query))
+	for i, token := range query {
+		phrases[i] = `"` + token + `"*`
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	return s.queryLinkRecords(ctx, `SELECT code, `+linkColumns+` FROM links
+		WHERE rowid IN (SELECT rowid FROM links_search WHERE links_search MATCH ?)
+		ORDER BY created_at DESC, code DESC LIMIT ?`,
+		strings.Join(phrases, " "), opts.limit())
+}
+
+func (s *SQLiteStore) GetLinkHistory(ctx context.Context, shortURL string) ([]DestinationChange, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT original_url, changed_at, actor FROM link_history WHERE code = ? ORDER BY id`, shortURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var history []DestinationChange
+	for rows.Next() {
+		var (
+			change    DestinationChange
+			changedAt int64
+		)
+		if err := rows.Scan(&change.OriginalURL, &changedAt, &change.Actor); err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+		change.Version = len(history) + 1
+		change.ChangedAt = time.Unix(0, changedAt)
+		history = append(history, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	// History rows are removed with their link, so no rows means no link
+	return history, nil
+}
+
+func (s *SQLiteStore) SetLinkStatus(ctx context.Context, shortURL string, status LinkStatus) error {
+	if !status.Valid() {
+		return ErrInvalidStatus
+	}
+
+	var deletedAt any
+	if status == StatusDeleted {
+		deletedAt = s.timeProvider.Now().UnixNano()
+	}
+
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `UPDATE links SET status = ?, deleted_at = ? WHERE code = ?`, status, deletedAt, shortURL)
+	if err != nil {
+		return fmt.Errorf("failed to set link status: %w", err)
+	}
+	if updated, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to set link status: %w", err)
+	} else if updated == 0 {
+		return ErrLinkNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) RestoreLink(ctx context.Context, shortURL string, retention time.Duration) error {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	urlData, err := scanURLData(tx.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM links WHERE code = ?`, shortURL))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrLinkNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore link: %w", err)
+	}
+	if err := urlData.restoreError(s.timeProvider.Now(), retention); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE links SET status = ?, deleted_at = NULL WHERE code = ?`, StatusActive, shortURL); err != nil {
+		return fmt.Errorf("failed to restore link: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to restore link: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) PurgeDeletedLinks(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM links WHERE status = 'deleted' AND deleted_at <= ?`, deletedBefore.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted links: %w", err)
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted links: %w", err)
+	}
+
+	return purged, nil
+}
+
+func (s *SQLiteStore) DeleteLink(ctx context.Context, shortURL string) error {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	// Click and history rows go with the link through ON DELETE CASCADE
+	res, err := s.db.ExecContext(ctx, `DELETE FROM links WHERE code = ?`, shortURL)
+	if err != nil {
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+	if deleted, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete URL: %w", err)
+	} else if deleted == 0 {
+		return ErrLinkNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) AddReport(ctx context.Context, shortURL string, report Report) (int64, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// The reporter's earlier open report, if any, is kept as it is
+	_, err = tx.ExecContext(ctx, `INSERT INTO link_reports (code, reporter, reason, details, created_at)
+		SELECT code, ?, ?, ?, ? FROM links WHERE code = ?
+		ON CONFLICT (code, reporter) DO NOTHING`,
+		report.Reporter, report.Reason, report.Details, s.timeProvider.Now().UnixNano(), shortURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add report: %w", err)
+	}
+
+	var open int64
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM link_reports WHERE code = ?`, shortURL).Scan(&open)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count reports: %w", err)
+	}
+	if open == 0 {
+		return 0, ErrLinkNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return open, nil
+}
+
+func (s *SQLiteStore) ListReportedLinks(ctx context.Context, limit int) ([]ReportedLink, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT r.code, r.reporter, r.reason, r.details, r.created_at
+		FROM link_reports r
+		JOIN (SELECT code, MIN(created_at) AS first_at FROM link_reports
+			GROUP BY code ORDER BY first_at, code LIMIT ?) q ON q.code = r.code
+		ORDER BY q.first_at, r.code, r.created_at`, pageSize(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reported links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []ReportedLink
+	for rows.Next() {
+		var code string
+		var report Report
+		var createdAt int64
+		if err := rows.Scan(&code, &report.Reporter, &report.Reason, &report.Details, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan report: %w", err)
+		}
+		report.CreatedAt = time.Unix(0, createdAt)
+
+		if len(links) == 0 || links[len(links)-1].Code != code {
+			links = append(links, ReportedLink{Code: code})
+		}
+		links[len(links)-1].Reports = append(links[len(links)-1].Reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list reported links: %w", err)
+	}
+	return links, nil
+}
+
+func (s *SQLiteStore) ClearReports(ctx context.Context, shortURL string) (int64, error) {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM link_reports WHERE code = ?`, shortURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear reports: %w", err)
+	}
+	cleared, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear reports: %w", err)
+	}
+	return cleared, nil
+}
+
+// Ping checks if the database is reachable
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	ctx, cancel := withOpTimeout(ctx)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+// nullableTime stores the zero time as NULL and anything else as Unix nanoseconds
+func nullableTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// sqliteMigrations holds the schema history of the SQLite store.
+// Migration N (1-based) is sqliteMigrations[N-1]; append new entries and never edit applied ones.
+var sqliteMigrations = []string{
+	// 1: links, their click events and the code counter
+	`CREATE TABLE counters (
+		name  TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	);
+	CREATE TABLE links (
+		code         TEXT PRIMARY KEY,
+		original_url TEXT NOT NULL,
+		created_at   INTEGER NOT NULL,
+		click_count  INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE clicks (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		code       TEXT NOT NULL REFERENCES links(code) ON DELETE CASCADE,
+		clicked_at INTEGER NOT NULL
+	);
+	CREATE INDEX idx_clicks_code_clicked_at ON clicks(code, clicked_at);`,
+
+	// 2: optional link expiry, NULL meaning never
+	`ALTER TABLE links ADD COLUMN expires_at INTEGER;`,
+
+	// 3: optional click cap, 0 meaning unlimited
+	`ALTER TABLE links ADD COLUMN max_clicks INTEGER NOT NULL DEFAULT 0;`,
+
+	// 4: bcrypt hash of the link password, empty when the link is not protected
+	`ALTER TABLE links ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';`,
+
+	// 5: management token hash, empty for links that cannot be managed, and the disabled flag
+	`ALTER TABLE links ADD COLUMN manage_token_hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE links ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0;`,
+
+	// 6: destination history, seeded with the destination every existing link has now
+	`CREATE TABLE link_history (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		code         TEXT NOT NULL REFERENCES links(code) ON DELETE CASCADE,
+		original_url TEXT NOT NULL,
+		changed_at   INTEGER NOT NULL,
+		actor        TEXT NOT NULL
+	);
+	CREATE INDEX idx_link_history_code ON link_history(code, id);
+	INSERT INTO link_history (code, original_url, changed_at, actor)
+		SELECT code, original_url, created_at, 'creator' FROM links ORDER BY created_at;`,
+
+	// 7: the disabled flag becomes a status, with the soft-deletion time for the purger
+	`ALTER TABLE links ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+	ALTER TABLE links ADD COLUMN deleted_at INTEGER;
+	UPDATE links SET status = 'disabled' WHERE disabled = 1;
+	ALTER TABLE links DROP COLUMN disabled;
+	CREATE INDEX idx_links_deleted_at ON links(deleted_at) WHERE status = 'deleted';`,
+
+	// 8: newest-first listing
+	`CREATE INDEX idx_links_created_at ON links(created_at, code);`,
+
+	// 9: full-text search over codes and destinations, kept in step with links by triggers
+	`CREATE VIRTUAL TABLE links_search USING fts5(code, original_url);
+	INSERT INTO links_search (rowid, code, original_url) SELECT rowid, code, original_url FROM links;
+	CREATE TRIGGER links_search_insert AFTER INSERT ON links BEGIN
+		INSERT INTO links_search (rowid, code, original_url) VALUES (new.rowid, new.code, new.original_url);
+	END;
+	CREATE TRIGGER links_search_update AFTER UPDATE OF original_url ON links BEGIN
+		UPDATE links_search SET original_url = new.original_url WHERE rowid = old.rowid;
+	END;
+	CREATE TRIGGER links_search_delete AFTER DELETE ON links BEGIN
+		DELETE FROM links_search WHERE rowid = old.rowid;
+	END;`,
+
+	// 10: title, description, tags and metadata, the latter two as JSON; search covers titles and tags
+	`ALTER TABLE links ADD COLUMN title TEXT NOT NULL DEFAULT '';
+	ALTER TABLE links ADD COLUMN description TEXT NOT NULL DEFAULT '';
+	ALTER TABLE links ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+	ALTER TABLE links ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';
+	DROP TRIGGER links_search_insert;
+	DROP TRIGGER links_search_update;
+	DROP TRIGGER links_search_delete;
+	DROP TABLE links_search;
+	CREATE VIRTUAL TABLE links_search USING fts5(code, original_url, title, tags);
+	INSERT INTO links_search (rowid, code, original_url, title, tags) SELECT rowid, code, original_url, title, tags FROM links;
+	CREATE TRIGGER links_search_insert AFTER INSERT ON links BEGIN
+		INSERT INTO links_search (rowid, code, original_url, title, tags) VALUES (new.rowid, new.code, new.original_url, new.title, new.tags);
+	END;
+	CREATE TRIGGER links_search_update AFTER UPDATE OF original_url, title, tags ON links BEGIN
+		UPDATE links_search SET original_url = new.original_url, title = new.title, tags = new.tags WHERE rowid = old.rowid;
+	END;
+	CREATE TRIGGER links_search_delete AFTER DELETE ON links BEGIN
+		DELETE FROM links_search WHERE rowid = old.rowid;
+	END;`,
+
+	// 11: reverse index from hashed scope and normalized destination to the link created for it
+	`CREATE TABLE link_dedupe (
+		key  TEXT PRIMARY KEY,
+		code TEXT NOT NULL REFERENCES links(code) ON DELETE CASCADE
+	);
+	CREATE INDEX idx_link_dedupe_code ON link_dedupe(code);`,
+
+	// 12: instance-wide settings, such as the destination policy document
+	`CREATE TABLE settings (
+		name  TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`,
+
+	// 13: the moderation queue of open abuse reports, one per reporter and link
+	`CREATE TABLE link_reports (
+		code       TEXT NOT NULL REFERENCES links(code) ON DELETE CASCADE,
+		reporter   TEXT NOT NULL,
+		reason     TEXT NOT NULL,
+		details    TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (code, reporter)
+	);
+	CREATE INDEX idx_link_reports_created_at ON link_reports(created_at);`,
+
+	// 14: request details of click events, and an index for purging them by age
+	`ALTER TABLE clicks ADD COLUMN referrer TEXT NOT NULL DEFAULT '';
+	ALTER TABLE clicks ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+	ALTER TABLE clicks ADD COLUMN accept_language TEXT NOT NULL DEFAULT '';
+	ALTER TABLE clicks ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_clicks_clicked_at ON clicks(clicked_at);`,
+
+	// 15: the distinct visitors of each link per UTC day, keyed by the day's start in Unix nanoseconds
+	`CREATE TABLE link_visitors (
+		code    TEXT NOT NULL REFERENCES links(code) ON DELETE CASCADE,
+		day     INTEGER NOT NULL,
+		visitor TEXT NOT NULL,
+		PRIMARY KEY (code, day, visitor)
+	) WITHOUT ROWID;`,
+
+	// 16: let a request claim a dedupe entry before the link it creates exists
+	`CREATE TABLE link_dedupe_claims (
+		key   TEXT PRIMARY KEY,
+		code  TEXT REFERENCES links(code) ON DELETE CASCADE,
+		claim TEXT,
+		CHECK ((code IS NULL) <> (claim IS NULL))
+	);
+	INSERT INTO link_dedupe_claims (key, code) SELECT key, code FROM link_dedupe;
+	DROP TABLE link_dedupe;
+	ALTER TABLE link_dedupe_claims RENAME TO link_dedupe;
+	CREATE INDEX idx_link_dedupe_code ON link_dedupe(code);`,
+
+	// 17: an index for purging visitor days by age
+	`CREATE INDEX idx_link_visitors_day ON link_visitors(day);`,
+}
+
+// migrateSQLite applies every migration newer than the database's recorded schema version.
+// Each migration runs in its own transaction together with its version bump.
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if current > len(sqliteMigrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", current, len(sqliteMigrations))
+	}
+
+	for i := current; i < len(sqliteMigrations); i++ {
+		version := i + 1
+		if err := applySQLiteMigration(ctx, db, version, sqliteMigrations[i]); err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+func applySQLiteMigration(ctx context.Context, db *sql.DB, version int, stmt string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, applied_at) VALUES (?, strftime('%s', 'now'))`, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
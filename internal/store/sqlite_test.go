@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupTestSQLite creates a new SQLite store backed by a throwaway database file
+func setupTestSQLite(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open test SQLite store: %v", err)
+	}
+	store.timeProvider = &mockTimeProvider{now: time.Now()}
+
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Errorf("Failed to close test SQLite store: %v", err)
+		}
+	})
+
+	return store
+}
+
+func TestSQLiteMigrationsAreIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "migrate.db")
+
+	for i := 0; i < 2; i++ {
+		store, err := openSQLiteStore(path)
+		if err != nil {
+			t.Fatalf("openSQLiteStore() run %d error = %v", i+1, err)
+		}
+
+		var version, applied int
+		row := store.db.QueryRowContext(context.Background(), `SELECT MAX(version), COUNT(*) FROM schema_migrations`)
+		if err := row.Scan(&version, &applied); err != nil {
+			t.Fatalf("Failed to read schema_migrations: %v", err)
+		}
+		if version != len(sqliteMigrations) || applied != len(sqliteMigrations) {
+			t.Errorf("run %d: schema version = %d with %d rows, want %d", i+1, version, applied, len(sqliteMigrations))
+		}
+
+		if err := store.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+}
+
+// openLegacySQLite creates a database at path with only the first version migrations applied
+func openLegacySQLite(t *testing.T, path string, version int) *sql.DB {
+	t.Helper()
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at INTEGER NOT NULL)`); err != nil {
+		t.Fatalf("Failed to create schema_migrations: %v", err)
+	}
+	for i := 0; i < version; i++ {
+		if err := applySQLiteMigration(ctx, db, i+1, sqliteMigrations[i]); err != nil {
+			t.Fatalf("applySQLiteMigration(%d) error = %v", i+1, err)
+		}
+	}
+	return db
+}
+
+func TestSQLiteMigratesDisabledToStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.db")
+	ctx := context.Background()
+
+	db := openLegacySQLite(t, path, 6)
+	if _, err := db.ExecContext(ctx, `INSERT INTO links (code, original_url, created_at, disabled) VALUES
+		('off', 'https://example.com/off', 1, 1),
+		('on', 'https://example.com/on', 1, 0)`); err != nil {
+		t.Fatalf("Failed to seed links: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	store, err := openSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("openSQLiteStore() error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	for code, want := range map[string]LinkStatus{"off": StatusDisabled, "on": StatusActive} {
+		urlData, err := store.GetURLData(ctx, code)
+		if err != nil || urlData == nil {
+			t.Fatalf("GetURLData(%q) = %v, %v", code, urlData, err)
+		}
+		if urlData.Status != want {
+			t.Errorf("GetURLData(%q).Status = %q, want %q", code, urlData.Status, want)
+		}
+	}
+}
+
+func TestSQLiteBackfillsDestinationHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	ctx := context.Background()
+
+	// Build the schema as it was before histories existed, with one link in it
+	db := openLegacySQLite(t, path, 5)
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := db.ExecContext(ctx, `INSERT INTO links (code, original_url, created_at) VALUES ('legacy1', 'https://example.com/legacy', ?)`,
+		createdAt.UnixNano()); err != nil {
+		t.Fatalf("Failed to seed legacy link: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	store, err := openSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("openSQLiteStore() error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	history, err := store.GetLinkHistory(ctx, "legacy1")
+	if err != nil {
+		t.Fatalf("GetLinkHistory() error = %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("GetLinkHistory() returned %d entries, want 1: %+v", len(history), history)
+	}
+	if got := history[0]; got.OriginalURL != "https://example.com/legacy" || !got.ChangedAt.Equal(createdAt) || got.Actor != ActorCreator {
+		t.Errorf("history[0] = %+v, want the legacy destination at %v", got, createdAt)
+	}
+}
+
+func TestSQLiteBackfillsSearchIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "search.db")
+	ctx := context.Background()
+
+	// Build the schema as it was before search existed, with one link in it
+	db := openLegacySQLite(t, path, 8)
+	if _, err := db.ExecContext(ctx, `INSERT INTO links (code, original_url, created_at) VALUES ('legacy1', 'https://example.com/legacy-page', ?)`,
+		time.Now().UnixNano()); err != nil {
+		t.Fatalf("Failed to seed legacy link: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	store, err := openSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("openSQLiteStore() error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	records, err := store.SearchLinks(ctx, SearchOptions{Query: "legacy page"})
+	if err != nil {
+		t.Fatalf("SearchLinks() error = %v", err)
+	}
+	if len(records) != 1 || records[0].Code != "legacy1" {
+		t.Errorf("SearchLinks() = %+v, want the legacy link", records)
+	}
+}
+
+func TestSQLiteCreateAndResolve(t *testing.T) {
+	store := setupTestSQLite(t)
+
+	if _, err := store.CreateShortURL(context.Background(), "", CreateOptions{}); err == nil {
+		t.Error("CreateShortURL(\"\") expected error, got nil")
+	}
+
+	originalURL := "https://example.com"
+	shortURL, err := store.CreateShortURL(context.Background(), originalURL, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+	shortCode := shortURL[len(os.Getenv("SHORTENME_URL"))+1:]
+	if shortCode != "1" {
+		t.Errorf("CreateShortURL() code = %v, want 1", shortCode)
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := store.GetOriginalURL(context.Background(), shortCode)
+		if err != nil || got != originalURL {
+			t.Errorf("GetOriginalURL() = %q, %v, want %q, <nil>", got, err, originalURL)
+		}
+	}
+
+	if got, err := store.GetClickCount(context.Background(), shortCode); err != nil || got != 2 {
+		t.Errorf("GetClickCount() = %v, %v, want 2, <nil>", got, err)
+	}
+
+	var clicks int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM clicks WHERE code = ?`, shortCode).Scan(&clicks); err != nil {
+		t.Fatalf("Failed to count clicks: %v", err)
+	}
+	if clicks != 2 {
+		t.Errorf("clicks rows = %v, want 2", clicks)
+	}
+
+	if got, err := store.GetOriginalURL(context.Background(), "nonexistent"); err != nil || got != "" {
+		t.Errorf("GetOriginalURL(nonexistent) = %q, %v, want \"\", <nil>", got, err)
+	}
+	if got, err := store.GetClickCount(context.Background(), "nonexistent"); err != nil || got != -1 {
+		t.Errorf("GetClickCount(nonexistent) = %v, %v, want -1, <nil>", got, err)
+	}
+}
+
+func TestSQLitePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "persist.db")
+
+	store, err := openSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("openSQLiteStore() error = %v", err)
+	}
+	shortURL, err := store.CreateShortURL(context.Background(), "https://example.com", CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create test URL: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	store, err = openSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("openSQLiteStore() reopen error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	shortCode := shortURL[len(os.Getenv("SHORTENME_URL"))+1:]
+	if got, err := store.GetOriginalURL(context.Background(), shortCode); err != nil || got != "https://example.com" {
+		t.Errorf("GetOriginalURL() after reopen = %q, %v", got, err)
+	}
+}
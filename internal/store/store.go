@@ -1,8 +1,396 @@
 // Define the interface for the store that will be used by the API
 package store
 
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// opTimeout bounds every single store operation, on top of any deadline already on the caller's context
+const opTimeout = 3 * time.Second
+
+// TimeProvider defines an interface for getting the current time
+type TimeProvider interface {
+	Now() time.Time
+}
+
+// DefaultTimeProvider implements TimeProvider using the system clock
+type DefaultTimeProvider struct{}
+
+func (DefaultTimeProvider) Now() time.Time {
+	return time.Now()
+}
+
+type URLData struct {
+	OriginalURL string    `json:"original_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	ClickCount  int64     `json:"click_count"`
+	// ExpiresAt is when the link stops redirecting; the zero value means never
+	ExpiresAt time.Time `json:"expires_at"`
+	// MaxClicks is how many visits the link serves before it stops redirecting; zero means unlimited
+	MaxClicks int64 `json:"max_clicks"`
+	// PasswordHash is the bcrypt hash of the link password; empty means the link is not protected
+	PasswordHash string `json:"-"`
+	// ManageTokenHash is the SHA-256 hash of the token that lets the creator edit or delete the link
+	ManageTokenHash string `json:"-"`
+	// Status says whether the link redirects; an empty status is treated as active
+	Status LinkStatus `json:"status"`
+	// DeletedAt is when the link was soft-deleted; it is zero unless Status is StatusDeleted
+	DeletedAt time.Time `json:"deleted_at"`
+
+	// Title and Description are free text describing the link to people managing it
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Tags group links, e.g. by campaign or team; they are stored normalized by NormalizeTag
+	Tags []string `json:"tags,omitempty"`
+	// Metadata holds arbitrary key/value pairs supplied by the creator
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// LinkStatus is the lifecycle state of a link
+type LinkStatus string
+
+const (
+	// StatusActive links redirect normally
+	StatusActive LinkStatus = "active"
+	// StatusDisabled links are kept but do not redirect until enabled again
+	StatusDisabled LinkStatus = "disabled"
+	// StatusDeleted links do not redirect and are purged once their retention period has passed
+	StatusDeleted LinkStatus = "deleted"
+	// StatusSuspended links have been taken down by moderation and only the admin API can bring them back
+	StatusSuspended LinkStatus = "suspended"
+)
+
+// Valid reports whether s is one of the known statuses
+func (s LinkStatus) Valid() bool {
+	switch s {
+	case StatusActive, StatusDisabled, StatusDeleted, StatusSuspended:
+		return true
+	default:
+		return false
+	}
+}
+
+var (
+	// ErrLinkExpired is returned when resolving a link whose expiry has passed
+	ErrLinkExpired = errors.New("link has expired")
+	// ErrInvalidExpiry is returned when a link would already be expired at creation
+	ErrInvalidExpiry = errors.New("expiry must be in the future")
+	// ErrClickLimitReached is returned when resolving a link that has used up its allowed clicks
+	ErrClickLimitReached = errors.New("link has reached its click limit")
+	// ErrInvalidMaxClicks is returned when a click cap is negative
+	ErrInvalidMaxClicks = errors.New("max clicks must not be negative")
+	// ErrInvalidPassword is returned when a link password cannot be hashed
+	ErrInvalidPassword = errors.New("password must be at most 72 bytes")
+	// ErrLinkNotFound is returned when updating or deleting a code that does not exist
+	ErrLinkNotFound = errors.New("link not found")
+	// ErrLinkDisabled is returned when resolving a link its owner has disabled
+	ErrLinkDisabled = errors.New("link has been disabled")
+	// ErrLinkDeleted is returned when resolving a link that has been soft-deleted
+	ErrLinkDeleted = errors.New("link has been deleted")
+	// ErrLinkSuspended is returned when resolving a link moderation has suspended
+	ErrLinkSuspended = errors.New("link has been suspended pending review")
+	// ErrInvalidStatus is returned when setting a status that is not a known LinkStatus
+	ErrInvalidStatus = errors.New("invalid link status")
+	// ErrLinkNotDeleted is returned when restoring a link that has not been deleted
+	ErrLinkNotDeleted = errors.New("link is not deleted")
+	// ErrRestoreExpired is returned when restoring a link whose retention period has passed
+	ErrRestoreExpired = errors.New("link can no longer be restored")
+)
+
+// CreateOptions customise how a short URL is created
+type CreateOptions struct {
+	// Alias is a caller-chosen short code used instead of the next counter value
+	Alias string
+	// ExpiresIn makes the link expire this long after creation
+	ExpiresIn time.Duration
+	// ExpiresAt makes the link expire at an absolute time; it cannot be combined with ExpiresIn
+	ExpiresAt time.Time
+	// MaxClicks stops the link redirecting after this many visits; zero means unlimited
+	MaxClicks int64
+	// Password, if set, must be entered before the link redirects
+	Password string
+	// ManageToken, if set, is the secret that later authorises UpdateLink and DeleteLink calls
+	ManageToken string
+
+	// Title, Description, Tags and Metadata describe the link; see URLData
+	Title       string
+	Description string
+	Tags        []string
+	Metadata    map[string]string
+
+	// DedupeScope limits CreateOrReuseShortURL to links created in the same scope,
+	// such as an owner or API key; links created with an empty scope are shared
+	DedupeScope string
+}
+
+// LinkUpdate describes changes to an existing link; nil fields are left as they are
+type LinkUpdate struct {
+	OriginalURL *string
+	// Actor is recorded in the destination history when OriginalURL is set
+	Actor string
+}
+
+// ActorCreator is the actor recorded for the destination a link was created with
+const ActorCreator = "creator"
+
+// DestinationChange is one entry in a link's destination history
+type DestinationChange struct {
+	// Version numbers entries from 1, oldest first
+	Version     int       `json:"version,omitempty"`
+	OriginalURL string    `json:"original_url"`
+	ChangedAt   time.Time `json:"changed_at"`
+	Actor       string    `json:"actor"`
+}
+
+// DestinationAt returns the entry of history, oldest first, that was in effect at t
+func DestinationAt(history []DestinationChange, t time.Time) (DestinationChange, bool) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if !history[i].ChangedAt.After(t) {
+			return history[i], true
+		}
+	}
+	return DestinationChange{}, false
+}
+
 type Store interface {
-	CreateShortURL(originalURL string) (string, error)
-	GetOriginalURL(shortURL string) (string, error)
-	GetClickCount(shortURL string) (int64, error)
+	CreateShortURL(ctx context.Context, originalURL string, opts CreateOptions) (string, error)
+	// CreateOrReuseShortURL returns the short URL of an active link an earlier call created for the
+	// same normalized destination in opts.DedupeScope, or else creates one; created reports which.
+	// It returns ErrDedupeConflict if opts set an alias, expiry, click limit or password.
+	CreateOrReuseShortURL(ctx context.Context, originalURL string, opts CreateOptions) (shortURL string, created bool, err error)
+	// GetOriginalURL resolves a link like FollowLink, recording a click without any details
+	GetOriginalURL(ctx context.Context, shortURL string) (string, error)
+	// FollowLink returns a link's destination, or "" if the code is unknown, counting the click,
+	// appending click to the link's event log and counting click.Visitor, if set, among the day's
+	// unique visitors. The store fills in the event's Code and Timestamp.
+	FollowLink(ctx context.Context, shortURL string, click ClickEvent) (string, error)
+	// ListClickEvents returns the click events of a link in [from, to), oldest first; zero bounds are open
+	ListClickEvents(ctx context.Context, shortURL string, from, to time.Time) ([]ClickEvent, error)
+	// CountClicks counts a link's clicks in consecutive UTC-aligned buckets of size, a minute, an hour
+	// or a day, from the one holding from up to to; buckets without clicks are included with a zero
+	// count. Counts go with the click events they cover when those are purged, although Redis, which
+	// keeps them as clicks happen rather than reading the events, drops a bucket only once it has ended.
+	CountClicks(ctx context.Context, shortURL string, from, to time.Time, size time.Duration) ([]ClickCount, error)
+	// PurgeClickEvents deletes click events recorded before before, along with the unique visitors
+	// of every day that ended by then, and returns how many click events were removed
+	PurgeClickEvents(ctx context.Context, before time.Time) (int64, error)
+	// GetUniqueVisitors counts the distinct visitors of a link on each UTC day overlapping [from, to),
+	// and across those days; zero bounds are open
+	GetUniqueVisitors(ctx context.Context, shortURL string, from, to time.Time) (UniqueVisitors, error)
+	GetClickCount(ctx context.Context, shortURL string) (int64, error)
+	// GetURLData returns the stored record without counting a click, or nil if the code is unknown
+	GetURLData(ctx context.Context, shortURL string) (*URLData, error)
+	// UpdateLink applies update to an existing link, or returns ErrLinkNotFound.
+	// Setting OriginalURL appends an entry to the link's destination history.
+	UpdateLink(ctx context.Context, shortURL string, update LinkUpdate) error
+	// ListLinks returns a page of links matching opts, newest first
+	ListLinks(ctx context.Context, opts ListOptions) (LinkPage, error)
+	// SearchLinks returns the links matching every word of opts.Query, newest first
+	SearchLinks(ctx context.Context, opts SearchOptions) ([]LinkRecord, error)
+	// GetLinkHistory returns every destination the link has had, oldest first, or nil if the code is unknown
+	GetLinkHistory(ctx context.Context, shortURL string) ([]DestinationChange, error)
+	// SetLinkStatus moves a link to status, or returns ErrLinkNotFound.
+	// Moving to StatusDeleted records the deletion time; any other status clears it.
+	SetLinkStatus(ctx context.Context, shortURL string, status LinkStatus) error
+	// RestoreLink reactivates a link deleted less than retention ago by the store's clock, the same
+	// window PurgeDeletedLinks is given. It returns ErrLinkNotFound, ErrLinkNotDeleted or ErrRestoreExpired.
+	RestoreLink(ctx context.Context, shortURL string, retention time.Duration) error
+	// DeleteLink permanently removes a link and its history, or returns ErrLinkNotFound
+	DeleteLink(ctx context.Context, shortURL string) error
+	// PurgeDeletedLinks permanently removes links soft-deleted at or before deletedBefore
+	// and returns how many were removed
+	PurgeDeletedLinks(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// GetPolicyDocument returns the saved destination policy document, or "" if none has been saved
+	GetPolicyDocument(ctx context.Context) (string, error)
+	// SavePolicyDocument replaces the destination policy document
+	SavePolicyDocument(ctx context.Context, document string) error
+	// AddReport puts a report against a link in the moderation queue and returns how many open
+	// reports the link has, or ErrLinkNotFound. A reporter's further reports against the same
+	// link are ignored until its reports are cleared.
+	AddReport(ctx context.Context, shortURL string, report Report) (int64, error)
+	// ListReportedLinks returns up to limit links with open reports, those waiting longest first
+	ListReportedLinks(ctx context.Context, limit int) ([]ReportedLink, error)
+	// ClearReports takes a link out of the moderation queue and returns how many reports it had
+	ClearReports(ctx context.Context, shortURL string) (int64, error)
+}
+
+// Backend is a Store that also owns a connection which can be health-checked and released
+type Backend interface {
+	Store
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// New creates the Backend selected by name ("redis", "sqlite" or "memory")
+func New(backend string) (Backend, error) {
+	switch backend {
+	case "redis":
+		return NewRedisStore()
+	case "sqlite":
+		return NewSQLiteStore()
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", backend)
+	}
+}
+
+// withOpTimeout derives the context a single store operation runs under
+func withOpTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, opTimeout)
+}
+
+// newURLData validates opts and builds the record for a link created at now.
+// Relative expiry is resolved against now so every backend uses its own TimeProvider.
+func newURLData(originalURL string, opts CreateOptions, now time.Time) (URLData, error) {
+	if originalURL == "" {
+		return URLData{}, fmt.Errorf("original URL is required")
+	}
+	if opts.Alias != "" {
+		if err := ValidateAlias(opts.Alias); err != nil {
+			return URLData{}, err
+		}
+	}
+
+	if opts.MaxClicks < 0 {
+		return URLData{}, ErrInvalidMaxClicks
+	}
+
+	urlData := URLData{
+		OriginalURL: originalURL,
+		CreatedAt:   now,
+		ClickCount:  0,
+		MaxClicks:   opts.MaxClicks,
+		Status:      StatusActive,
+	}
+
+	switch {
+	case opts.ExpiresIn != 0 && !opts.ExpiresAt.IsZero():
+		return URLData{}, fmt.Errorf("%w: set either a duration or a timestamp, not both", ErrInvalidExpiry)
+	case opts.ExpiresIn != 0:
+		urlData.ExpiresAt = now.Add(opts.ExpiresIn)
+	case !opts.ExpiresAt.IsZero():
+		urlData.ExpiresAt = opts.ExpiresAt
+	}
+	if !urlData.ExpiresAt.IsZero() && !urlData.ExpiresAt.After(now) {
+		return URLData{}, ErrInvalidExpiry
+	}
+
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return URLData{}, ErrInvalidPassword
+		}
+		if err != nil {
+			return URLData{}, fmt.Errorf("failed to hash password: %w", err)
+		}
+		urlData.PasswordHash = string(hash)
+	}
+
+	if opts.ManageToken != "" {
+		urlData.ManageTokenHash = hashManageToken(opts.ManageToken)
+	}
+
+	tags, err := normalizeTags(opts.Tags)
+	if err != nil {
+		return URLData{}, err
+	}
+	if err := validateMetadata(opts.Title, opts.Description, opts.Metadata); err != nil {
+		return URLData{}, err
+	}
+	urlData.Title = opts.Title
+	urlData.Description = opts.Description
+	urlData.Tags = tags
+	if len(opts.Metadata) > 0 {
+		urlData.Metadata = maps.Clone(opts.Metadata)
+	}
+
+	return urlData, nil
+}
+
+// validateLinkUpdate rejects updates that would leave a link without a destination
+func validateLinkUpdate(update LinkUpdate) error {
+	if update.OriginalURL != nil && *update.OriginalURL == "" {
+		return fmt.Errorf("original URL is required")
+	}
+	return nil
+}
+
+// hashManageToken hashes a management token for storage. Tokens are long random
+// strings rather than user-chosen passwords, so a fast hash is enough.
+func hashManageToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// isExpired reports whether the link has an expiry that is not after now
+func (d URLData) isExpired(now time.Time) bool {
+	return !d.ExpiresAt.IsZero() && !d.ExpiresAt.After(now)
+}
+
+// statusError returns the error resolving a link in its status gives, or nil if it may redirect
+func (d URLData) statusError() error {
+	switch d.Status {
+	case StatusDisabled:
+		return ErrLinkDisabled
+	case StatusDeleted:
+		return ErrLinkDeleted
+	case StatusSuspended:
+		return ErrLinkSuspended
+	default:
+		return nil
+	}
+}
+
+// restoreError returns why the link cannot be restored at now, or nil if it can.
+// A link stops being restorable exactly when PurgeDeletedLinks starts removing it.
+func (d URLData) restoreError(now time.Time, retention time.Duration) error {
+	if d.Status != StatusDeleted {
+		return ErrLinkNotDeleted
+	}
+	if !now.Before(d.DeletedAt.Add(retention)) {
+		return ErrRestoreExpired
+	}
+	return nil
+}
+
+// IsActive reports whether the link's status lets it redirect
+func (d URLData) IsActive() bool {
+	return d.statusError() == nil
+}
+
+// clickLimitReached reports whether the link has served all the clicks it is allowed
+func (d URLData) clickLimitReached() bool {
+	return d.MaxClicks > 0 && d.ClickCount >= d.MaxClicks
+}
+
+// HasPassword reports whether the link must be unlocked before it redirects
+func (d URLData) HasPassword() bool {
+	return d.PasswordHash != ""
+}
+
+// CheckPassword reports whether password unlocks the link
+func (d URLData) CheckPassword(password string) bool {
+	if !d.HasPassword() {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(d.PasswordHash), []byte(password)) == nil
+}
+
+// CheckManageToken reports whether token authorises changes to the link.
+// Links created without a token can never be managed.
+func (d URLData) CheckManageToken(token string) bool {
+	if d.ManageTokenHash == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(d.ManageTokenHash), []byte(hashManageToken(token))) == 1
 }
@@ -0,0 +1,1821 @@
+// Package storetest provides a conformance suite that every store.Store implementation
+// is run against, so new backends are held to the same contract as RedisStore.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yingtu35/ShortenMe/internal/store"
+)
+
+// Factory returns a new, empty store for a single test that reads the current time from clock.
+// Any cleanup should be registered on t.
+type Factory func(t *testing.T, clock store.TimeProvider) store.Store
+
+// Clock is a store.TimeProvider whose time only moves when the test advances it
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a Clock stopped at now
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Run executes the full conformance suite against stores created by newStore
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store, clock *Clock)
+	}{
+		{"CreateShortURL", withoutClock(testCreateShortURL)},
+		{"CreateShortURLRequiresURL", withoutClock(testCreateShortURLRequiresURL)},
+		{"GetOriginalURL", withoutClock(testGetOriginalURL)},
+		{"GetOriginalURLNotFound", withoutClock(testGetOriginalURLNotFound)},
+		{"InternalKeysAreNotLinks", withoutClock(testInternalKeysAreNotLinks)},
+		{"ClickCounting", withoutClock(testClickCounting)},
+		{"GetClickCountNotFound", withoutClock(testGetClickCountNotFound)},
+		{"ConcurrentClicks", withoutClock(testConcurrentClicks)},
+		{"UniqueCodes", withoutClock(testUniqueCodes)},
+		{"Alias", withoutClock(testAlias)},
+		{"AliasTaken", withoutClock(testAliasTaken)},
+		{"InvalidAlias", withoutClock(testInvalidAlias)},
+		{"ConcurrentAliasClaims", withoutClock(testConcurrentAliasClaims)},
+		{"ExpiresIn", testExpiresIn},
+		{"ExpiresAt", testExpiresAt},
+		{"InvalidExpiry", testInvalidExpiry},
+		{"MaxClicks", withoutClock(testMaxClicks)},
+		{"OneTimeLinkUnderContention", withoutClock(testOneTimeLinkUnderContention)},
+		{"InvalidMaxClicks", withoutClock(testInvalidMaxClicks)},
+		{"GetURLData", testGetURLData},
+		{"GetURLDataNotFound", withoutClock(testGetURLDataNotFound)},
+		{"Password", withoutClock(testPassword)},
+		{"InvalidPassword", withoutClock(testInvalidPassword)},
+		{"ManageToken", withoutClock(testManageToken)},
+		{"UpdateDestination", withoutClock(testUpdateDestination)},
+		{"DisableLink", withoutClock(testDisableLink)},
+		{"SoftDeleteAndRestore", testSoftDeleteAndRestore},
+		{"SetLinkStatusErrors", withoutClock(testSetLinkStatusErrors)},
+		{"PurgeDeletedLinks", testPurgeDeletedLinks},
+		{"RestoreLink", testRestoreLink},
+		{"UpdateLinkNotFound", withoutClock(testUpdateLinkNotFound)},
+		{"DeleteLink", withoutClock(testDeleteLink)},
+		{"DeleteLinkNotFound", withoutClock(testDeleteLinkNotFound)},
+		{"ListLinksPagination", testListLinksPagination},
+		{"ListLinksSameCreationTime", withoutClock(testListLinksSameCreationTime)},
+		{"ListLinksFilters", testListLinksFilters},
+		{"ListLinksInvalidCursor", withoutClock(testListLinksInvalidCursor)},
+		{"CreateOrReuse", withoutClock(testCreateOrReuse)},
+		{"ConcurrentCreateOrReuse", withoutClock(testConcurrentCreateOrReuse)},
+		{"CreateOrReuseSkipsChangedLinks", withoutClock(testCreateOrReuseSkipsChangedLinks)},
+		{"CreateOrReuseConflicts", withoutClock(testCreateOrReuseConflicts)},
+		{"LinkMetadata", withoutClock(testLinkMetadata)},
+		{"InvalidMetadata", withoutClock(testInvalidMetadata)},
+		{"ListLinksByTag", testListLinksByTag},
+		{"SearchLinks", testSearchLinks},
+		{"SearchTitlesAndTags", withoutClock(testSearchTitlesAndTags)},
+		{"SearchFollowsUpdatesAndDeletes", withoutClock(testSearchFollowsUpdatesAndDeletes)},
+		{"SearchKeepsTitleAndTagsAfterUpdate", withoutClock(testSearchKeepsTitleAndTagsAfterUpdate)},
+		{"DestinationHistory", testDestinationHistory},
+		{"LinkHistoryNotFound", withoutClock(testLinkHistoryNotFound)},
+		{"PolicyDocument", withoutClock(testPolicyDocument)},
+		{"SuspendLink", withoutClock(testSuspendLink)},
+		{"Reports", testReports},
+		{"ClickEvents", testClickEvents},
+		{"PurgeClickEvents", testPurgeClickEvents},
+		{"CountClicks", testCountClicks},
+		{"UniqueVisitors", testUniqueVisitors},
+		{"PurgeVisitorDays", testPurgeVisitorDays},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewClock(time.Now())
+			tt.fn(t, newStore(t, clock), clock)
+		})
+	}
+}
+
+// withoutClock adapts a test that does not depend on time
+func withoutClock(fn func(t *testing.T, s store.Store)) func(t *testing.T, s store.Store, clock *Clock) {
+	return func(t *testing.T, s store.Store, _ *Clock) {
+		fn(t, s)
+	}
+}
+
+// shortCode strips the SHORTENME_URL prefix from a full short URL
+func shortCode(t *testing.T, shortURL string) string {
+	t.Helper()
+
+	prefix := os.Getenv("SHORTENME_URL") + "/"
+	if !strings.HasPrefix(shortURL, prefix) {
+		t.Fatalf("short URL %q does not start with %q", shortURL, prefix)
+	}
+	code := strings.TrimPrefix(shortURL, prefix)
+	if code == "" {
+		t.Fatalf("short URL %q has an empty code", shortURL)
+	}
+	return code
+}
+
+// mustCreate creates a short URL for originalURL and returns its code
+func mustCreate(t *testing.T, s store.Store, originalURL string) string {
+	t.Helper()
+
+	shortURL, err := s.CreateShortURL(context.Background(), originalURL, store.CreateOptions{})
+	if err != nil {
+		t.Fatalf("CreateShortURL(%q) error = %v", originalURL, err)
+	}
+	return shortCode(t, shortURL)
+}
+
+func testCreateShortURL(t *testing.T, s store.Store) {
+	code := mustCreate(t, s, "https://example.com")
+
+	for _, c := range code {
+		if !strings.ContainsRune("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ", c) {
+			t.Errorf("code %q contains non-base62 character %q", code, c)
+		}
+	}
+
+	if got, err := s.GetClickCount(context.Background(), code); err != nil || got != 0 {
+		t.Errorf("GetClickCount() on new link = %v, %v, want 0, <nil>", got, err)
+	}
+}
+
+func testCreateShortURLRequiresURL(t *testing.T, s store.Store) {
+	if got, err := s.CreateShortURL(context.Background(), "", store.CreateOptions{}); err == nil {
+		t.Errorf("CreateShortURL(\"\") = %q, want error", got)
+	}
+}
+
+func testGetOriginalURL(t *testing.T, s store.Store) {
+	first := mustCreate(t, s, "https://example.com/first")
+	second := mustCreate(t, s, "https://example.com/second")
+
+	if got, err := s.GetOriginalURL(context.Background(), first); err != nil || got != "https://example.com/first" {
+		t.Errorf("GetOriginalURL(%q) = %q, %v, want https://example.com/first", first, got, err)
+	}
+	if got, err := s.GetOriginalURL(context.Background(), second); err != nil || got != "https://example.com/second" {
+		t.Errorf("GetOriginalURL(%q) = %q, %v, want https://example.com/second", second, got, err)
+	}
+}
+
+func testGetOriginalURLNotFound(t *testing.T, s store.Store) {
+	if got, err := s.GetOriginalURL(context.Background(), "nonexistent"); err != nil || got != "" {
+		t.Errorf("GetOriginalURL(nonexistent) = %q, %v, want \"\", <nil>", got, err)
+	}
+}
+
+func testInternalKeysAreNotLinks(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	code := mustCreate(t, s, "https://example.com")
+	if _, err := s.GetOriginalURL(ctx, code); err != nil {
+		t.Fatalf("GetOriginalURL() error = %v", err)
+	}
+	mustCreateOrReuse(t, s, "https://example.com/reused", "")
+
+	// Names of keys a backend keeps next to its links must not resolve, count clicks or change
+	for _, key := range []string{"clickcounts:" + code, "clicks:" + code, "history:" + code, "links:dedupe", "links:created", "url_counter"} {
+		if got, err := s.GetOriginalURL(ctx, key); err != nil || got != "" {
+			t.Errorf("GetOriginalURL(%q) = %q, %v; want not found", key, got, err)
+		}
+		if got, err := s.GetURLData(ctx, key); err != nil || got != nil {
+			t.Errorf("GetURLData(%q) = %v, %v; want nil", key, got, err)
+		}
+		if count, err := s.GetClickCount(ctx, key); err != nil || count != -1 {
+			t.Errorf("GetClickCount(%q) = %d, %v; want -1", key, count, err)
+		}
+		if err := s.SetLinkStatus(ctx, key, store.StatusDisabled); !errors.Is(err, store.ErrLinkNotFound) {
+			t.Errorf("SetLinkStatus(%q) error = %v, want ErrLinkNotFound", key, err)
+		}
+		if _, err := s.AddReport(ctx, key, store.Report{Reason: "phishing", Reporter: "r"}); !errors.Is(err, store.ErrLinkNotFound) {
+			t.Errorf("AddReport(%q) error = %v, want ErrLinkNotFound", key, err)
+		}
+		if err := s.DeleteLink(ctx, key); !errors.Is(err, store.ErrLinkNotFound) {
+			t.Errorf("DeleteLink(%q) error = %v, want ErrLinkNotFound", key, err)
+		}
+	}
+
+	if count, err := s.GetClickCount(ctx, code); err != nil || count != 1 {
+		t.Errorf("GetClickCount(%s) = %d, %v; want 1", code, count, err)
+	}
+}
+
+func testClickCounting(t *testing.T, s store.Store) {
+	clicked := mustCreate(t, s, "https://example.com/clicked")
+	untouched := mustCreate(t, s, "https://example.com/untouched")
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.GetOriginalURL(context.Background(), clicked); err != nil {
+			t.Fatalf("GetOriginalURL() error = %v", err)
+		}
+	}
+
+	if got, err := s.GetClickCount(context.Background(), clicked); err != nil || got != 3 {
+		t.Errorf("GetClickCount(clicked) = %v, %v, want 3, <nil>", got, err)
+	}
+	if got, err := s.GetClickCount(context.Background(), untouched); err != nil || got != 0 {
+		t.Errorf("GetClickCount(untouched) = %v, %v, want 0, <nil>", got, err)
+	}
+
+	// Reading the count must not count as a click
+	if got, err := s.GetClickCount(context.Background(), clicked); err != nil || got != 3 {
+		t.Errorf("GetClickCount(clicked) second read = %v, %v, want 3, <nil>", got, err)
+	}
+}
+
+func testGetClickCountNotFound(t *testing.T, s store.Store) {
+	if got, err := s.GetClickCount(context.Background(), "nonexistent"); err != nil || got != -1 {
+		t.Errorf("GetClickCount(nonexistent) = %v, %v, want -1, <nil>", got, err)
+	}
+}
+
+func testConcurrentClicks(t *testing.T, s store.Store) {
+	code := mustCreate(t, s, "https://example.com")
+
+	const clicks = 50
+	var wg sync.WaitGroup
+	for i := 0; i < clicks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetOriginalURL(context.Background(), code); err != nil {
+				t.Errorf("GetOriginalURL() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, err := s.GetClickCount(context.Background(), code); err != nil || got != clicks {
+		t.Errorf("GetClickCount() after %d concurrent clicks = %v, %v", clicks, got, err)
+	}
+}
+
+func testUniqueCodes(t *testing.T, s store.Store) {
+	const links = 50
+	codes := make(chan string, links)
+
+	var wg sync.WaitGroup
+	for i := 0; i < links; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shortURL, err := s.CreateShortURL(context.Background(), "https://example.com", store.CreateOptions{})
+			if err != nil {
+				t.Errorf("CreateShortURL() error = %v", err)
+				return
+			}
+			codes <- shortURL
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	seen := make(map[string]bool, links)
+	for shortURL := range codes {
+		code := shortCode(t, shortURL)
+		if seen[code] {
+			t.Errorf("code %q was handed out twice", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) != links {
+		t.Errorf("got %d unique codes, want %d", len(seen), links)
+	}
+}
+
+func testAlias(t *testing.T, s store.Store) {
+	shortURL, err := s.CreateShortURL(context.Background(), "https://example.com/offsite", store.CreateOptions{Alias: "team-offsite"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() with alias error = %v", err)
+	}
+	if code := shortCode(t, shortURL); code != "team-offsite" {
+		t.Errorf("CreateShortURL() code = %q, want team-offsite", code)
+	}
+
+	if got, err := s.GetOriginalURL(context.Background(), "team-offsite"); err != nil || got != "https://example.com/offsite" {
+		t.Errorf("GetOriginalURL(team-offsite) = %q, %v, want https://example.com/offsite", got, err)
+	}
+	if got, err := s.GetClickCount(context.Background(), "team-offsite"); err != nil || got != 1 {
+		t.Errorf("GetClickCount(team-offsite) = %v, %v, want 1", got, err)
+	}
+
+	// Generated codes keep working alongside aliases
+	mustCreate(t, s, "https://example.com/generated")
+}
+
+func testAliasTaken(t *testing.T, s store.Store) {
+	opts := store.CreateOptions{Alias: "launch"}
+	if _, err := s.CreateShortURL(context.Background(), "https://example.com/first", opts); err != nil {
+		t.Fatalf("CreateShortURL() first claim error = %v", err)
+	}
+
+	_, err := s.CreateShortURL(context.Background(), "https://example.com/second", opts)
+	if !errors.Is(err, store.ErrAliasTaken) {
+		t.Errorf("CreateShortURL() second claim error = %v, want ErrAliasTaken", err)
+	}
+
+	// The original mapping must survive the failed claim
+	if got, err := s.GetOriginalURL(context.Background(), "launch"); err != nil || got != "https://example.com/first" {
+		t.Errorf("GetOriginalURL(launch) = %q, %v, want https://example.com/first", got, err)
+	}
+}
+
+func testInvalidAlias(t *testing.T, s store.Store) {
+	for _, alias := range []string{"ab", "has space", "slash/path", "dot.dot", "health", "API", "static"} {
+		_, err := s.CreateShortURL(context.Background(), "https://example.com", store.CreateOptions{Alias: alias})
+		if !errors.Is(err, store.ErrInvalidAlias) {
+			t.Errorf("CreateShortURL() alias %q error = %v, want ErrInvalidAlias", alias, err)
+		}
+	}
+}
+
+func testConcurrentAliasClaims(t *testing.T, s store.Store) {
+	const claimants = 20
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		winners int
+	)
+	for i := 0; i < claimants; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.CreateShortURL(context.Background(), "https://example.com", store.CreateOptions{Alias: "contested"})
+			switch {
+			case err == nil:
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			case !errors.Is(err, store.ErrAliasTaken):
+				t.Errorf("CreateShortURL() error = %v, want nil or ErrAliasTaken", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if winners != 1 {
+		t.Errorf("%d callers claimed the same alias, want exactly 1", winners)
+	}
+}
+
+func testExpiresIn(t *testing.T, s store.Store, clock *Clock) {
+	shortURL, err := s.CreateShortURL(context.Background(), "https://example.com/soon", store.CreateOptions{ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatalf("CreateShortURL() with ExpiresIn error = %v", err)
+	}
+	code := shortCode(t, shortURL)
+	forever := mustCreate(t, s, "https://example.com/forever")
+
+	clock.Advance(59 * time.Minute)
+	if got, err := s.GetOriginalURL(context.Background(), code); err != nil || got != "https://example.com/soon" {
+		t.Errorf("GetOriginalURL() before expiry = %q, %v, want https://example.com/soon", got, err)
+	}
+
+	clock.Advance(time.Minute)
+	if got, err := s.GetOriginalURL(context.Background(), code); !errors.Is(err, store.ErrLinkExpired) {
+		t.Errorf("GetOriginalURL() at expiry = %q, %v, want ErrLinkExpired", got, err)
+	}
+
+	// Expired visits are not clicks, but the count stays readable
+	if got, err := s.GetClickCount(context.Background(), code); err != nil || got != 1 {
+		t.Errorf("GetClickCount() after expiry = %v, %v, want 1", got, err)
+	}
+
+	// Links without an expiry are unaffected by time passing
+	clock.Advance(365 * 24 * time.Hour)
+	if got, err := s.GetOriginalURL(context.Background(), forever); err != nil || got != "https://example.com/forever" {
+		t.Errorf("GetOriginalURL() on link without expiry = %q, %v", got, err)
+	}
+}
+
+func testExpiresAt(t *testing.T, s store.Store, clock *Clock) {
+	expiresAt := clock.Now().Add(24 * time.Hour)
+	_, err := s.CreateShortURL(context.Background(), "https://example.com/event", store.CreateOptions{Alias: "event-day", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("CreateShortURL() with ExpiresAt error = %v", err)
+	}
+
+	if got, err := s.GetOriginalURL(context.Background(), "event-day"); err != nil || got != "https://example.com/event" {
+		t.Errorf("GetOriginalURL() before expiry = %q, %v, want https://example.com/event", got, err)
+	}
+
+	clock.Advance(25 * time.Hour)
+	if _, err := s.GetOriginalURL(context.Background(), "event-day"); !errors.Is(err, store.ErrLinkExpired) {
+		t.Errorf("GetOriginalURL() after expiry error = %v, want ErrLinkExpired", err)
+	}
+}
+
+func testInvalidExpiry(t *testing.T, s store.Store, clock *Clock) {
+	tests := []struct {
+		name string
+		opts store.CreateOptions
+	}{
+		{"past timestamp", store.CreateOptions{ExpiresAt: clock.Now().Add(-time.Minute)}},
+		{"negative duration", store.CreateOptions{ExpiresIn: -time.Minute}},
+		{"duration and timestamp", store.CreateOptions{ExpiresIn: time.Hour, ExpiresAt: clock.Now().Add(time.Hour)}},
+	}
+
+	for _, tt := range tests {
+		if _, err := s.CreateShortURL(context.Background(), "https://example.com", tt.opts); !errors.Is(err, store.ErrInvalidExpiry) {
+			t.Errorf("CreateShortURL() with %s error = %v, want ErrInvalidExpiry", tt.name, err)
+		}
+	}
+}
+
+func testMaxClicks(t *testing.T, s store.Store) {
+	shortURL, err := s.CreateShortURL(context.Background(), "https://example.com/capped", store.CreateOptions{MaxClicks: 3})
+	if err != nil {
+		t.Fatalf("CreateShortURL() with MaxClicks error = %v", err)
+	}
+	code := shortCode(t, shortURL)
+
+	for i := 1; i <= 3; i++ {
+		if got, err := s.GetOriginalURL(context.Background(), code); err != nil || got != "https://example.com/capped" {
+			t.Errorf("GetOriginalURL() click %d = %q, %v, want https://example.com/capped", i, got, err)
+		}
+	}
+
+	if _, err := s.GetOriginalURL(context.Background(), code); !errors.Is(err, store.ErrClickLimitReached) {
+		t.Errorf("GetOriginalURL() past the cap error = %v, want ErrClickLimitReached", err)
+	}
+
+	// Refused visits are not counted
+	if got, err := s.GetClickCount(context.Background(), code); err != nil || got != 3 {
+		t.Errorf("GetClickCount() after cap = %v, %v, want 3", got, err)
+	}
+}
+
+func testOneTimeLinkUnderContention(t *testing.T, s store.Store) {
+	shortURL, err := s.CreateShortURL(context.Background(), "https://example.com/secret", store.CreateOptions{MaxClicks: 1})
+	if err != nil {
+		t.Fatalf("CreateShortURL() one-time link error = %v", err)
+	}
+	code := shortCode(t, shortURL)
+
+	const visitors = 20
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < visitors; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.GetOriginalURL(context.Background(), code)
+			switch {
+			case err == nil:
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			case !errors.Is(err, store.ErrClickLimitReached):
+				t.Errorf("GetOriginalURL() error = %v, want nil or ErrClickLimitReached", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 1 {
+		t.Errorf("%d visitors got through a one-time link, want exactly 1", allowed)
+	}
+	if got, err := s.GetClickCount(context.Background(), code); err != nil || got != 1 {
+		t.Errorf("GetClickCount() = %v, %v, want 1", got, err)
+	}
+}
+
+func testInvalidMaxClicks(t *testing.T, s store.Store) {
+	if _, err := s.CreateShortURL(context.Background(), "https://example.com", store.CreateOptions{MaxClicks: -1}); !errors.Is(err, store.ErrInvalidMaxClicks) {
+		t.Errorf("CreateShortURL() with negative MaxClicks error = %v, want ErrInvalidMaxClicks", err)
+	}
+}
+
+func testGetURLData(t *testing.T, s store.Store, clock *Clock) {
+	createdAt := clock.Now()
+	shortURL, err := s.CreateShortURL(context.Background(), "https://example.com/data", store.CreateOptions{
+		ExpiresIn: time.Hour,
+		MaxClicks: 10,
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	code := shortCode(t, shortURL)
+
+	if _, err := s.GetOriginalURL(context.Background(), code); err != nil {
+		t.Fatalf("GetOriginalURL() error = %v", err)
+	}
+
+	urlData, err := s.GetURLData(context.Background(), code)
+	if err != nil || urlData == nil {
+		t.Fatalf("GetURLData() = %v, %v, want data", urlData, err)
+	}
+	if urlData.OriginalURL != "https://example.com/data" {
+		t.Errorf("OriginalURL = %q, want https://example.com/data", urlData.OriginalURL)
+	}
+	if !urlData.CreatedAt.Equal(createdAt) {
+		t.Errorf("CreatedAt = %v, want %v", urlData.CreatedAt, createdAt)
+	}
+	if !urlData.ExpiresAt.Equal(createdAt.Add(time.Hour)) {
+		t.Errorf("ExpiresAt = %v, want %v", urlData.ExpiresAt, createdAt.Add(time.Hour))
+	}
+	if urlData.MaxClicks != 10 {
+		t.Errorf("MaxClicks = %v, want 10", urlData.MaxClicks)
+	}
+	if urlData.ClickCount != 1 {
+		t.Errorf("ClickCount = %v, want 1", urlData.ClickCount)
+	}
+	if urlData.HasPassword() {
+		t.Error("HasPassword() = true for a link created without a password")
+	}
+	if urlData.Status != store.StatusActive || !urlData.DeletedAt.IsZero() {
+		t.Errorf("Status = %q, DeletedAt = %v, want active and never deleted", urlData.Status, urlData.DeletedAt)
+	}
+
+	// Looking a link up is not a click
+	if got, err := s.GetClickCount(context.Background(), code); err != nil || got != 1 {
+		t.Errorf("GetClickCount() after GetURLData = %v, %v, want 1", got, err)
+	}
+}
+
+func testGetURLDataNotFound(t *testing.T, s store.Store) {
+	if got, err := s.GetURLData(context.Background(), "nonexistent"); err != nil || got != nil {
+		t.Errorf("GetURLData(nonexistent) = %v, %v, want nil, <nil>", got, err)
+	}
+}
+
+func testPassword(t *testing.T, s store.Store) {
+	shortURL, err := s.CreateShortURL(context.Background(), "https://example.com/private", store.CreateOptions{Password: "s3cret"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() with password error = %v", err)
+	}
+	code := shortCode(t, shortURL)
+
+	urlData, err := s.GetURLData(context.Background(), code)
+	if err != nil || urlData == nil {
+		t.Fatalf("GetURLData() = %v, %v, want data", urlData, err)
+	}
+	if !urlData.HasPassword() {
+		t.Fatal("HasPassword() = false for a protected link")
+	}
+	if strings.Contains(urlData.PasswordHash, "s3cret") {
+		t.Error("PasswordHash contains the plaintext password")
+	}
+	if !urlData.CheckPassword("s3cret") {
+		t.Error("CheckPassword() rejected the correct password")
+	}
+	if urlData.CheckPassword("guess") {
+		t.Error("CheckPassword() accepted a wrong password")
+	}
+}
+
+func testInvalidPassword(t *testing.T, s store.Store) {
+	_, err := s.CreateShortURL(context.Background(), "https://example.com", store.CreateOptions{Password: strings.Repeat("x", 73)})
+	if !errors.Is(err, store.ErrInvalidPassword) {
+		t.Errorf("CreateShortURL() with 73-byte password error = %v, want ErrInvalidPassword", err)
+	}
+}
+
+func testManageToken(t *testing.T, s store.Store) {
+	shortURL, err := s.CreateShortURL(context.Background(), "https://example.com", store.CreateOptions{ManageToken: "token-123"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() with manage token error = %v", err)
+	}
+	code := shortCode(t, shortURL)
+
+	urlData, err := s.GetURLData(context.Background(), code)
+	if err != nil || urlData == nil {
+		t.Fatalf("GetURLData() = %v, %v, want data", urlData, err)
+	}
+	if urlData.ManageTokenHash == "" || strings.Contains(urlData.ManageTokenHash, "token-123") {
+		t.Errorf("ManageTokenHash = %q, want a hash of the token", urlData.ManageTokenHash)
+	}
+	if !urlData.CheckManageToken("token-123") {
+		t.Error("CheckManageToken() rejected the correct token")
+	}
+	if urlData.CheckManageToken("token-456") || urlData.CheckManageToken("") {
+		t.Error("CheckManageToken() accepted a wrong token")
+	}
+
+	// Links created without a token cannot be managed at all
+	unmanaged, err := s.GetURLData(context.Background(), mustCreate(t, s, "https://example.com"))
+	if err != nil || unmanaged == nil {
+		t.Fatalf("GetURLData() = %v, %v, want data", unmanaged, err)
+	}
+	if unmanaged.CheckManageToken("") {
+		t.Error("CheckManageToken(\"\") accepted a link created without a token")
+	}
+}
+
+func testUpdateDestination(t *testing.T, s store.Store) {
+	code := mustCreate(t, s, "https://example.com/old")
+	if _, err := s.GetOriginalURL(context.Background(), code); err != nil {
+		t.Fatalf("GetOriginalURL() error = %v", err)
+	}
+
+	newURL := "https://example.com/new"
+	if err := s.UpdateLink(context.Background(), code, store.LinkUpdate{OriginalURL: &newURL}); err != nil {
+		t.Fatalf("UpdateLink() error = %v", err)
+	}
+
+	if got, err := s.GetOriginalURL(context.Background(), code); err != nil || got != newURL {
+		t.Errorf("GetOriginalURL() after update = %q, %v, want %q", got, err, newURL)
+	}
+	// Changing the destination keeps the clicks already counted
+	if got, err := s.GetClickCount(context.Background(), code); err != nil || got != 2 {
+		t.Errorf("GetClickCount() after update = %v, %v, want 2", got, err)
+	}
+
+	empty := ""
+	if err := s.UpdateLink(context.Background(), code, store.LinkUpdate{OriginalURL: &empty}); err == nil {
+		t.Error("UpdateLink() with an empty destination succeeded, want error")
+	}
+}
+
+func testDisableLink(t *testing.T, s store.Store) {
+	code := mustCreate(t, s, "https://example.com")
+
+	if err := s.SetLinkStatus(context.Background(), code, store.StatusDisabled); err != nil {
+		t.Fatalf("SetLinkStatus(disabled) error = %v", err)
+	}
+	if _, err := s.GetOriginalURL(context.Background(), code); !errors.Is(err, store.ErrLinkDisabled) {
+		t.Errorf("GetOriginalURL() on disabled link error = %v, want ErrLinkDisabled", err)
+	}
+	if got, err := s.GetClickCount(context.Background(), code); err != nil || got != 0 {
+		t.Errorf("GetClickCount() on disabled link = %v, %v, want 0", got, err)
+	}
+	if urlData, err := s.GetURLData(context.Background(), code); err != nil || urlData == nil || urlData.Status != store.StatusDisabled {
+		t.Errorf("GetURLData() on disabled link = %+v, %v, want status disabled", urlData, err)
+	}
+
+	if err := s.SetLinkStatus(context.Background(), code, store.StatusActive); err != nil {
+		t.Fatalf("SetLinkStatus(active) error = %v", err)
+	}
+	if got, err := s.GetOriginalURL(context.Background(), code); err != nil || got != "https://example.com" {
+		t.Errorf("GetOriginalURL() on re-enabled link = %q, %v, want https://example.com", got, err)
+	}
+}
+
+func testSoftDeleteAndRestore(t *testing.T, s store.Store, clock *Clock) {
+	code := mustCreate(t, s, "https://example.com")
+
+	clock.Advance(time.Hour)
+	deletedAt := clock.Now()
+	if err := s.SetLinkStatus(context.Background(), code, store.StatusDeleted); err != nil {
+		t.Fatalf("SetLinkStatus(deleted) error = %v", err)
+	}
+	if _, err := s.GetOriginalURL(context.Background(), code); !errors.Is(err, store.ErrLinkDeleted) {
+		t.Errorf("GetOriginalURL() on deleted link error = %v, want ErrLinkDeleted", err)
+	}
+	urlData, err := s.GetURLData(context.Background(), code)
+	if err != nil || urlData == nil {
+		t.Fatalf("GetURLData() on deleted link = %v, %v, want data", urlData, err)
+	}
+	if urlData.Status != store.StatusDeleted || urlData.IsActive() {
+		t.Errorf("Status = %q, IsActive() = %v, want deleted and inactive", urlData.Status, urlData.IsActive())
+	}
+	if !urlData.DeletedAt.Equal(deletedAt) {
+		t.Errorf("DeletedAt = %v, want %v", urlData.DeletedAt, deletedAt)
+	}
+
+	if err := s.SetLinkStatus(context.Background(), code, store.StatusActive); err != nil {
+		t.Fatalf("SetLinkStatus(active) error = %v", err)
+	}
+	urlData, err = s.GetURLData(context.Background(), code)
+	if err != nil || urlData == nil {
+		t.Fatalf("GetURLData() on restored link = %v, %v, want data", urlData, err)
+	}
+	if urlData.Status != store.StatusActive || !urlData.DeletedAt.IsZero() {
+		t.Errorf("restored link Status = %q, DeletedAt = %v, want active and zero", urlData.Status, urlData.DeletedAt)
+	}
+	if got, err := s.GetOriginalURL(context.Background(), code); err != nil || got != "https://example.com" {
+		t.Errorf("GetOriginalURL() on restored link = %q, %v, want https://example.com", got, err)
+	}
+}
+
+func testSetLinkStatusErrors(t *testing.T, s store.Store) {
+	if err := s.SetLinkStatus(context.Background(), "nonexistent", store.StatusDisabled); !errors.Is(err, store.ErrLinkNotFound) {
+		t.Errorf("SetLinkStatus(nonexistent) error = %v, want ErrLinkNotFound", err)
+	}
+	if got, err := s.GetURLData(context.Background(), "nonexistent"); err != nil || got != nil {
+		t.Errorf("GetURLData() after failed status change = %v, %v, want nil, <nil>", got, err)
+	}
+
+	code := mustCreate(t, s, "https://example.com")
+	if err := s.SetLinkStatus(context.Background(), code, "archived"); !errors.Is(err, store.ErrInvalidStatus) {
+		t.Errorf("SetLinkStatus(archived) error = %v, want ErrInvalidStatus", err)
+	}
+}
+
+func testPurgeDeletedLinks(t *testing.T, s store.Store, clock *Clock) {
+	oldCode := mustCreate(t, s, "https://example.com/old")
+	newCode := mustCreate(t, s, "https://example.com/new")
+	restoredCode := mustCreate(t, s, "https://example.com/restored")
+	activeCode := mustCreate(t, s, "https://example.com/active")
+
+	for _, code := range []string{oldCode, restoredCode} {
+		if err := s.SetLinkStatus(context.Background(), code, store.StatusDeleted); err != nil {
+			t.Fatalf("SetLinkStatus(%q, deleted) error = %v", code, err)
+		}
+	}
+	if err := s.SetLinkStatus(context.Background(), restoredCode, store.StatusActive); err != nil {
+		t.Fatalf("SetLinkStatus(%q, active) error = %v", restoredCode, err)
+	}
+	cutoff := clock.Now()
+
+	clock.Advance(time.Hour)
+	if err := s.SetLinkStatus(context.Background(), newCode, store.StatusDeleted); err != nil {
+		t.Fatalf("SetLinkStatus(%q, deleted) error = %v", newCode, err)
+	}
+
+	purged, err := s.PurgeDeletedLinks(context.Background(), cutoff)
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeDeletedLinks() = %v, %v, want 1", purged, err)
+	}
+	if got, err := s.GetURLData(context.Background(), oldCode); err != nil || got != nil {
+		t.Errorf("GetURLData(%q) after purge = %v, %v, want nil, <nil>", oldCode, got, err)
+	}
+	if history, err := s.GetLinkHistory(context.Background(), oldCode); err != nil || history != nil {
+		t.Errorf("GetLinkHistory(%q) after purge = %v, %v, want nil, <nil>", oldCode, history, err)
+	}
+	for _, code := range []string{newCode, restoredCode, activeCode} {
+		if got, err := s.GetURLData(context.Background(), code); err != nil || got == nil {
+			t.Errorf("GetURLData(%q) after purge = %v, %v, want the link kept", code, got, err)
+		}
+	}
+
+	// Purging is idempotent
+	if purged, err := s.PurgeDeletedLinks(context.Background(), cutoff); err != nil || purged != 0 {
+		t.Errorf("second PurgeDeletedLinks() = %v, %v, want 0", purged, err)
+	}
+}
+
+func testRestoreLink(t *testing.T, s store.Store, clock *Clock) {
+	code := mustCreate(t, s, "https://example.com/restore")
+
+	if err := s.RestoreLink(context.Background(), code, time.Hour); !errors.Is(err, store.ErrLinkNotDeleted) {
+		t.Errorf("RestoreLink(active) error = %v, want ErrLinkNotDeleted", err)
+	}
+	if err := s.RestoreLink(context.Background(), "nonexistent", time.Hour); !errors.Is(err, store.ErrLinkNotFound) {
+		t.Errorf("RestoreLink(nonexistent) error = %v, want ErrLinkNotFound", err)
+	}
+
+	if err := s.SetLinkStatus(context.Background(), code, store.StatusDeleted); err != nil {
+		t.Fatalf("SetLinkStatus(deleted) error = %v", err)
+	}
+	clock.Advance(time.Hour - time.Minute)
+	if err := s.RestoreLink(context.Background(), code, time.Hour); err != nil {
+		t.Fatalf("RestoreLink() within retention error = %v", err)
+	}
+	urlData, err := s.GetURLData(context.Background(), code)
+	if err != nil || urlData == nil {
+		t.Fatalf("GetURLData() = %v, %v", urlData, err)
+	}
+	if urlData.Status != store.StatusActive || !urlData.DeletedAt.IsZero() {
+		t.Errorf("restored link status = %q, deleted at %v, want active and no deletion time", urlData.Status, urlData.DeletedAt)
+	}
+
+	// Once the retention period has passed by the store's clock, the link belongs to the purger
+	if err := s.SetLinkStatus(context.Background(), code, store.StatusDeleted); err != nil {
+		t.Fatalf("SetLinkStatus(deleted) error = %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := s.RestoreLink(context.Background(), code, time.Hour); !errors.Is(err, store.ErrRestoreExpired) {
+		t.Errorf("RestoreLink() after retention error = %v, want ErrRestoreExpired", err)
+	}
+	if purged, err := s.PurgeDeletedLinks(context.Background(), clock.Now().Add(-time.Hour)); err != nil || purged != 1 {
+		t.Errorf("PurgeDeletedLinks() = %v, %v, want the expired link purged", purged, err)
+	}
+}
+
+func testUpdateLinkNotFound(t *testing.T, s store.Store) {
+	newURL := "https://example.com"
+	if err := s.UpdateLink(context.Background(), "nonexistent", store.LinkUpdate{OriginalURL: &newURL}); !errors.Is(err, store.ErrLinkNotFound) {
+		t.Errorf("UpdateLink(nonexistent) error = %v, want ErrLinkNotFound", err)
+	}
+	if err := s.UpdateLink(context.Background(), "nonexistent", store.LinkUpdate{}); !errors.Is(err, store.ErrLinkNotFound) {
+		t.Errorf("UpdateLink(nonexistent) with no changes error = %v, want ErrLinkNotFound", err)
+	}
+	if got, err := s.GetURLData(context.Background(), "nonexistent"); err != nil || got != nil {
+		t.Errorf("GetURLData() after failed update = %v, %v, want nil, <nil>", got, err)
+	}
+}
+
+func testDeleteLink(t *testing.T, s store.Store) {
+	code := mustCreate(t, s, "https://example.com")
+	if _, err := s.GetOriginalURL(context.Background(), code); err != nil {
+		t.Fatalf("GetOriginalURL() error = %v", err)
+	}
+
+	if err := s.DeleteLink(context.Background(), code); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+
+	if got, err := s.GetOriginalURL(context.Background(), code); err != nil || got != "" {
+		t.Errorf("GetOriginalURL() after delete = %q, %v, want \"\", <nil>", got, err)
+	}
+	if got, err := s.GetClickCount(context.Background(), code); err != nil || got != -1 {
+		t.Errorf("GetClickCount() after delete = %v, %v, want -1, <nil>", got, err)
+	}
+	if err := s.DeleteLink(context.Background(), code); !errors.Is(err, store.ErrLinkNotFound) {
+		t.Errorf("second DeleteLink() error = %v, want ErrLinkNotFound", err)
+	}
+}
+
+func testDeleteLinkNotFound(t *testing.T, s store.Store) {
+	if err := s.DeleteLink(context.Background(), "nonexistent"); !errors.Is(err, store.ErrLinkNotFound) {
+		t.Errorf("DeleteLink(nonexistent) error = %v, want ErrLinkNotFound", err)
+	}
+}
+
+func testDestinationHistory(t *testing.T, s store.Store, clock *Clock) {
+	createdAt := clock.Now()
+	code := mustCreate(t, s, "https://example.com/v1")
+
+	clock.Advance(time.Hour)
+	secondAt := clock.Now()
+	v2 := "https://example.com/v2"
+	if err := s.UpdateLink(context.Background(), code, store.LinkUpdate{OriginalURL: &v2, Actor: "owner"}); err != nil {
+		t.Fatalf("UpdateLink() error = %v", err)
+	}
+
+	// Disabling does not change the destination, so it is not recorded
+	clock.Advance(time.Hour)
+	if err := s.SetLinkStatus(context.Background(), code, store.StatusDisabled); err != nil {
+		t.Fatalf("SetLinkStatus() error = %v", err)
+	}
+	if err := s.UpdateLink(context.Background(), code, store.LinkUpdate{Actor: "owner"}); err != nil {
+		t.Fatalf("UpdateLink() with no changes error = %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	thirdAt := clock.Now()
+	v3 := "https://example.com/v1"
+	if err := s.UpdateLink(context.Background(), code, store.LinkUpdate{OriginalURL: &v3, Actor: "admin"}); err != nil {
+		t.Fatalf("UpdateLink() error = %v", err)
+	}
+
+	history, err := s.GetLinkHistory(context.Background(), code)
+	if err != nil {
+		t.Fatalf("GetLinkHistory() error = %v", err)
+	}
+	want := []store.DestinationChange{
+		{Version: 1, OriginalURL: "https://example.com/v1", ChangedAt: createdAt, Actor: store.ActorCreator},
+		{Version: 2, OriginalURL: "https://example.com/v2", ChangedAt: secondAt, Actor: "owner"},
+		{Version: 3, OriginalURL: "https://example.com/v1", ChangedAt: thirdAt, Actor: "admin"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("GetLinkHistory() returned %d entries, want %d: %+v", len(history), len(want), history)
+	}
+	for i := range want {
+		got := history[i]
+		if got.Version != want[i].Version || got.OriginalURL != want[i].OriginalURL || got.Actor != want[i].Actor ||
+			!got.ChangedAt.Equal(want[i].ChangedAt) {
+			t.Errorf("history[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	// Clicks can be attributed to the destination in effect when they happened
+	if got, ok := store.DestinationAt(history, secondAt.Add(time.Minute)); !ok || got.Version != 2 {
+		t.Errorf("DestinationAt(after second change) = %+v, %v, want version 2", got, ok)
+	}
+	if _, ok := store.DestinationAt(history, createdAt.Add(-time.Minute)); ok {
+		t.Error("DestinationAt(before creation) found an entry")
+	}
+
+	if err := s.DeleteLink(context.Background(), code); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+	if history, err := s.GetLinkHistory(context.Background(), code); err != nil || history != nil {
+		t.Errorf("GetLinkHistory() after delete = %v, %v, want nil, <nil>", history, err)
+	}
+}
+
+func testLinkHistoryNotFound(t *testing.T, s store.Store) {
+	if history, err := s.GetLinkHistory(context.Background(), "nonexistent"); err != nil || history != nil {
+		t.Errorf("GetLinkHistory(nonexistent) = %v, %v, want nil, <nil>", history, err)
+	}
+}
+
+// listAll pages through ListLinks with opts and returns every code in order
+func listAll(t *testing.T, s store.Store, opts store.ListOptions) []string {
+	t.Helper()
+
+	var codes []string
+	for page := 0; ; page++ {
+		if page > 100 {
+			t.Fatal("ListLinks() kept returning a next cursor")
+		}
+		result, err := s.ListLinks(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("ListLinks(%+v) error = %v", opts, err)
+		}
+		if opts.Limit > 0 && len(result.Links) > opts.Limit {
+			t.Fatalf("ListLinks() returned %d links, limit %d", len(result.Links), opts.Limit)
+		}
+		for _, rec := range result.Links {
+			codes = append(codes, rec.Code)
+		}
+		if result.NextCursor == "" {
+			return codes
+		}
+		opts.Cursor = result.NextCursor
+	}
+}
+
+func testListLinksPagination(t *testing.T, s store.Store, clock *Clock) {
+	if got := listAll(t, s, store.ListOptions{}); len(got) != 0 {
+		t.Errorf("ListLinks() on an empty store = %v, want none", got)
+	}
+
+	var created []string
+	for i := 0; i < 5; i++ {
+		created = append(created, mustCreate(t, s, "https://example.com"))
+		clock.Advance(time.Minute)
+	}
+
+	first, err := s.ListLinks(context.Background(), store.ListOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListLinks() error = %v", err)
+	}
+	if len(first.Links) != 2 || first.NextCursor == "" {
+		t.Fatalf("first page = %d links, cursor %q, want 2 links and a cursor", len(first.Links), first.NextCursor)
+	}
+	if first.Links[0].Code != created[4] || first.Links[0].OriginalURL != "https://example.com" {
+		t.Errorf("first link = %+v, want the newest link %q", first.Links[0], created[4])
+	}
+
+	// Newest first, every link exactly once
+	got := listAll(t, s, store.ListOptions{Limit: 2})
+	want := []string{created[4], created[3], created[2], created[1], created[0]}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListLinks() pages = %v, want %v", got, want)
+	}
+
+	// A page that ends exactly on the last link has no next cursor
+	if page, err := s.ListLinks(context.Background(), store.ListOptions{Limit: 5}); err != nil || len(page.Links) != 5 || page.NextCursor != "" {
+		t.Errorf("ListLinks(limit 5) = %d links, cursor %q, %v, want 5 links and no cursor", len(page.Links), page.NextCursor, err)
+	}
+
+	if err := s.DeleteLink(context.Background(), created[2]); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+	got = listAll(t, s, store.ListOptions{Limit: 2})
+	want = []string{created[4], created[3], created[1], created[0]}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListLinks() after DeleteLink = %v, want %v", got, want)
+	}
+}
+
+func testListLinksSameCreationTime(t *testing.T, s store.Store) {
+	seen := map[string]bool{}
+	for i := 0; i < 7; i++ {
+		seen[mustCreate(t, s, "https://example.com")] = false
+	}
+
+	for _, code := range listAll(t, s, store.ListOptions{Limit: 2}) {
+		if done, ok := seen[code]; !ok || done {
+			t.Errorf("ListLinks() returned %q unexpectedly or twice", code)
+		}
+		seen[code] = true
+	}
+	for code, done := range seen {
+		if !done {
+			t.Errorf("ListLinks() never returned %q", code)
+		}
+	}
+}
+
+func testListLinksFilters(t *testing.T, s store.Store, clock *Clock) {
+	start := clock.Now()
+	old := mustCreate(t, s, "https://old.example.com/a")
+
+	clock.Advance(time.Hour)
+	popular := mustCreate(t, s, "https://Example.com/popular")
+	for i := 0; i < 3; i++ {
+		if _, err := s.GetOriginalURL(context.Background(), popular); err != nil {
+			t.Fatalf("GetOriginalURL() error = %v", err)
+		}
+	}
+
+	clock.Advance(time.Hour)
+	disabled := mustCreate(t, s, "https://example.com:8443/off")
+	if err := s.SetLinkStatus(context.Background(), disabled, store.StatusDisabled); err != nil {
+		t.Fatalf("SetLinkStatus() error = %v", err)
+	}
+
+	one, three := int64(1), int64(3)
+	tests := []struct {
+		name string
+		opts store.ListOptions
+		want []string
+	}{
+		{"created after", store.ListOptions{CreatedAfter: start.Add(time.Hour)}, []string{disabled, popular}},
+		{"created before", store.ListOptions{CreatedBefore: start.Add(time.Hour)}, []string{popular, old}},
+		{"created range", store.ListOptions{CreatedAfter: start.Add(30 * time.Minute), CreatedBefore: start.Add(90 * time.Minute)}, []string{popular}},
+		{"min clicks", store.ListOptions{MinClicks: &one}, []string{popular}},
+		{"max clicks", store.ListOptions{MaxClicks: &one}, []string{disabled, old}},
+		{"exact clicks", store.ListOptions{MinClicks: &three, MaxClicks: &three}, []string{popular}},
+		{"host ignores case and port", store.ListOptions{Host: "example.COM"}, []string{disabled, popular}},
+		{"host is exact", store.ListOptions{Host: "old.example.com"}, []string{old}},
+		{"status", store.ListOptions{Status: store.StatusDisabled}, []string{disabled}},
+		{"combined", store.ListOptions{Host: "example.com", Status: store.StatusActive}, []string{popular}},
+		{"no match", store.ListOptions{Host: "nowhere.example"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A page size of 1 makes the filters work across page boundaries
+			tt.opts.Limit = 1
+			got := listAll(t, s, tt.opts)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ListLinks(%+v) = %v, want %v", tt.opts, got, tt.want)
+			}
+		})
+	}
+}
+
+// mustCreateOrReuse calls CreateOrReuseShortURL and returns the code and whether it was created
+func mustCreateOrReuse(t *testing.T, s store.Store, originalURL, scope string) (string, bool) {
+	t.Helper()
+
+	shortURL, created, err := s.CreateOrReuseShortURL(context.Background(), originalURL, store.CreateOptions{DedupeScope: scope})
+	if err != nil {
+		t.Fatalf("CreateOrReuseShortURL(%q, %q) error = %v", originalURL, scope, err)
+	}
+	return shortCode(t, shortURL), created
+}
+
+func testConcurrentCreateOrReuse(t *testing.T, s store.Store) {
+	const callers = 20
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		created  int
+		shortURL = map[string]bool{}
+	)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, isNew, err := s.CreateOrReuseShortURL(context.Background(), "https://example.com/popular", store.CreateOptions{})
+			if err != nil {
+				t.Errorf("CreateOrReuseShortURL() error = %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			shortURL[got] = true
+			if isNew {
+				created++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 || len(shortURL) != 1 {
+		t.Errorf("concurrent CreateOrReuseShortURL() created %d links and returned %d short URLs, want 1 of each", created, len(shortURL))
+	}
+}
+
+func testCreateOrReuse(t *testing.T, s store.Store) {
+	plain := mustCreate(t, s, "https://example.com/page")
+
+	first, created := mustCreateOrReuse(t, s, "https://example.com/page", "")
+	if !created || first == plain {
+		t.Fatalf("first CreateOrReuseShortURL() = %q, created %v; want a new link, not the plain %q", first, created, plain)
+	}
+
+	again, created := mustCreateOrReuse(t, s, "https://example.com/page", "")
+	if created || again != first {
+		t.Errorf("second CreateOrReuseShortURL() = %q, created %v; want %q reused", again, created, first)
+	}
+
+	upper, created := mustCreateOrReuse(t, s, "HTTPS://EXAMPLE.com/page", "")
+	if created || upper != first {
+		t.Errorf("CreateOrReuseShortURL() with an uppercase host = %q, created %v; want %q reused", upper, created, first)
+	}
+
+	if other, created := mustCreateOrReuse(t, s, "https://example.com/Page", ""); !created || other == first {
+		t.Errorf("CreateOrReuseShortURL() with a different path = %q, created %v; want a new link", other, created)
+	}
+
+	scoped, created := mustCreateOrReuse(t, s, "https://example.com/page", "team-a")
+	if !created || scoped == first {
+		t.Errorf("CreateOrReuseShortURL() in a scope = %q, created %v; want a new link", scoped, created)
+	}
+	if again, created := mustCreateOrReuse(t, s, "https://example.com/page", "team-a"); created || again != scoped {
+		t.Errorf("CreateOrReuseShortURL() in the same scope = %q, created %v; want %q reused", again, created, scoped)
+	}
+}
+
+func testCreateOrReuseSkipsChangedLinks(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	disabled, _ := mustCreateOrReuse(t, s, "https://example.com/disabled", "")
+	if err := s.SetLinkStatus(ctx, disabled, store.StatusDisabled); err != nil {
+		t.Fatalf("SetLinkStatus() error = %v", err)
+	}
+	if code, created := mustCreateOrReuse(t, s, "https://example.com/disabled", ""); !created || code == disabled {
+		t.Errorf("CreateOrReuseShortURL() after disabling = %q, created %v; want a new link", code, created)
+	}
+
+	moved, _ := mustCreateOrReuse(t, s, "https://example.com/moved", "")
+	elsewhere := "https://example.com/elsewhere"
+	if err := s.UpdateLink(ctx, moved, store.LinkUpdate{OriginalURL: &elsewhere, Actor: store.ActorCreator}); err != nil {
+		t.Fatalf("UpdateLink() error = %v", err)
+	}
+	if code, created := mustCreateOrReuse(t, s, "https://example.com/moved", ""); !created || code == moved {
+		t.Errorf("CreateOrReuseShortURL() after a destination change = %q, created %v; want a new link", code, created)
+	}
+
+	deleted, _ := mustCreateOrReuse(t, s, "https://example.com/deleted", "")
+	if err := s.DeleteLink(ctx, deleted); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+	replacement, created := mustCreateOrReuse(t, s, "https://example.com/deleted", "")
+	if !created || replacement == deleted {
+		t.Errorf("CreateOrReuseShortURL() after deleting = %q, created %v; want a new link", replacement, created)
+	}
+	if again, created := mustCreateOrReuse(t, s, "https://example.com/deleted", ""); created || again != replacement {
+		t.Errorf("CreateOrReuseShortURL() = %q, created %v; want the replacement %q reused", again, created, replacement)
+	}
+}
+
+func testCreateOrReuseConflicts(t *testing.T, s store.Store) {
+	for name, opts := range map[string]store.CreateOptions{
+		"alias":      {Alias: "reused"},
+		"expires in": {ExpiresIn: time.Hour},
+		"expires at": {ExpiresAt: time.Now().Add(time.Hour)},
+		"max clicks": {MaxClicks: 1},
+		"password":   {Password: "secret"},
+	} {
+		if _, _, err := s.CreateOrReuseShortURL(context.Background(), "https://example.com", opts); !errors.Is(err, store.ErrDedupeConflict) {
+			t.Errorf("%s: CreateOrReuseShortURL() error = %v, want ErrDedupeConflict", name, err)
+		}
+	}
+}
+
+func testLinkMetadata(t *testing.T, s store.Store) {
+	shortURL, err := s.CreateShortURL(context.Background(), "https://example.com/spring", store.CreateOptions{
+		Title:       "Spring sale",
+		Description: "Landing page for the\nspring campaign",
+		Tags:        []string{"Campaign-2025", " marketing ", "campaign-2025"},
+		Metadata:    map[string]string{"owner": "growth", "utm_source": "newsletter"},
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	code := shortCode(t, shortURL)
+
+	check := func(name string, d store.URLData) {
+		t.Helper()
+		if d.Title != "Spring sale" || d.Description != "Landing page for the\nspring campaign" {
+			t.Errorf("%s: Title = %q, Description = %q", name, d.Title, d.Description)
+		}
+		if strings.Join(d.Tags, ",") != "campaign-2025,marketing" {
+			t.Errorf("%s: Tags = %q, want [campaign-2025 marketing]", name, d.Tags)
+		}
+		if len(d.Metadata) != 2 || d.Metadata["owner"] != "growth" || d.Metadata["utm_source"] != "newsletter" {
+			t.Errorf("%s: Metadata = %v", name, d.Metadata)
+		}
+		if !d.HasTag("MARKETING") || d.HasTag("sales") {
+			t.Errorf("%s: HasTag gave the wrong answer for %q", name, d.Tags)
+		}
+	}
+
+	urlData, err := s.GetURLData(context.Background(), code)
+	if err != nil || urlData == nil {
+		t.Fatalf("GetURLData() = %v, %v, want data", urlData, err)
+	}
+	check("GetURLData", *urlData)
+
+	page, err := s.ListLinks(context.Background(), store.ListOptions{})
+	if err != nil || len(page.Links) != 1 {
+		t.Fatalf("ListLinks() = %+v, %v, want one link", page, err)
+	}
+	check("ListLinks", page.Links[0].URLData)
+
+	plain := mustCreate(t, s, "https://example.com/plain")
+	urlData, err = s.GetURLData(context.Background(), plain)
+	if err != nil || urlData == nil {
+		t.Fatalf("GetURLData() = %v, %v, want data", urlData, err)
+	}
+	if urlData.Title != "" || urlData.Description != "" || urlData.Tags != nil || urlData.Metadata != nil {
+		t.Errorf("link created without metadata has %+v", urlData)
+	}
+}
+
+func testInvalidMetadata(t *testing.T, s store.Store) {
+	tooManyTags := make([]string, 21)
+	for i := range tooManyTags {
+		tooManyTags[i] = "tag" + strconv.Itoa(i)
+	}
+	tooMuchMetadata := map[string]string{}
+	for i := 0; i < 21; i++ {
+		tooMuchMetadata["key"+strconv.Itoa(i)] = "value"
+	}
+
+	tests := []struct {
+		name string
+		opts store.CreateOptions
+		want error
+	}{
+		{"too many tags", store.CreateOptions{Tags: tooManyTags}, store.ErrInvalidTags},
+		{"blank tag", store.CreateOptions{Tags: []string{"ok", "  "}}, store.ErrInvalidTags},
+		{"long tag", store.CreateOptions{Tags: []string{strings.Repeat("t", 51)}}, store.ErrInvalidTags},
+		{"long title", store.CreateOptions{Title: strings.Repeat("t", 201)}, store.ErrInvalidMetadata},
+		{"control character in title", store.CreateOptions{Title: "bad\x00title"}, store.ErrInvalidMetadata},
+		{"long description", store.CreateOptions{Description: strings.Repeat("d", 1001)}, store.ErrInvalidMetadata},
+		{"too many metadata entries", store.CreateOptions{Metadata: tooMuchMetadata}, store.ErrInvalidMetadata},
+		{"empty metadata key", store.CreateOptions{Metadata: map[string]string{"": "value"}}, store.ErrInvalidMetadata},
+		{"long metadata value", store.CreateOptions{Metadata: map[string]string{"key": strings.Repeat("v", 501)}}, store.ErrInvalidMetadata},
+	}
+	for _, tt := range tests {
+		if _, err := s.CreateShortURL(context.Background(), "https://example.com", tt.opts); !errors.Is(err, tt.want) {
+			t.Errorf("%s: CreateShortURL() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	page, err := s.ListLinks(context.Background(), store.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListLinks() error = %v", err)
+	}
+	if len(page.Links) != 0 {
+		t.Errorf("rejected links were stored: %+v", page.Links)
+	}
+}
+
+func testListLinksByTag(t *testing.T, s store.Store, clock *Clock) {
+	ctx := context.Background()
+	create := func(alias string, tags ...string) {
+		t.Helper()
+		if _, err := s.CreateShortURL(ctx, "https://example.com/"+alias, store.CreateOptions{Alias: alias, Tags: tags}); err != nil {
+			t.Fatalf("CreateShortURL(%q) error = %v", alias, err)
+		}
+		clock.Advance(time.Minute)
+	}
+	create("first", "spring", "team-a")
+	create("second", "team-b")
+	create("third", "Spring")
+	create("fourth", "spring", "team-b")
+	if err := s.SetLinkStatus(ctx, "fourth", store.StatusDisabled); err != nil {
+		t.Fatalf("SetLinkStatus() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts store.ListOptions
+		want []string
+	}{
+		{"tag", store.ListOptions{Tag: "spring"}, []string{"fourth", "third", "first"}},
+		{"tag ignores case", store.ListOptions{Tag: " SPRING "}, []string{"fourth", "third", "first"}},
+		{"tag and status", store.ListOptions{Tag: "spring", Status: store.StatusActive}, []string{"third", "first"}},
+		{"other tag", store.ListOptions{Tag: "team-b"}, []string{"fourth", "second"}},
+		{"unknown tag", store.ListOptions{Tag: "autumn"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Limit = 1
+			got := listAll(t, s, tt.opts)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ListLinks(%+v) = %v, want %v", tt.opts, got, tt.want)
+			}
+		})
+	}
+
+	if err := s.DeleteLink(ctx, "third"); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+	if got := listAll(t, s, store.ListOptions{Tag: "spring"}); strings.Join(got, ",") != "fourth,first" {
+		t.Errorf("ListLinks(spring) after delete = %v, want [fourth first]", got)
+	}
+}
+
+func testSearchTitlesAndTags(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	if _, err := s.CreateShortURL(ctx, "https://example.com/x", store.CreateOptions{
+		Alias: "titled",
+		Title: "Quarterly Report",
+		Tags:  []string{"finance", "q3-2025"},
+	}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	mustCreate(t, s, "https://example.com/y")
+
+	for _, query := range []string{"quarterly", "report quart", "finance", "q3"} {
+		if got := searchCodes(t, s, query, 0); strings.Join(got, ",") != "titled" {
+			t.Errorf("SearchLinks(%q) = %v, want [titled]", query, got)
+		}
+	}
+}
+
+// searchCodes returns the codes SearchLinks finds for query, in order
+func searchCodes(t *testing.T, s store.Store, query string, limit int) []string {
+	t.Helper()
+
+	records, err := s.SearchLinks(context.Background(), store.SearchOptions{Query: query, Limit: limit})
+	if err != nil {
+		t.Fatalf("SearchLinks(%q) error = %v", query, err)
+	}
+	var codes []string
+	for _, rec := range records {
+		codes = append(codes, rec.Code)
+	}
+	return codes
+}
+
+func testSearchLinks(t *testing.T, s store.Store, clock *Clock) {
+	ctx := context.Background()
+	create := func(originalURL, alias string) {
+		t.Helper()
+		if _, err := s.CreateShortURL(ctx, originalURL, store.CreateOptions{Alias: alias}); err != nil {
+			t.Fatalf("CreateShortURL(%q) error = %v", originalURL, err)
+		}
+		clock.Advance(time.Minute)
+	}
+	create("https://docs.example.com/getting-started", "onboarding")
+	create("https://example.com/pricing?plan=Team", "spring-sale")
+	create("https://blog.other.org/2024/launch", "launch-post")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"example", []string{"spring-sale", "onboarding"}},
+		{"EXAMPLE.com", []string{"spring-sale", "onboarding"}},
+		{"start", []string{"onboarding"}},
+		{"exam pric", []string{"spring-sale"}},
+		{"team", []string{"spring-sale"}},
+		{"sale", []string{"spring-sale"}},
+		{"launch", []string{"launch-post"}},
+		{"2024", []string{"launch-post"}},
+		{"example launch", nil},
+		{"nothing", nil},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		if got := searchCodes(t, s, tt.query, 0); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("SearchLinks(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if got := searchCodes(t, s, "example", 1); strings.Join(got, ",") != "spring-sale" {
+		t.Errorf("SearchLinks(example, limit 1) = %v, want [spring-sale]", got)
+	}
+}
+
+func testSearchFollowsUpdatesAndDeletes(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	code := mustCreate(t, s, "https://example.com/before")
+
+	after := "https://example.com/after"
+	if err := s.UpdateLink(ctx, code, store.LinkUpdate{OriginalURL: &after, Actor: store.ActorCreator}); err != nil {
+		t.Fatalf("UpdateLink() error = %v", err)
+	}
+	if got := searchCodes(t, s, "before", 0); len(got) != 0 {
+		t.Errorf("SearchLinks(before) after update = %v, want none", got)
+	}
+	if got := searchCodes(t, s, "after", 0); strings.Join(got, ",") != code {
+		t.Errorf("SearchLinks(after) = %v, want [%s]", got, code)
+	}
+
+	if err := s.DeleteLink(ctx, code); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+	if got := searchCodes(t, s, "after", 0); len(got) != 0 {
+		t.Errorf("SearchLinks(after) after delete = %v, want none", got)
+	}
+}
+
+func testSearchKeepsTitleAndTagsAfterUpdate(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	shortURL, err := s.CreateShortURL(ctx, "https://example.com/before", store.CreateOptions{
+		Title: "Spring launch",
+		Tags:  []string{"marketing"},
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	code := shortCode(t, shortURL)
+
+	after := "https://example.com/after"
+	if err := s.UpdateLink(ctx, code, store.LinkUpdate{OriginalURL: &after, Actor: store.ActorCreator}); err != nil {
+		t.Fatalf("UpdateLink() error = %v", err)
+	}
+	for _, query := range []string{"launch", "marketing", "after"} {
+		if got := searchCodes(t, s, query, 0); strings.Join(got, ",") != code {
+			t.Errorf("SearchLinks(%s) after update = %v, want [%s]", query, got, code)
+		}
+	}
+}
+
+func testListLinksInvalidCursor(t *testing.T, s store.Store) {
+	mustCreate(t, s, "https://example.com")
+
+	for _, cursor := range []string{"not base64!", "bm9jb2xvbg", "YWJjOmRlZg"} {
+		if _, err := s.ListLinks(context.Background(), store.ListOptions{Cursor: cursor}); !errors.Is(err, store.ErrInvalidCursor) {
+			t.Errorf("ListLinks(cursor %q) error = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func testPolicyDocument(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	document, err := s.GetPolicyDocument(ctx)
+	if err != nil || document != "" {
+		t.Fatalf("GetPolicyDocument() before saving = %q, %v; want empty", document, err)
+	}
+
+	for _, want := range []string{`{"policies": []}`, `{"policies": [{"name": "internal", "action": "allow", "rules": ["*.corp.example"]}]}`} {
+		if err := s.SavePolicyDocument(ctx, want); err != nil {
+			t.Fatalf("SavePolicyDocument() error = %v", err)
+		}
+		if got, err := s.GetPolicyDocument(ctx); err != nil || got != want {
+			t.Errorf("GetPolicyDocument() = %q, %v; want %q", got, err, want)
+		}
+	}
+}
+
+func testSuspendLink(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	code := mustCreate(t, s, "https://example.com")
+
+	if err := s.SetLinkStatus(ctx, code, store.StatusSuspended); err != nil {
+		t.Fatalf("SetLinkStatus(suspended) error = %v", err)
+	}
+	if _, err := s.GetOriginalURL(ctx, code); !errors.Is(err, store.ErrLinkSuspended) {
+		t.Errorf("GetOriginalURL() on suspended link error = %v, want ErrLinkSuspended", err)
+	}
+	urlData, err := s.GetURLData(ctx, code)
+	if err != nil || urlData == nil {
+		t.Fatalf("GetURLData() = %v, %v", urlData, err)
+	}
+	if urlData.Status != store.StatusSuspended || urlData.IsActive() {
+		t.Errorf("Status = %q, IsActive() = %v, want suspended and inactive", urlData.Status, urlData.IsActive())
+	}
+}
+
+func testReports(t *testing.T, s store.Store, clock *Clock) {
+	ctx := context.Background()
+	first := mustCreate(t, s, "https://first.example")
+	second := mustCreate(t, s, "https://second.example")
+
+	report := func(code, reporter string, want int64) {
+		t.Helper()
+		open, err := s.AddReport(ctx, code, store.Report{Reason: "phishing", Details: "asks for a password", Reporter: reporter})
+		if err != nil {
+			t.Fatalf("AddReport(%s, %s) error = %v", code, reporter, err)
+		}
+		if open != want {
+			t.Errorf("AddReport(%s, %s) = %d open reports, want %d", code, reporter, open, want)
+		}
+	}
+
+	report(first, "alice", 1)
+	report(first, "alice", 1)
+	clock.Advance(time.Minute)
+	report(second, "alice", 1)
+	clock.Advance(time.Minute)
+	report(first, "bob", 2)
+
+	if _, err := s.AddReport(ctx, "nonexistent", store.Report{Reason: "spam", Reporter: "alice"}); !errors.Is(err, store.ErrLinkNotFound) {
+		t.Errorf("AddReport(nonexistent) error = %v, want ErrLinkNotFound", err)
+	}
+
+	queue, err := s.ListReportedLinks(ctx, 0)
+	if err != nil {
+		t.Fatalf("ListReportedLinks() error = %v", err)
+	}
+	if len(queue) != 2 || queue[0].Code != first || queue[1].Code != second {
+		t.Fatalf("ListReportedLinks() = %+v, want %s then %s", queue, first, second)
+	}
+	if reports := queue[0].Reports; len(reports) != 2 || reports[0].Reporter != "alice" || reports[1].Reporter != "bob" {
+		t.Errorf("reports of %s = %+v, want alice's then bob's", first, reports)
+	}
+	if got := queue[0].Reports[0]; got.Reason != "phishing" || got.Details != "asks for a password" || got.CreatedAt.IsZero() {
+		t.Errorf("report = %+v, want the reason, details and time it was made", got)
+	}
+
+	if queue, err := s.ListReportedLinks(ctx, 1); err != nil || len(queue) != 1 || queue[0].Code != first {
+		t.Errorf("ListReportedLinks(1) = %+v, %v; want %s", queue, err, first)
+	}
+
+	if cleared, err := s.ClearReports(ctx, first); err != nil || cleared != 2 {
+		t.Errorf("ClearReports() = %d, %v; want 2", cleared, err)
+	}
+	if cleared, err := s.ClearReports(ctx, first); err != nil || cleared != 0 {
+		t.Errorf("ClearReports() again = %d, %v; want 0", cleared, err)
+	}
+	report(first, "alice", 1)
+
+	if err := s.DeleteLink(ctx, second); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+	if queue, err := s.ListReportedLinks(ctx, 0); err != nil || len(queue) != 1 || queue[0].Code != first {
+		t.Errorf("ListReportedLinks() after deleting %s = %+v, %v; want only %s", second, queue, err, first)
+	}
+}
+
+func testClickEvents(t *testing.T, s store.Store, clock *Clock) {
+	ctx := context.Background()
+	code := mustCreate(t, s, "https://example.com")
+	other := mustCreate(t, s, "https://other.example")
+
+	click := store.ClickEvent{
+		Referrer:       "https://news.example/post",
+		UserAgent:      "Mozilla/5.0",
+		AcceptLanguage: "en-GB,en;q=0.9",
+		IP:             "203.0.113.0",
+	}
+	first := clock.Now()
+	follow := func(code string, click store.ClickEvent) {
+		t.Helper()
+		if got, err := s.FollowLink(ctx, code, click); err != nil || got == "" {
+			t.Fatalf("FollowLink(%s) = %q, %v", code, got, err)
+		}
+	}
+	follow(code, click)
+	// Clicks in the same instant are all kept, in order
+	follow(code, store.ClickEvent{UserAgent: "second"})
+	clock.Advance(time.Hour)
+	second := clock.Now()
+	if _, err := s.GetOriginalURL(ctx, code); err != nil {
+		t.Fatalf("GetOriginalURL() error = %v", err)
+	}
+	follow(other, click)
+
+	// Failed follows are not logged
+	if got, err := s.FollowLink(ctx, "nonexistent", click); err != nil || got != "" {
+		t.Errorf("FollowLink(nonexistent) = %q, %v", got, err)
+	}
+
+	events, err := s.ListClickEvents(ctx, code, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("ListClickEvents() error = %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("ListClickEvents() = %+v, want 3 events", events)
+	}
+	want := click
+	want.Code = code
+	want.Timestamp = first
+	if got := events[0]; got.Code != want.Code || !got.Timestamp.Equal(want.Timestamp) || got.Referrer != want.Referrer ||
+		got.UserAgent != want.UserAgent || got.AcceptLanguage != want.AcceptLanguage || got.IP != want.IP {
+		t.Errorf("first event = %+v, want %+v", got, want)
+	}
+	if events[1].UserAgent != "second" || !events[1].Timestamp.Equal(first) {
+		t.Errorf("second event = %+v, want the second click at %v", events[1], first)
+	}
+	if got := events[2]; got.UserAgent != "" || !got.Timestamp.Equal(second) {
+		t.Errorf("third event = %+v, want a click without details at %v", got, second)
+	}
+
+	// from is inclusive and to exclusive
+	if events, err := s.ListClickEvents(ctx, code, second, time.Time{}); err != nil || len(events) != 1 {
+		t.Errorf("ListClickEvents(from %v) = %+v, %v; want the last event", second, events, err)
+	}
+	if events, err := s.ListClickEvents(ctx, code, time.Time{}, second); err != nil || len(events) != 2 {
+		t.Errorf("ListClickEvents(to %v) = %+v, %v; want the first two events", second, events, err)
+	}
+	if events, err := s.ListClickEvents(ctx, code, first.Add(time.Nanosecond), second); err != nil || len(events) != 0 {
+		t.Errorf("ListClickEvents() between clicks = %+v, %v; want none", events, err)
+	}
+
+	if err := s.DeleteLink(ctx, code); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+	if events, err := s.ListClickEvents(ctx, code, time.Time{}, time.Time{}); err != nil || len(events) != 0 {
+		t.Errorf("ListClickEvents() after DeleteLink = %+v, %v; want none", events, err)
+	}
+	if events, err := s.ListClickEvents(ctx, other, time.Time{}, time.Time{}); err != nil || len(events) != 1 {
+		t.Errorf("ListClickEvents(%s) = %+v, %v; want 1 event", other, events, err)
+	}
+}
+
+func testPurgeClickEvents(t *testing.T, s store.Store, clock *Clock) {
+	ctx := context.Background()
+	code := mustCreate(t, s, "https://example.com")
+	other := mustCreate(t, s, "https://other.example")
+
+	for _, c := range []string{code, other, code} {
+		if _, err := s.GetOriginalURL(ctx, c); err != nil {
+			t.Fatalf("GetOriginalURL(%s) error = %v", c, err)
+		}
+	}
+	clock.Advance(time.Hour)
+	cutoff := clock.Now()
+	if _, err := s.GetOriginalURL(ctx, code); err != nil {
+		t.Fatalf("GetOriginalURL() error = %v", err)
+	}
+
+	purged, err := s.PurgeClickEvents(ctx, cutoff)
+	if err != nil {
+		t.Fatalf("PurgeClickEvents() error = %v", err)
+	}
+	if purged != 3 {
+		t.Errorf("PurgeClickEvents() = %d, want 3", purged)
+	}
+	if events, err := s.ListClickEvents(ctx, code, time.Time{}, time.Time{}); err != nil || len(events) != 1 || !events[0].Timestamp.Equal(cutoff) {
+		t.Errorf("ListClickEvents() after purge = %+v, %v; want only the click at %v", events, err, cutoff)
+	}
+	if count, err := s.GetClickCount(ctx, code); err != nil || count != 3 {
+		t.Errorf("GetClickCount() after purge = %d, %v; want 3", count, err)
+	}
+
+	if purged, err := s.PurgeClickEvents(ctx, cutoff); err != nil || purged != 0 {
+		t.Errorf("PurgeClickEvents() again = %d, %v; want 0", purged, err)
+	}
+}
+
+func testCountClicks(t *testing.T, s store.Store, clock *Clock) {
+	ctx := context.Background()
+	code := mustCreate(t, s, "https://example.com")
+
+	// Start at 10:30 UTC tomorrow, so buckets line up the same whenever the test runs
+	day := clock.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	base := day.Add(10*time.Hour + 30*time.Minute)
+	clock.Advance(base.Sub(clock.Now()))
+	for _, d := range []time.Duration{0, 10 * time.Minute, 2*time.Hour + 45*time.Minute, 24 * time.Hour} {
+		clock.Advance(base.Add(d).Sub(clock.Now()))
+		if _, err := s.GetOriginalURL(ctx, code); err != nil {
+			t.Fatalf("GetOriginalURL() error = %v", err)
+		}
+	}
+
+	clicks := func(from, to time.Time, size time.Duration) []int64 {
+		t.Helper()
+		counts, err := s.CountClicks(ctx, code, from, to, size)
+		if err != nil {
+			t.Fatalf("CountClicks(%v) error = %v", size, err)
+		}
+		got := make([]int64, len(counts))
+		for i, count := range counts {
+			got[i] = count.Clicks
+			if want := from.UTC().Truncate(size).Add(time.Duration(i) * size); !count.Start.Equal(want) {
+				t.Errorf("CountClicks(%v) bucket %d starts at %v, want %v", size, i, count.Start, want)
+			}
+		}
+		return got
+	}
+
+	// The first bucket is the one holding from, and buckets without clicks count zero
+	if got := clicks(base, base.Add(3*time.Hour), time.Hour); !slices.Equal(got, []int64{2, 0, 0, 1}) {
+		t.Errorf("hourly clicks = %v, want [2 0 0 1]", got)
+	}
+	if got := clicks(base, base.Add(11*time.Minute), time.Minute); len(got) != 11 || got[0] != 1 || got[10] != 1 {
+		t.Errorf("clicks by minute = %v, want one in the first and last of 11", got)
+	}
+	if got := clicks(base, base.Add(48*time.Hour), 24*time.Hour); !slices.Equal(got, []int64{3, 1, 0}) {
+		t.Errorf("daily clicks = %v, want [3 1 0]", got)
+	}
+
+	if _, err := s.CountClicks(ctx, code, base, base.Add(time.Hour), 2*time.Hour); !errors.Is(err, store.ErrInvalidBucketSize) {
+		t.Errorf("CountClicks() by two hours error = %v, want ErrInvalidBucketSize", err)
+	}
+	if counts, err := s.CountClicks(ctx, "nonexistent", base, base.Add(time.Hour), time.Hour); err != nil || len(counts) != 2 || counts[0].Clicks+counts[1].Clicks != 0 {
+		t.Errorf("CountClicks(nonexistent) = %+v, %v; want two empty buckets", counts, err)
+	}
+
+	// Buckets that have ended by the purge cutoff go with their click events
+	if _, err := s.PurgeClickEvents(ctx, day.Add(13*time.Hour)); err != nil {
+		t.Fatalf("PurgeClickEvents() error = %v", err)
+	}
+	if got := clicks(base, base.Add(3*time.Hour), time.Hour); !slices.Equal(got, []int64{0, 0, 0, 1}) {
+		t.Errorf("hourly clicks after purge = %v, want [0 0 0 1]", got)
+	}
+
+	if err := s.DeleteLink(ctx, code); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+	if got := clicks(base, base.Add(48*time.Hour), 24*time.Hour); !slices.Equal(got, []int64{0, 0, 0}) {
+		t.Errorf("daily clicks after DeleteLink = %v, want none", got)
+	}
+}
+
+func testPurgeVisitorDays(t *testing.T, s store.Store, clock *Clock) {
+	ctx := context.Background()
+	code := mustCreate(t, s, "https://example.com")
+
+	firstDay := clock.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	secondDay := firstDay.Add(24 * time.Hour)
+	clock.Advance(firstDay.Sub(clock.Now()) + time.Hour)
+	for _, visitor := range []string{"alice", "bob"} {
+		if _, err := s.FollowLink(ctx, code, store.ClickEvent{Visitor: visitor}); err != nil {
+			t.Fatalf("FollowLink(%q) error = %v", visitor, err)
+		}
+	}
+	clock.Advance(24 * time.Hour)
+	if _, err := s.FollowLink(ctx, code, store.ClickEvent{Visitor: "carol"}); err != nil {
+		t.Fatalf("FollowLink(carol) error = %v", err)
+	}
+
+	check := func(name string, wantTotal int64, wantDays ...time.Time) {
+		t.Helper()
+		got, err := s.GetUniqueVisitors(ctx, code, time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("GetUniqueVisitors(%s) error = %v", name, err)
+		}
+		ok := got.Total == wantTotal && len(got.Days) == len(wantDays)
+		for i := 0; ok && i < len(wantDays); i++ {
+			ok = got.Days[i].Day.Equal(wantDays[i])
+		}
+		if !ok {
+			t.Errorf("GetUniqueVisitors(%s) = %+v, want total %d over days %v", name, got, wantTotal, wantDays)
+		}
+	}
+
+	// A day still under way when the retention ends is kept whole
+	if _, err := s.PurgeClickEvents(ctx, secondDay.Add(-time.Hour)); err != nil {
+		t.Fatalf("PurgeClickEvents() error = %v", err)
+	}
+	check("before the first day ends", 3, firstDay, secondDay)
+
+	// Once it has ended its visitors go with its click events
+	if _, err := s.PurgeClickEvents(ctx, secondDay); err != nil {
+		t.Fatalf("PurgeClickEvents() error = %v", err)
+	}
+	check("after the first day ends", 1, secondDay)
+
+	if _, err := s.PurgeClickEvents(ctx, secondDay.Add(48*time.Hour)); err != nil {
+		t.Fatalf("PurgeClickEvents() error = %v", err)
+	}
+	check("after both days end", 0)
+}
+
+func testUniqueVisitors(t *testing.T, s store.Store, clock *Clock) {
+	ctx := context.Background()
+	code := mustCreate(t, s, "https://example.com")
+
+	// Start an hour into a UTC day, so the clicks below fall on two known days
+	firstDay := clock.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	secondDay := firstDay.Add(24 * time.Hour)
+	clock.Advance(firstDay.Sub(clock.Now()) + time.Hour)
+
+	visit := func(visitor string) {
+		t.Helper()
+		if _, err := s.FollowLink(ctx, code, store.ClickEvent{Visitor: visitor}); err != nil {
+			t.Fatalf("FollowLink(%q) error = %v", visitor, err)
+		}
+	}
+	visit("alice")
+	visit("alice")
+	visit("bob")
+	// Clicks without a visitor are not counted
+	visit("")
+	clock.Advance(24 * time.Hour)
+	visit("alice")
+	visit("carol")
+
+	check := func(name string, from, to time.Time, wantTotal int64, wantDays ...store.DailyVisitors) {
+		t.Helper()
+		got, err := s.GetUniqueVisitors(ctx, code, from, to)
+		if err != nil {
+			t.Fatalf("GetUniqueVisitors(%s) error = %v", name, err)
+		}
+		ok := got.Total == wantTotal && len(got.Days) == len(wantDays)
+		for i := 0; ok && i < len(wantDays); i++ {
+			ok = got.Days[i].Day.Equal(wantDays[i].Day) && got.Days[i].Visitors == wantDays[i].Visitors
+		}
+		if !ok {
+			t.Errorf("GetUniqueVisitors(%s) = %+v, want total %d and days %+v", name, got, wantTotal, wantDays)
+		}
+	}
+	check("all time", time.Time{}, time.Time{}, 3,
+		store.DailyVisitors{Day: firstDay, Visitors: 2}, store.DailyVisitors{Day: secondDay, Visitors: 2})
+	// A range counts every day it overlaps
+	check("from midday", secondDay.Add(12*time.Hour), time.Time{}, 2, store.DailyVisitors{Day: secondDay, Visitors: 2})
+	check("to second day", time.Time{}, secondDay, 2, store.DailyVisitors{Day: firstDay, Visitors: 2})
+
+	if got, err := s.GetUniqueVisitors(ctx, "nonexistent", time.Time{}, time.Time{}); err != nil || got.Total != 0 || len(got.Days) != 0 {
+		t.Errorf("GetUniqueVisitors(nonexistent) = %+v, %v; want none", got, err)
+	}
+
+	if err := s.DeleteLink(ctx, code); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+	check("after DeleteLink", time.Time{}, time.Time{}, 0)
+}
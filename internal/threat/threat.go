@@ -0,0 +1,249 @@
+// Package threat matches URLs against local lists of hash prefixes of known phishing and malware URLs,
+// read from files in the format of Safe Browsing threat list updates
+package threat
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type is the kind of threat a list entry stands for, such as MALWARE
+type Type string
+
+const (
+	Malware           Type = "MALWARE"
+	SocialEngineering Type = "SOCIAL_ENGINEERING"
+	UnwantedSoftware  Type = "UNWANTED_SOFTWARE"
+)
+
+// Description is how the threat is named to visitors
+func (t Type) Description() string {
+	switch t {
+	case Malware:
+		return "malware"
+	case SocialEngineering:
+		return "phishing"
+	case UnwantedSoftware:
+		return "unwanted software"
+	default:
+		return "harmful content"
+	}
+}
+
+const (
+	minPrefixSize = 4
+	maxPrefixSize = sha256.Size
+)
+
+// updateFile is the part of a Safe Browsing threatListUpdates response that is read.
+// Every file is taken as a full update: it holds the complete list.
+type updateFile struct {
+	ListUpdateResponses []listUpdate `json:"listUpdateResponses"`
+}
+
+type listUpdate struct {
+	ThreatType Type       `json:"threatType"`
+	Additions  []addition `json:"additions"`
+}
+
+type addition struct {
+	RawHashes rawHashes `json:"rawHashes"`
+}
+
+type rawHashes struct {
+	PrefixSize int `json:"prefixSize"`
+	// RawHashes are the prefixes concatenated, base64 encoded
+	RawHashes []byte `json:"rawHashes"`
+}
+
+// prefixSet maps hash prefixes, as strings of raw bytes, to the threat listing them
+type prefixSet struct {
+	prefixes map[string]Type
+	// sizes are the distinct prefix lengths present, shortest first
+	sizes []int
+}
+
+// parse reads one update file into set
+func (set *prefixSet) parse(data []byte) error {
+	var file updateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid threat list: %w", err)
+	}
+
+	for _, list := range file.ListUpdateResponses {
+		if list.ThreatType == "" {
+			return fmt.Errorf("invalid threat list: missing threatType")
+		}
+		for _, addition := range list.Additions {
+			size, hashes := addition.RawHashes.PrefixSize, addition.RawHashes.RawHashes
+			if size < minPrefixSize || size > maxPrefixSize || len(hashes)%size != 0 {
+				return fmt.Errorf("invalid threat list: %d bytes of %d-byte prefixes", len(hashes), size)
+			}
+			for i := 0; i < len(hashes); i += size {
+				set.prefixes[string(hashes[i:i+size])] = list.ThreatType
+			}
+			if !slices.Contains(set.sizes, size) {
+				set.sizes = append(set.sizes, size)
+				slices.Sort(set.sizes)
+			}
+		}
+	}
+	return nil
+}
+
+// List is a hot-reloadable set of threat lists loaded from files
+type List struct {
+	files []string
+
+	mu  sync.RWMutex
+	set prefixSet
+	// loaded is the content of each file last loaded, to skip reloading unchanged lists
+	loaded [][]byte
+}
+
+// NewList returns a List for files, which is empty until it is first reloaded
+func NewList(files ...string) *List {
+	return &List{files: files, set: prefixSet{prefixes: map[string]Type{}}}
+}
+
+// Len returns how many hash prefixes are listed
+func (l *List) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.set.prefixes)
+}
+
+// Reload reads every file again and, if any changed, swaps in the new lists.
+// If a file cannot be read the previous lists stay in use.
+func (l *List) Reload() error {
+	contents := make([][]byte, len(l.files))
+	for i, file := range l.files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		contents[i] = data
+	}
+
+	l.mu.RLock()
+	unchanged := l.loaded != nil && slices.EqualFunc(contents, l.loaded, bytes.Equal)
+	l.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	set := prefixSet{prefixes: map[string]Type{}}
+	for i, data := range contents {
+		if err := set.parse(data); err != nil {
+			return fmt.Errorf("%s: %w", l.files[i], err)
+		}
+	}
+
+	l.mu.Lock()
+	l.set, l.loaded = set, contents
+	l.mu.Unlock()
+	log.Printf("Loaded %d threat list hash prefixes", len(set.prefixes))
+	return nil
+}
+
+// Run reloads the lists once per interval until ctx is done
+func (l *List) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Reload(); err != nil {
+				log.Printf("Failed to reload threat lists: %v", err)
+			}
+		}
+	}
+}
+
+// Lookup returns the threat rawURL is listed for, if any. Without a server to confirm
+// full hashes against, a matching prefix is taken as a match.
+func (l *List) Lookup(rawURL string) (Type, bool) {
+	l.mu.RLock()
+	set := l.set
+	l.mu.RUnlock()
+	if len(set.prefixes) == 0 {
+		return "", false
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	for _, expression := range expressions(u) {
+		hash := sha256.Sum256([]byte(expression))
+		for _, size := range set.sizes {
+			if threat, ok := set.prefixes[string(hash[:size])]; ok {
+				return threat, true
+			}
+		}
+	}
+	return "", false
+}
+
+// expressions returns the host suffix and path prefix combinations of u that Safe Browsing
+// lists are hashed from: for a.b.c/1/2.html?p=1 these are a.b.c/1/2.html?p=1,
+// a.b.c/1/2.html, a.b.c/, a.b.c/1/ and the same paths on b.c
+func expressions(u *url.URL) []string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	// The exact host, then up to four suffixes from the last five labels, without the bare TLD
+	hosts := []string{host}
+	if net.ParseIP(strings.Trim(host, "[]")) == nil {
+		labels := strings.Split(host, ".")
+		for i := max(1, len(labels)-5); i < len(labels)-1; i++ {
+			hosts = append(hosts, strings.Join(labels[i:], "."))
+		}
+	}
+
+	// The exact path with and without its query, then up to four directory prefixes from the root
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var paths []string
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	prefix := "/"
+	dirs := strings.Split(strings.Trim(path[:strings.LastIndex(path, "/")+1], "/"), "/")
+	for i := 0; i < 4; i++ {
+		if !slices.Contains(paths, prefix) {
+			paths = append(paths, prefix)
+		}
+		if i >= len(dirs) || dirs[i] == "" {
+			break
+		}
+		prefix += dirs[i] + "/"
+	}
+
+	var result []string
+	for _, h := range hosts {
+		for _, p := range paths {
+			result = append(result, h+p)
+		}
+	}
+	return result
+}
@@ -0,0 +1,138 @@
+package threat
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeList writes a threat list file listing the prefixSize-byte hash prefixes of expressions
+func writeList(t *testing.T, path string, threat Type, prefixSize int, expressions ...string) {
+	t.Helper()
+
+	var hashes []byte
+	for _, expression := range expressions {
+		hash := sha256.Sum256([]byte(expression))
+		hashes = append(hashes, hash[:prefixSize]...)
+	}
+
+	file := updateFile{ListUpdateResponses: []listUpdate{{
+		ThreatType: threat,
+		Additions:  []addition{{RawHashes: rawHashes{PrefixSize: prefixSize, RawHashes: hashes}}},
+	}}}
+	data, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"http://a.b.c/1/2.html?param=1", []string{
+			"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+			"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+		}},
+		{"http://a.b.c.d.e.f.g/1.html", []string{
+			"a.b.c.d.e.f.g/1.html", "a.b.c.d.e.f.g/",
+			"c.d.e.f.g/1.html", "c.d.e.f.g/", "d.e.f.g/1.html", "d.e.f.g/",
+			"e.f.g/1.html", "e.f.g/", "f.g/1.html", "f.g/",
+		}},
+		{"http://1.2.3.4/1/", []string{"1.2.3.4/1/", "1.2.3.4/"}},
+		{"https://Example.COM", []string{"example.com/"}},
+		{"http://a.b/1/2/3/4/5/6", []string{
+			"a.b/1/2/3/4/5/6", "a.b/", "a.b/1/", "a.b/1/2/", "a.b/1/2/3/",
+		}},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := expressions(u); !slices.Equal(got, tt.want) {
+			t.Errorf("expressions(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	phishing := filepath.Join(dir, "phishing.json")
+	malware := filepath.Join(dir, "malware.json")
+	writeList(t, phishing, SocialEngineering, 4, "login.evil.example/", "example.com/phish/")
+	writeList(t, malware, Malware, 32, "downloads.example/setup.exe")
+
+	list := NewList(phishing, malware)
+	if _, ok := list.Lookup("https://login.evil.example/"); ok {
+		t.Error("Lookup() matched before the lists were loaded")
+	}
+	if err := list.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	tests := []struct {
+		url  string
+		want Type
+	}{
+		{"https://login.evil.example/account?next=1", SocialEngineering},
+		{"https://www.login.evil.example/", SocialEngineering},
+		{"https://evil.example/", ""},
+		{"https://example.com/phish/page.html", SocialEngineering},
+		{"https://example.com/phishing/", ""},
+		{"https://downloads.example/setup.exe?v=2", Malware},
+		{"https://downloads.example/other.exe", ""},
+	}
+	for _, tt := range tests {
+		got, ok := list.Lookup(tt.url)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("Lookup(%q) = %q, %v; want %q", tt.url, got, ok, tt.want)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.json")
+	writeList(t, path, Malware, 4, "first.example/")
+
+	list := NewList(path)
+	if err := list.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, ok := list.Lookup("https://first.example/"); !ok {
+		t.Error("first.example is not listed")
+	}
+
+	writeList(t, path, Malware, 4, "second.example/", "third.example/")
+	if err := list.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, ok := list.Lookup("https://first.example/"); ok {
+		t.Error("first.example is still listed after reloading")
+	}
+	if got := list.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+
+	// A broken file leaves the last good lists in use
+	for _, data := range []string{`{`, `{"listUpdateResponses": [{"threatType": "MALWARE", "additions": [{"rawHashes": {"prefixSize": 4, "rawHashes": "AAAAAAA="}}]}]}`} {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := list.Reload(); err == nil {
+			t.Errorf("Reload(%s) succeeded", data)
+		}
+	}
+	if _, ok := list.Lookup("https://second.example/"); !ok {
+		t.Error("second.example is no longer listed after a failed reload")
+	}
+}